@@ -1,17 +1,25 @@
 package main
 
 import (
-	"crypto/ecdsa"
+	"bufio"
 	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/did/keystore"
 	"go.yumnet.cloud/orangesea/did/plc"
+	"golang.org/x/term"
+)
+
+const (
+	KEYSTORE_DIR_ENV        = "ORANGESEA_KEYSTORE"
+	KEYSTORE_PASSPHRASE_ENV = "ORANGESEA_KEYSTORE_PASSPHRASE"
 )
 
 type TestCase struct {
@@ -21,86 +29,269 @@ type TestCase struct {
 }
 
 func generateKeyPair(pubkeyPath string, prvKeyPath string) error {
-	prv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	didKey, err := key.GenerateDIDKey(elliptic.P256())
 	if err != nil {
 		return err
 	}
 
-	encoded, err := x509.MarshalPKCS8PrivateKey(prv)
+	prv, err := didKey.PKCS8PEM()
 	if err != nil {
 		return err
 	}
-
-	encodedPub, err := x509.MarshalPKIXPublicKey(&prv.PublicKey)
+	pub, err := didKey.SPKIPEM()
 	if err != nil {
 		return err
 	}
 
-	prvfile, err := os.Create(prvKeyPath)
-	if err != nil {
+	if err := os.WriteFile(prvKeyPath, prv, 0600); err != nil {
 		return err
 	}
-	defer func() {
-		err := prvfile.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}()
+	return os.WriteFile(pubkeyPath, pub, 0644)
+}
 
-	if err := pem.Encode(prvfile, &pem.Block{
-		Type: "PRIVATE KEY", Bytes: encoded,
-	}); err != nil {
-		return err
+// loadPrivateKey loads the private key in any format supported by key.ParseKey
+func loadPrivateKey(prvKeyPath string) (*key.DIDKey, error) {
+	b, err := os.ReadFile(prvKeyPath)
+	if err != nil {
+		return nil, err
 	}
 
-	pubfile, err := os.Create(pubkeyPath)
+	didKey, err := key.ParseKey(b, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if didKey.PrivateKey == nil {
+		return nil, fmt.Errorf("private key not found: %s", prvKeyPath)
 	}
-	defer func() {
-		err := pubfile.Close()
+	return didKey, nil
+}
+
+// openKeystore opens the keystore in $ORANGESEA_KEYSTORE, or ~/.orangesea/keystore
+func openKeystore() (*keystore.Keystore, error) {
+	dir := os.Getenv(KEYSTORE_DIR_ENV)
+	if dir == "" {
+		home, err := os.UserHomeDir()
 		if err != nil {
-			fmt.Println(err)
+			return nil, err
 		}
-	}()
-
-	if err := pem.Encode(pubfile, &pem.Block{
-		Type: "PRIVATE KEY", Bytes: encodedPub,
-	}); err != nil {
-		return err
+		dir = filepath.Join(home, ".orangesea", "keystore")
 	}
+	return keystore.New(dir)
+}
 
-	return nil
+var (
+	passphrase *string
+	stdin      = bufio.NewReader(os.Stdin)
+)
+
+// readPassphrase reads the passphrase of the keystore from $ORANGESEA_KEYSTORE_PASSPHRASE or stdin, only once
+func readPassphrase() (string, error) {
+	return readPassphraseConfirm(false)
 }
 
-func loadPrivateKey(prvKeyPath string) (*ecdsa.PrivateKey, error) {
-	prvfile, err := os.Open(prvKeyPath)
-	if err != nil {
-		return nil, err
+// readNewPassphrase reads the passphrase to encrypt a new key, asking twice on the terminal not to mistype it
+func readNewPassphrase() (string, error) {
+	return readPassphraseConfirm(true)
+}
+
+func readPassphraseConfirm(confirm bool) (string, error) {
+	if passphrase != nil {
+		return *passphrase, nil
+	}
+
+	p, ok := os.LookupEnv(KEYSTORE_PASSPHRASE_ENV)
+	if !ok {
+		var err error
+		if p, err = promptPassphrase("Passphrase: "); err != nil {
+			return "", err
+		}
+		if confirm && term.IsTerminal(int(os.Stdin.Fd())) {
+			again, err := promptPassphrase("Confirm passphrase: ")
+			if err != nil {
+				return "", err
+			}
+			if again != p {
+				return "", errors.New("passphrases do not match")
+			}
+		}
 	}
-	defer func() {
-		err := prvfile.Close()
+	passphrase = &p
+	return p, nil
+}
+
+// promptPassphrase reads a line from stdin without echo if stdin is a terminal
+func promptPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
 		if err != nil {
-			fmt.Println(err)
+			return "", err
 		}
-	}()
+		return string(b), nil
+	}
 
-	prvBytes, err := os.ReadFile(prvKeyPath)
+	line, err := stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// loadKey loads the private key from the file, or from the keystore by name if the file does not exist
+func loadKey(nameOrPath string) (*key.DIDKey, error) {
+	if _, err := os.Stat(nameOrPath); err == nil {
+		return loadPrivateKey(nameOrPath)
+	}
+
+	ks, err := openKeystore()
+	if err != nil {
+		return nil, err
+	}
+	p, err := readPassphrase()
 	if err != nil {
 		return nil, err
 	}
+	return ks.Load(nameOrPath, p)
+}
 
-	prvBlock, _ := pem.Decode(prvBytes)
-	if prvBlock == nil {
-		return nil, fmt.Errorf("failed to decode PEM block containing private key")
+// associateDID associates the DID with the key in the keystore, if the key is not loaded from the file
+func associateDID(nameOrPath string, did string) error {
+	if _, err := os.Stat(nameOrPath); err == nil {
+		return nil
 	}
 
-	prv, err := x509.ParsePKCS8PrivateKey(prvBlock.Bytes)
+	ks, err := openKeystore()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	p, err := readPassphrase()
+	if err != nil {
+		return err
 	}
+	return ks.SetDID(nameOrPath, did, p)
+}
+
+func runKeystore(args []string) error {
+	usage := errors.New(`Usage: cmd keystore <command> [<args>]
+Available commands:
+generate <name> <rotation|signing> [P-256|secp256k1]
+import <name> <rotation|signing> <prvkey_path>
+list
+export <name> [pkcs8|sec1|hex|multibase|jwk]
+delete <name>`)
+	if len(args) < 1 {
+		return usage
+	}
+
+	ks, err := openKeystore()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "generate", "import":
+		if len(args) < 3 || len(args) > 4 {
+			return usage
+		}
 
-	return prv.(*ecdsa.PrivateKey), nil
+		var didKey *key.DIDKey
+		if args[0] == "generate" {
+			curve := elliptic.P256()
+			if len(args) == 4 {
+				if curve, err = key.CurveByName(args[3]); err != nil {
+					return err
+				}
+			}
+			didKey, err = key.GenerateDIDKey(curve)
+		} else {
+			if len(args) != 4 {
+				return usage
+			}
+			didKey, err = loadPrivateKey(args[3])
+		}
+		if err != nil {
+			return err
+		}
+
+		p, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		meta, err := ks.Add(args[1], didKey, args[2], "", p)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Name:", meta.Name)
+		fmt.Println("Public key:", meta.PublicKey)
+
+	case "list":
+		list, err := ks.List()
+		if err != nil {
+			return err
+		}
+		for _, meta := range list {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", meta.Name, meta.Purpose, meta.PublicKey, meta.DID, meta.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+		}
+
+	case "export":
+		if len(args) < 2 || len(args) > 3 {
+			return usage
+		}
+		p, err := readPassphrase()
+		if err != nil {
+			return err
+		}
+		didKey, err := ks.Load(args[1], p)
+		if err != nil {
+			return err
+		}
+
+		format := "pkcs8"
+		if len(args) == 3 {
+			format = args[2]
+		}
+		var out []byte
+		switch format {
+		case "pkcs8":
+			out, err = didKey.PKCS8PEM()
+		case "sec1":
+			out, err = didKey.SEC1PEM()
+		case "hex", "multibase":
+			var encoded string
+			if format == "hex" {
+				encoded, err = didKey.PrivateKeyHex()
+			} else {
+				encoded, err = didKey.PrivateKeyMultibase()
+			}
+			out = []byte(encoded + "\n")
+		case "jwk":
+			var jwk *key.JWK
+			if jwk, err = didKey.PrivateJWK(); err == nil {
+				out, err = json.Marshal(jwk)
+				out = append(out, '\n')
+			}
+		default:
+			return usage
+		}
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+
+	case "delete":
+		if len(args) != 2 {
+			return usage
+		}
+		return ks.Delete(args[1])
+
+	default:
+		return usage
+	}
+	return nil
 }
 
 func main() {
@@ -108,6 +299,8 @@ func main() {
 		fmt.Println("Usage: cmd <command> [<args>]")
 		fmt.Println("Available commands:")
 		fmt.Println("genkeys <pubkey_path> <prvkey_path>")
+		fmt.Println("keystore <command> [<args>]")
+		fmt.Println("did:plc <command> [<args>]")
 		os.Exit(1)
 	}
 
@@ -122,27 +315,26 @@ func main() {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+	case "keystore":
+		if err := runKeystore(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	case "did:plc":
 		if len(os.Args) <= 2 {
 			fmt.Println("Usage: cmd did:plc <command> [<args>]")
 			fmt.Println("Available commands:")
-			fmt.Println("create <prvkey_path>")
-			fmt.Println("calc <prvkey_path>")
+			fmt.Println("create <key_name|prvkey_path>")
+			fmt.Println("calc <key_name|prvkey_path>")
 			os.Exit(1)
 		}
 		switch os.Args[2] {
 		case "create":
 			if len(os.Args) != 4 {
-				fmt.Println("Usage: cmd did:plc create <prvkey_path>")
+				fmt.Println("Usage: cmd did:plc create <key_name|prvkey_path>")
 				os.Exit(1)
 			}
-			prv, err := loadPrivateKey(os.Args[3])
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-
-			didKey, err := key.NewDIDKeyFromPrivateKey(prv.D.Bytes())
+			didKey, err := loadKey(os.Args[3])
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -161,22 +353,20 @@ func main() {
 				fmt.Println(err)
 				os.Exit(1)
 			}
-
+			// the DID is registered, so print it even if the association fails
 			fmt.Println("DID:", didPlc.DID)
-
-		case "calc":
-			if len(os.Args) != 4 {
-				fmt.Println("Usage: cmd calc <prvkey_path>")
+			if err := associateDID(os.Args[3], didPlc.DID); err != nil {
+				fmt.Printf("failed to associate the DID %s with the key %s in the keystore; %v\n", didPlc.DID, os.Args[3], err)
 				os.Exit(1)
 			}
 
-			prv, err := loadPrivateKey(os.Args[3])
-			if err != nil {
-				fmt.Println(err)
+		case "calc":
+			if len(os.Args) != 4 {
+				fmt.Println("Usage: cmd calc <key_name|prvkey_path>")
 				os.Exit(1)
 			}
 
-			didKey, err := key.NewDIDKeyFromPrivateKey(prv.D.Bytes())
+			didKey, err := loadKey(os.Args[3])
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -208,17 +398,11 @@ func main() {
 
 		case "update":
 			if len(os.Args) != 5 {
-				fmt.Println("Usage: cmd update <did> <prvkey_path>")
+				fmt.Println("Usage: cmd update <did> <key_name|prvkey_path>")
 				os.Exit(1)
 			}
 
-			prv, err := loadPrivateKey(os.Args[4])
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-
-			didKey, err := key.NewDIDKeyFromPrivateKey(prv.D.Bytes())
+			didKey, err := loadKey(os.Args[4])
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -249,17 +433,11 @@ func main() {
 
 		case "deactivate":
 			if len(os.Args) != 5 {
-				fmt.Println("Usage: cmd deactivate <did> <prvkey_path>")
-				os.Exit(1)
-			}
-
-			prv, err := loadPrivateKey(os.Args[4])
-			if err != nil {
-				fmt.Println(err)
+				fmt.Println("Usage: cmd deactivate <did> <key_name|prvkey_path>")
 				os.Exit(1)
 			}
 
-			didKey, err := key.NewDIDKeyFromPrivateKey(prv.D.Bytes())
+			didKey, err := loadKey(os.Args[4])
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -0,0 +1,413 @@
+package key
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"go.yumnet.cloud/orangesea/did/multicodec"
+)
+
+// types of the PEM blocks
+const (
+	PEM_TYPE_SEC1          = "EC PRIVATE KEY"
+	PEM_TYPE_PKCS8         = "PRIVATE KEY"
+	PEM_TYPE_SPKI          = "PUBLIC KEY"
+	PEM_TYPE_EC_PARAMETERS = "EC PARAMETERS"
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// ecPrivateKey is the SEC1 private key (RFC 5915)
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// pkcs8 is the PKCS#8 private key (RFC 5208)
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// spki is the SubjectPublicKeyInfo (RFC 5280)
+type spki struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func curveByOID(oid asn1.ObjectIdentifier) (elliptic.Curve, error) {
+	switch {
+	case oid.Equal(oidCurveP256):
+		return elliptic.P256(), nil
+	case oid.Equal(oidCurveSecp256k1):
+		return Secp256k1(), nil
+	}
+	return nil, fmt.Errorf("curve not supported: %s", oid)
+}
+
+func (did DIDKey) curveOID() asn1.ObjectIdentifier {
+	if did.PublicKey.Curve == Secp256k1() {
+		return oidCurveSecp256k1
+	}
+	return oidCurveP256
+}
+
+// algorithmCurve returns the curve of the algorithm identifier of the EC public key
+func algorithmCurve(algo pkix.AlgorithmIdentifier) (elliptic.Curve, error) {
+	if !algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("algorithm not supported: %s", algo.Algorithm)
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(algo.Parameters.FullBytes, &oid); err != nil {
+		return nil, fmt.Errorf("invalid curve parameters; %w", err)
+	}
+	return curveByOID(oid)
+}
+
+func (did DIDKey) algorithmIdentifier() (pkix.AlgorithmIdentifier, error) {
+	params, err := asn1.Marshal(did.curveOID())
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPublicKeyECDSA,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+// NewDIDKeyFromPrivateKeyHex returns the DIDKey of the private key scalar in hex on the curve
+func NewDIDKeyFromPrivateKeyHex(curve elliptic.Curve, s string) (*DIDKey, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key; %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("invalid private key; must be 32 bytes")
+	}
+	return NewDIDKeyFromPrivateKeyWithCurve(curve, b)
+}
+
+// NewDIDKeyFromPrivateKeyMultibase returns the DIDKey of the private key in multibase,
+// base58btc of the multicodec (p256-priv or secp256k1-priv) and the private key scalar
+func NewDIDKeyFromPrivateKeyMultibase(s string) (*DIDKey, error) {
+	decoded, err := decodeMultibase(s)
+	if err != nil {
+		return nil, err
+	}
+
+	code, b, err := multicodec.ParseMulticodec(decoded)
+	if err != nil {
+		return nil, err
+	}
+	var curve elliptic.Curve
+	switch code {
+	case multicodec.P256Priv:
+		curve = elliptic.P256()
+	case multicodec.Secp256k1Priv:
+		curve = Secp256k1()
+	default:
+		return nil, fmt.Errorf("multicodec not supported; code: %d", code)
+	}
+
+	if len(b) != 32 {
+		return nil, fmt.Errorf("invalid private key; must be 32 bytes")
+	}
+	return NewDIDKeyFromPrivateKeyWithCurve(curve, b)
+}
+
+// parseSEC1 parses the SEC1 private key
+// The curve is used if the key has no curve parameters, as in PKCS#8.
+func parseSEC1(der []byte, curve elliptic.Curve) (*DIDKey, error) {
+	var prv ecPrivateKey
+	rest, err := asn1.Unmarshal(der, &prv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sec1 private key; %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid sec1 private key; trailing data")
+	}
+	if prv.Version != 1 {
+		return nil, fmt.Errorf("invalid sec1 private key; version must be 1, got %d", prv.Version)
+	}
+
+	if len(prv.NamedCurveOID) > 0 {
+		curve, err = curveByOID(prv.NamedCurveOID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sec1 private key; %w", err)
+		}
+	}
+	if curve == nil {
+		return nil, fmt.Errorf("invalid sec1 private key; curve not found")
+	}
+	if len(prv.PrivateKey) > 32 {
+		return nil, fmt.Errorf("invalid sec1 private key; must be 32 bytes")
+	}
+
+	d := new(big.Int).SetBytes(prv.PrivateKey).FillBytes(make([]byte, 32))
+	key, err := NewDIDKeyFromPrivateKeyWithCurve(curve, d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sec1 private key; %w", err)
+	}
+	return key, nil
+}
+
+// ParseSEC1 parses the SEC1 private key in DER
+func ParseSEC1(der []byte) (*DIDKey, error) {
+	return parseSEC1(der, nil)
+}
+
+// ParsePKCS8 parses the PKCS#8 private key in DER
+func ParsePKCS8(der []byte) (*DIDKey, error) {
+	var prv pkcs8
+	rest, err := asn1.Unmarshal(der, &prv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs8 private key; %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid pkcs8 private key; trailing data")
+	}
+
+	curve, err := algorithmCurve(prv.Algo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs8 private key; %w", err)
+	}
+	return parseSEC1(prv.PrivateKey, curve)
+}
+
+// ParseSPKI parses the SubjectPublicKeyInfo public key in DER
+func ParseSPKI(der []byte) (*DIDKey, error) {
+	var pub spki
+	rest, err := asn1.Unmarshal(der, &pub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spki public key; %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid spki public key; trailing data")
+	}
+
+	curve, err := algorithmCurve(pub.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spki public key; %w", err)
+	}
+
+	parse := parseUncompressed
+	if len(pub.PublicKey.Bytes) == 33 {
+		parse = parseCompressed
+	}
+	key, err := parse(curve, pub.PublicKey.RightAlign())
+	if err != nil {
+		return nil, fmt.Errorf("invalid spki public key; %w", err)
+	}
+	return &DIDKey{PublicKey: *key}, nil
+}
+
+// ParsePEM parses the first key in PEM, SEC1 ("EC PRIVATE KEY"), PKCS#8 ("PRIVATE KEY") or SPKI ("PUBLIC KEY")
+// The "EC PARAMETERS" blocks written by OpenSSL are skipped.
+func ParsePEM(b []byte) (*DIDKey, error) {
+	for {
+		block, rest := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("invalid pem; key not found")
+		}
+
+		switch block.Type {
+		case PEM_TYPE_EC_PARAMETERS:
+			b = rest
+			continue
+		case PEM_TYPE_SEC1:
+			return ParseSEC1(block.Bytes)
+		case PEM_TYPE_PKCS8:
+			return ParsePKCS8(block.Bytes)
+		case PEM_TYPE_SPKI:
+			return ParseSPKI(block.Bytes)
+		}
+		return nil, fmt.Errorf("invalid pem; type not supported: %s", block.Type)
+	}
+}
+
+// ParseKey parses the private or public key, detecting the format
+//
+// The supported formats are PEM (SEC1, PKCS#8 and SPKI), DER, JWK, did:key, multibase
+// (the private key or Multikey), hex and raw bytes of the private key scalar.
+// The text formats are tried first; the input is treated as raw bytes only if it is not valid UTF-8,
+// use NewDIDKeyFromPrivateKeyWithCurve to parse raw bytes explicitly.
+// The curve is used for hex and raw bytes, which have no curve; nil means P256.
+func ParseKey(b []byte, curve elliptic.Curve) (*DIDKey, error) {
+	if curve == nil {
+		curve = elliptic.P256()
+	}
+
+	text := utf8.Valid(b)
+	if text {
+		if key, ok, err := parseText(bytes.TrimSpace(b), curve); ok {
+			return key, err
+		}
+	}
+
+	// binary formats
+	if len(b) > 0 && b[0] == 0x30 {
+		if key, err := ParsePKCS8(b); err == nil {
+			return key, nil
+		}
+		if key, err := ParseSEC1(b); err == nil {
+			return key, nil
+		}
+		if key, err := ParseSPKI(b); err == nil {
+			return key, nil
+		}
+	}
+	if len(b) == 32 && !text {
+		return NewDIDKeyFromPrivateKeyWithCurve(curve, b)
+	}
+	return nil, fmt.Errorf("invalid key; unknown format")
+}
+
+// parseText parses the key in the text formats
+// ok is false if the input is in none of the text formats.
+func parseText(b []byte, curve elliptic.Curve) (key *DIDKey, ok bool, err error) {
+	s := string(b)
+	switch {
+	case strings.HasPrefix(s, "-----BEGIN "):
+		key, err = ParsePEM(b)
+	case strings.HasPrefix(s, "{"):
+		key, err = ParseJWK(b)
+	case strings.HasPrefix(s, "did:key:"):
+		key, err = NewDIDKeyFromDID(s)
+	case strings.HasPrefix(s, "z"):
+		key, err = NewDIDKeyFromPrivateKeyMultibase(s)
+		if err != nil {
+			if public, perr := NewDIDKeyFromMultibase(s); perr == nil {
+				key, err = public, nil
+			}
+		}
+	case len(strings.TrimPrefix(s, "0x")) == 64:
+		key, err = NewDIDKeyFromPrivateKeyHex(curve, s)
+	default:
+		return nil, false, nil
+	}
+	return key, true, err
+}
+
+// PrivateKeyBytes returns the private key scalar in 32 bytes
+func (did DIDKey) PrivateKeyBytes() ([]byte, error) {
+	if did.PrivateKey == nil {
+		return nil, fmt.Errorf("failed to export private key; private key not found")
+	}
+	return did.PrivateKey.D.FillBytes(make([]byte, 32)), nil
+}
+
+// PrivateKeyHex returns the private key scalar in hex
+func (did DIDKey) PrivateKeyHex() (string, error) {
+	b, err := did.PrivateKeyBytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PrivateKeyMultibase returns the private key in multibase, the format printed by PDSes
+func (did DIDKey) PrivateKeyMultibase() (string, error) {
+	b, err := did.PrivateKeyBytes()
+	if err != nil {
+		return "", err
+	}
+
+	code := uint64(multicodec.P256Priv)
+	if did.PublicKey.Curve == Secp256k1() {
+		code = multicodec.Secp256k1Priv
+	}
+	return "z" + base58.Encode(multicodec.EncodeMulticodec(code, b)), nil
+}
+
+func (did DIDKey) marshalSEC1(withCurve bool) ([]byte, error) {
+	d, err := did.PrivateKeyBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	pub := marshalUncompressed(&did.PublicKey)
+	prv := ecPrivateKey{
+		Version:    1,
+		PrivateKey: d,
+		PublicKey:  asn1.BitString{Bytes: pub, BitLength: len(pub) * 8},
+	}
+	if withCurve {
+		prv.NamedCurveOID = did.curveOID()
+	}
+	return asn1.Marshal(prv)
+}
+
+// MarshalSEC1 returns the SEC1 private key in DER
+func (did DIDKey) MarshalSEC1() ([]byte, error) {
+	return did.marshalSEC1(true)
+}
+
+// MarshalPKCS8 returns the PKCS#8 private key in DER
+func (did DIDKey) MarshalPKCS8() ([]byte, error) {
+	// the curve is in the algorithm identifier, as crypto/x509 does
+	sec1, err := did.marshalSEC1(false)
+	if err != nil {
+		return nil, err
+	}
+	algo, err := did.algorithmIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs8{Version: 0, Algo: algo, PrivateKey: sec1})
+}
+
+// MarshalSPKI returns the SubjectPublicKeyInfo public key in DER
+func (did DIDKey) MarshalSPKI() ([]byte, error) {
+	algo, err := did.algorithmIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	pub := marshalUncompressed(&did.PublicKey)
+	return asn1.Marshal(spki{
+		Algorithm: algo,
+		PublicKey: asn1.BitString{Bytes: pub, BitLength: len(pub) * 8},
+	})
+}
+
+// SEC1PEM returns the SEC1 private key in PEM
+func (did DIDKey) SEC1PEM() ([]byte, error) {
+	der, err := did.MarshalSEC1()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEM_TYPE_SEC1, Bytes: der}), nil
+}
+
+// PKCS8PEM returns the PKCS#8 private key in PEM
+func (did DIDKey) PKCS8PEM() ([]byte, error) {
+	der, err := did.MarshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEM_TYPE_PKCS8, Bytes: der}), nil
+}
+
+// SPKIPEM returns the SubjectPublicKeyInfo public key in PEM
+func (did DIDKey) SPKIPEM() ([]byte, error) {
+	der, err := did.MarshalSPKI()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEM_TYPE_SPKI, Bytes: der}), nil
+}
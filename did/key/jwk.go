@@ -0,0 +1,143 @@
+package key
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+const JWK_KEY_TYPE_EC = "EC"
+
+var jwkEncoding = base64.RawURLEncoding
+
+// JWK is the JSON Web Key of an EC key (RFC 7517)
+type JWK struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	D       string `json:"d,omitempty"` // empty for a public key
+
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// ParseJWK parses the JSON of the public or private JWK into the DIDKey
+func ParseJWK(b []byte) (*DIDKey, error) {
+	var jwk JWK
+	if err := json.Unmarshal(b, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid jwk; %w", err)
+	}
+	return NewDIDKeyFromJWK(&jwk)
+}
+
+// decodeCoordinate decodes the base64url coordinate into 32 bytes
+// The coordinates without the leading zero bytes are also accepted, though RFC 7518 requires the full length.
+func decodeCoordinate(name string, s string) ([]byte, error) {
+	b, err := jwkEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk; %s: %w", name, err)
+	}
+	if len(b) == 0 || len(b) > 32 {
+		return nil, fmt.Errorf("invalid jwk; %s must be 32 bytes", name)
+	}
+	return new(big.Int).SetBytes(b).FillBytes(make([]byte, 32)), nil
+}
+
+// NewDIDKeyFromJWK returns the DIDKey of the public or private JWK
+// If the JWK has the private key, the public key must match it.
+func NewDIDKeyFromJWK(jwk *JWK) (*DIDKey, error) {
+	if jwk.KeyType != JWK_KEY_TYPE_EC {
+		return nil, fmt.Errorf("invalid jwk; kty must be EC, got %s", jwk.KeyType)
+	}
+	curve, err := CurveByName(jwk.Curve)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk; %w", err)
+	}
+
+	x, err := decodeCoordinate("x", jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeCoordinate("y", jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parseUncompressed(curve, append(append([]byte{0x04}, x...), y...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk; %w", err)
+	}
+
+	if jwk.D == "" {
+		return &DIDKey{PublicKey: *pub}, nil
+	}
+
+	d, err := decodeCoordinate("d", jwk.D)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewDIDKeyFromPrivateKeyWithCurve(curve, d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk; %w", err)
+	}
+	if key.PublicKey.X.Cmp(pub.X) != 0 || key.PublicKey.Y.Cmp(pub.Y) != 0 {
+		return nil, fmt.Errorf("invalid jwk; public key does not match the private key")
+	}
+	return key, nil
+}
+
+func encodeCoordinate(n *big.Int) string {
+	return jwkEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+}
+
+// PublicJWK returns the public JWK of the key
+func (did DIDKey) PublicJWK() *JWK {
+	return &JWK{
+		KeyType: JWK_KEY_TYPE_EC,
+		Curve:   did.CurveName(),
+		X:       encodeCoordinate(did.PublicKey.X),
+		Y:       encodeCoordinate(did.PublicKey.Y),
+	}
+}
+
+// PrivateJWK returns the private JWK of the key
+func (did DIDKey) PrivateJWK() (*JWK, error) {
+	if did.PrivateKey == nil {
+		return nil, fmt.Errorf("failed to export jwk; private key not found")
+	}
+
+	jwk := did.PublicJWK()
+	jwk.D = encodeCoordinate(did.PrivateKey.D)
+	return jwk, nil
+}
+
+// Thumbprint returns the JWK thumbprint (RFC 7638) of the key in base64url with SHA-256
+func (did DIDKey) Thumbprint() string {
+	thumbprint, _ := did.PublicJWK().Thumbprint()
+	return thumbprint
+}
+
+// Thumbprint returns the JWK thumbprint (RFC 7638) in base64url with SHA-256
+// Only the required members of the public key are used, so the private JWK has the same thumbprint.
+func (jwk *JWK) Thumbprint() (string, error) {
+	if jwk.KeyType != JWK_KEY_TYPE_EC {
+		return "", fmt.Errorf("invalid jwk; kty must be EC, got %s", jwk.KeyType)
+	}
+
+	// the members in lexicographic order without whitespace
+	b, err := json.Marshal(struct {
+		Curve   string `json:"crv"`
+		KeyType string `json:"kty"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return jwkEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,165 @@
+package key_test
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/did/key"
+)
+
+func TestNewDIDKeyFromJWK_TestCases(t *testing.T) {
+	data, err := os.ReadFile("./testcases.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []TestCaseJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) == 0 {
+		t.Fatal("no test cases")
+	}
+
+	for _, tc := range raw {
+		jwk := &key.JWK{
+			KeyType: key.JWK_KEY_TYPE_EC,
+			Curve:   key.P256,
+			X:       tc.PublicKey.X,
+			Y:       tc.PublicKey.Y,
+			D:       tc.PrivateKey,
+		}
+
+		got, err := key.NewDIDKeyFromJWK(jwk)
+		if err != nil {
+			t.Fatalf("NewDIDKeyFromJWK() error = %v", err)
+		}
+		if got.DID() != tc.DID {
+			t.Errorf("DID() = %v, want %v", got.DID(), tc.DID)
+		}
+
+		exported, err := got.PrivateJWK()
+		if err != nil {
+			t.Fatalf("PrivateJWK() error = %v", err)
+		}
+		again, err := key.NewDIDKeyFromJWK(exported)
+		if err != nil {
+			t.Fatalf("NewDIDKeyFromJWK() error = %v", err)
+		}
+		if !reflect.DeepEqual(again, got) {
+			t.Errorf("NewDIDKeyFromJWK() = %+v, want %+v", again, got)
+		}
+
+		public, err := key.NewDIDKeyFromDID(tc.DID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := public.PublicJWK(); p.X != exported.X || p.Y != exported.Y || p.D != "" {
+			t.Errorf("PublicJWK() = %+v", p)
+		}
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), key.Secp256k1()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			k, err := key.GenerateDIDKey(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jwk, err := k.PrivateJWK()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := key.ParseJWK(b)
+			if err != nil {
+				t.Fatalf("ParseJWK() error = %v", err)
+			}
+			if got.DID() != k.DID() || got.PrivateKey == nil || got.PrivateKey.D.Cmp(k.PrivateKey.D) != 0 {
+				t.Errorf("ParseJWK() = %v, want %v", got.DID(), k.DID())
+			}
+		})
+	}
+}
+
+func TestParseJWK_Failure(t *testing.T) {
+	k, err := key.GenerateDIDKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := key.GenerateDIDKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := k.PublicJWK()
+	otherJWK, err := other.PrivateJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		jwk  key.JWK
+	}{
+		{"failure case; kty", key.JWK{KeyType: "RSA", Curve: key.P256, X: pub.X, Y: pub.Y}},
+		{"failure case; crv", key.JWK{KeyType: "EC", Curve: "P-384", X: pub.X, Y: pub.Y}},
+		{"failure case; not on the curve", key.JWK{KeyType: "EC", Curve: key.SECP256K1, X: pub.X, Y: pub.Y}},
+		{"failure case; long x", key.JWK{KeyType: "EC", Curve: key.P256, X: pub.X + "AQID", Y: pub.Y}},
+		{"failure case; padded x", key.JWK{KeyType: "EC", Curve: key.P256, X: pub.X + "=", Y: pub.Y}},
+		{"failure case; private key mismatch", key.JWK{KeyType: "EC", Curve: key.P256, X: pub.X, Y: pub.Y, D: otherJWK.D}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(&tt.jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := key.ParseJWK(b); err == nil {
+				t.Errorf("ParseJWK() error = nil, wantErr true")
+			}
+		})
+	}
+}
+
+func TestJWK_Thumbprint(t *testing.T) {
+	k, err := key.GenerateDIDKey(key.Secp256k1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := k.PublicJWK()
+	pub.KeyID = "key-1"
+	pub.Algorithm = "ES256K"
+
+	// RFC 7638: the required members in lexicographic order without whitespace
+	canonical := `{"crv":"secp256k1","kty":"EC","x":"` + pub.X + `","y":"` + pub.Y + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	got, err := pub.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Thumbprint() = %v, want %v", got, want)
+	}
+
+	private, err := k.PrivateJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := private.Thumbprint(); got != want {
+		t.Errorf("Thumbprint() of private JWK = %v, want %v", got, want)
+	}
+	if got := k.Thumbprint(); got != want {
+		t.Errorf("DIDKey.Thumbprint() = %v, want %v", got, want)
+	}
+}
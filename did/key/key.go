@@ -1,6 +1,7 @@
 package key
 
 import (
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -8,8 +9,14 @@ import (
 	"math/big"
 	"strings"
 
-	"github.com/btcsuite/btcd/btcutil/base58"
-	"go.yumnet.cloud/orangesea/did/multicodec"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// names of the supported curves
+const (
+	P256      = "P-256"
+	SECP256K1 = "secp256k1"
 )
 
 type DIDKey struct {
@@ -17,6 +24,76 @@ type DIDKey struct {
 	PrivateKey *ecdsa.PrivateKey
 }
 
+// Secp256k1 returns the secp256k1 curve
+func Secp256k1() elliptic.Curve {
+	return secp256k1.S256()
+}
+
+// CurveByName returns the curve of the name, P256 or SECP256K1
+func CurveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case P256:
+		return elliptic.P256(), nil
+	case SECP256K1:
+		return Secp256k1(), nil
+	}
+	return nil, fmt.Errorf("curve not supported: %s", name)
+}
+
+// parseCompressed parses the compressed public key on the curve
+func parseCompressed(curve elliptic.Curve, b []byte) (*ecdsa.PublicKey, error) {
+	if len(b) != 33 {
+		return nil, fmt.Errorf("invalid public key; compressed key must be 33 bytes")
+	}
+
+	if curve == Secp256k1() {
+		pub, err := secp256k1.ParsePubKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key; %w", err)
+		}
+		return pub.ToECDSA(), nil
+	}
+
+	x, y := elliptic.UnmarshalCompressed(curve, b)
+	if x == nil {
+		return nil, fmt.Errorf("invalid public key; not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// parseUncompressed parses the uncompressed public key (0x04 || x || y) on the curve
+func parseUncompressed(curve elliptic.Curve, b []byte) (*ecdsa.PublicKey, error) {
+	if len(b) != 65 || b[0] != 0x04 {
+		return nil, fmt.Errorf("invalid public key; uncompressed key must be 65 bytes starting with 0x04")
+	}
+
+	if curve == Secp256k1() {
+		pub, err := secp256k1.ParsePubKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key; %w", err)
+		}
+		return pub.ToECDSA(), nil
+	}
+
+	if _, err := ecdh.P256().NewPublicKey(b); err != nil {
+		return nil, fmt.Errorf("invalid public key; %w", err)
+	}
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(b[1:33]),
+		Y:     new(big.Int).SetBytes(b[33:]),
+	}, nil
+}
+
+// marshalUncompressed returns the uncompressed public key (0x04 || x || y)
+func marshalUncompressed(pub *ecdsa.PublicKey) []byte {
+	b := make([]byte, 65)
+	b[0] = 0x04
+	pub.X.FillBytes(b[1:33])
+	pub.Y.FillBytes(b[33:])
+	return b
+}
+
 func NewDIDKeyFromDID(did string) (*DIDKey, error) {
 	splited := strings.Split(did, ":")
 	if len(splited) != 3 {
@@ -33,71 +110,78 @@ func NewDIDKeyFromDID(did string) (*DIDKey, error) {
 		return nil, fmt.Errorf("invalid did key; must not be empty")
 	}
 
-	id := splited[2]
-
-	// did:key must encoded by base58btc
-	if !strings.HasPrefix(id, "z") {
-		return nil, fmt.Errorf("invalid did key; must start with z")
-	}
-	decoded := base58.Decode(id[1:])
-
-	// check if this key is supported -- currently only P256Pub is supported
-	code, bytes, err := multicodec.ParseMulticodec(decoded)
+	key, err := NewDIDKeyFromMultibase(splited[2])
 	if err != nil {
-		return nil, err
-	}
-	if code != multicodec.P256Pub {
-		return nil, fmt.Errorf("multicodec not supported; code: %d", code)
+		return nil, fmt.Errorf("invalid did key; %w", err)
 	}
-	if bytes == nil {
-		return nil, fmt.Errorf("invalid did key; decoded bytes must not be nil")
-	}
-	if len(bytes) != 33 {
-		return nil, fmt.Errorf("invalid did key; decoded bytes must be 33 bytes")
-	}
-
-	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), bytes)
-	return &DIDKey{
-		PublicKey: ecdsa.PublicKey{
-			Curve: elliptic.P256(),
-			X:     x,
-			Y:     y,
-		},
-		PrivateKey: nil,
-	}, nil
+	return key, nil
 }
 
 func NewDIDKeyFromPrivateKey(privateKey []byte) (*DIDKey, error) {
-	x, y := elliptic.P256().ScalarBaseMult(privateKey)
+	return NewDIDKeyFromPrivateKeyWithCurve(elliptic.P256(), privateKey)
+}
 
-	pubKey := ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-		X:     x,
-		Y:     y,
+// NewDIDKeyFromPrivateKeyWithCurve returns the DIDKey of the private key scalar on the curve
+func NewDIDKeyFromPrivateKeyWithCurve(curve elliptic.Curve, privateKey []byte) (*DIDKey, error) {
+	d := new(big.Int).SetBytes(privateKey)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("invalid private key; out of range")
+	}
+
+	var pubKey ecdsa.PublicKey
+	if curve == Secp256k1() {
+		pubKey = *secp256k1.PrivKeyFromBytes(privateKey).PubKey().ToECDSA()
+	} else {
+		x, y := curve.ScalarBaseMult(privateKey)
+		pubKey = ecdsa.PublicKey{
+			Curve: curve,
+			X:     x,
+			Y:     y,
+		}
 	}
 
 	return &DIDKey{
 		PublicKey: pubKey,
 		PrivateKey: &ecdsa.PrivateKey{
 			PublicKey: pubKey,
-			D:         new(big.Int).SetBytes(privateKey),
+			D:         d,
 		},
 	}, nil
 }
 
-func (did DIDKey) DID() string {
-	encoded := base58.Encode(
-		multicodec.EncodeMulticodec(
-			multicodec.P256Pub,
-			elliptic.MarshalCompressed(elliptic.P256(), did.PublicKey.X, did.PublicKey.Y),
-		),
-	)
+// GenerateDIDKey generates a new DIDKey on the curve
+func GenerateDIDKey(curve elliptic.Curve) (*DIDKey, error) {
+	if curve == Secp256k1() {
+		prv, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		return NewDIDKeyFromPrivateKeyWithCurve(curve, prv.Serialize())
+	}
 
-	return fmt.Sprintf("did:key:z%s", encoded)
+	prv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &DIDKey{PublicKey: prv.PublicKey, PrivateKey: prv}, nil
 }
 
+// CurveName returns the name of the curve of the key, P256 or SECP256K1
+func (did DIDKey) CurveName() string {
+	if did.PublicKey.Curve == Secp256k1() {
+		return SECP256K1
+	}
+	return P256
+}
+
+func (did DIDKey) DID() string {
+	return fmt.Sprintf("did:key:%s", did.Multibase())
+}
+
+// Verify verifies the signature of r||s over the digest
+// The signature must be in the low-S form.
 func (did DIDKey) Verify(digest [32]byte, signature []byte) bool {
-	if did.PublicKey.Curve != elliptic.P256() {
+	if did.PublicKey.Curve != elliptic.P256() && did.PublicKey.Curve != Secp256k1() {
 		return false
 	}
 
@@ -110,18 +194,48 @@ func (did DIDKey) Verify(digest [32]byte, signature []byte) bool {
 		return false
 	}
 
+	if did.PublicKey.Curve == Secp256k1() {
+		return verifySecp256k1(&did.PublicKey, digest, signature)
+	}
+
 	r := new(big.Int).SetBytes(signature[:curveByteSize])
 	s := new(big.Int).SetBytes(signature[curveByteSize:])
 
+	// high-S signatures are malleable, and not allowed in atproto
+	halfOrder := new(big.Int).Rsh(did.PublicKey.Curve.Params().N, 1)
+	if s.Cmp(halfOrder) > 0 {
+		return false
+	}
+
 	return ecdsa.Verify(&did.PublicKey, digest[:], r, s)
 }
 
+func verifySecp256k1(pub *ecdsa.PublicKey, digest [32]byte, signature []byte) bool {
+	key, err := secp256k1.ParsePubKey(marshalUncompressed(pub))
+	if err != nil {
+		return false
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(signature[:32]) || s.SetByteSlice(signature[32:]) {
+		return false
+	}
+	if s.IsOverHalfOrder() {
+		return false
+	}
+	return secpecdsa.NewSignature(&r, &s).Verify(digest[:], key)
+}
+
+// Sign signs the digest, and returns the signature of r||s in the low-S form
 func (did DIDKey) Sign(digest [32]byte) ([]byte, error) {
 	if did.PrivateKey == nil {
 		return nil, fmt.Errorf("failed to sign; private key not found")
 	}
+	if did.PrivateKey.Curve == Secp256k1() {
+		return signSecp256k1(did.PrivateKey, digest), nil
+	}
 	if did.PrivateKey.Curve != elliptic.P256() {
-		return nil, fmt.Errorf("failed to sign; curve must be P256")
+		return nil, fmt.Errorf("failed to sign; curve must be P256 or secp256k1")
 	}
 
 	key := did.PrivateKey
@@ -131,6 +245,12 @@ func (did DIDKey) Sign(digest [32]byte) ([]byte, error) {
 		return nil, err
 	}
 
+	// normalize to the low-S form
+	n := key.Curve.Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s = new(big.Int).Sub(n, s)
+	}
+
 	curveByteSize := key.Curve.Params().BitSize / 8
 	if key.Curve.Params().BitSize/8%8 > 0 {
 		curveByteSize += 1
@@ -143,3 +263,17 @@ func (did DIDKey) Sign(digest [32]byte) ([]byte, error) {
 
 	return sig, nil
 }
+
+func signSecp256k1(key *ecdsa.PrivateKey, digest [32]byte) []byte {
+	prv := secp256k1.PrivKeyFromBytes(key.D.FillBytes(make([]byte, 32)))
+	defer prv.Zero()
+
+	// the signature is deterministic (RFC 6979) and in the low-S form
+	signature := secpecdsa.Sign(prv, digest[:])
+	r, s := signature.R(), signature.S()
+
+	sig := make([]byte, 64)
+	r.PutBytesUnchecked(sig[:32])
+	s.PutBytesUnchecked(sig[32:])
+	return sig
+}
@@ -3,13 +3,17 @@ package key_test
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"math/big"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil/base58"
 	"go.yumnet.cloud/orangesea/did/key"
 )
 
@@ -34,20 +38,15 @@ var testCases []TestCase
 func init() {
 	testing.Init()
 	var raw []TestCaseJSON
-	f, err := os.Open("./testcases.json")
+	data, err := os.ReadFile("./testcases.json")
 	if err != nil {
 		panic(err)
 	}
-	defer f.Close()
 
-	var data []byte
-	_, err = f.Read(data)
-	if err != nil {
+	if err := json.Unmarshal(data, &raw); err != nil {
 		panic(err)
 	}
 
-	json.Unmarshal(data, &raw)
-
 	for _, tc := range raw {
 		x, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(tc.PublicKey.X)
 		if err != nil {
@@ -200,3 +199,130 @@ func TestDIDKey_DID(t *testing.T) {
 		})
 	}
 }
+
+type w3cTestCase struct {
+	PrivateKeyBytesHex    string `json:"privateKeyBytesHex"`
+	PrivateKeyBytesBase58 string `json:"privateKeyBytesBase58"`
+	PublicDidKey          string `json:"publicDidKey"`
+}
+
+type signatureTestCase struct {
+	Comment            string `json:"comment"`
+	MessageBase64      string `json:"messageBase64"`
+	DIDDocSuite        string `json:"didDocSuite"`
+	PublicKeyDid       string `json:"publicKeyDid"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+	SignatureBase64    string `json:"signatureBase64"`
+	ValidSignature     bool   `json:"validSignature"`
+}
+
+func readTestData(t *testing.T, name string, v interface{}) {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDIDKey_W3C(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		curve elliptic.Curve
+	}{
+		{"P-256", "w3c_didkey_P256.json", elliptic.P256()},
+		{"secp256k1", "w3c_didkey_K256.json", key.Secp256k1()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cases []w3cTestCase
+			readTestData(t, tt.file, &cases)
+
+			for _, tc := range cases {
+				d, err := hex.DecodeString(tc.PrivateKeyBytesHex)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tc.PrivateKeyBytesBase58 != "" {
+					d = base58.Decode(tc.PrivateKeyBytesBase58)
+				}
+				k, err := key.NewDIDKeyFromPrivateKeyWithCurve(tt.curve, d)
+				if err != nil {
+					t.Fatalf("NewDIDKeyFromPrivateKeyWithCurve() error = %v", err)
+				}
+				if got := k.DID(); got != tc.PublicDidKey {
+					t.Errorf("DID() = %v, want %v", got, tc.PublicDidKey)
+				}
+
+				parsed, err := key.NewDIDKeyFromDID(tc.PublicDidKey)
+				if err != nil {
+					t.Fatalf("NewDIDKeyFromDID() error = %v", err)
+				}
+				if parsed.CurveName() != tt.name || parsed.PublicKey.X.Cmp(k.PublicKey.X) != 0 || parsed.PublicKey.Y.Cmp(k.PublicKey.Y) != 0 {
+					t.Errorf("NewDIDKeyFromDID() = %v, want %v", parsed.PublicKey, k.PublicKey)
+				}
+			}
+		})
+	}
+}
+
+func TestDIDKey_Verify_Fixtures(t *testing.T) {
+	var cases []signatureTestCase
+	readTestData(t, "signature-fixtures.json", &cases)
+
+	for _, tc := range cases {
+		t.Run(tc.Comment, func(t *testing.T) {
+			msg, err := base64.RawStdEncoding.DecodeString(tc.MessageBase64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := base64.RawStdEncoding.DecodeString(tc.SignatureBase64)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			k, err := key.NewDIDKeyFromDID(tc.PublicKeyDid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := k.Verify(sha256.Sum256(msg), sig); got != tc.ValidSignature {
+				t.Errorf("Verify() = %v, want %v", got, tc.ValidSignature)
+			}
+		})
+	}
+}
+
+func TestDIDKey_Sign(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), key.Secp256k1()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			k, err := key.GenerateDIDKey(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+
+			for i := 0; i < 16; i++ {
+				digest := sha256.Sum256([]byte{byte(i)})
+				sig, err := k.Sign(digest)
+				if err != nil {
+					t.Fatalf("Sign() error = %v", err)
+				}
+				if new(big.Int).SetBytes(sig[32:]).Cmp(halfOrder) > 0 {
+					t.Errorf("Sign() = %x; must be low-S", sig)
+				}
+				if !k.Verify(digest, sig) {
+					t.Errorf("Verify() = false, want true")
+				}
+
+				digest[0] ^= 1
+				if k.Verify(digest, sig) {
+					t.Errorf("Verify() = true for other digest, want false")
+				}
+			}
+		})
+	}
+}
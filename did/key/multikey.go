@@ -0,0 +1,123 @@
+package key
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"go.yumnet.cloud/orangesea/did/multicodec"
+)
+
+// types of the verification methods in DID documents
+const (
+	TYPE_MULTIKEY = "Multikey"
+
+	// legacy types; the key is not prefixed with the multicodec
+	TYPE_ECDSA_SECP256R1_2019 = "EcdsaSecp256r1VerificationKey2019"
+	TYPE_ECDSA_SECP256K1_2019 = "EcdsaSecp256k1VerificationKey2019"
+)
+
+// decodeMultibase decodes the base58btc multibase string
+func decodeMultibase(s string) ([]byte, error) {
+	// atproto only uses base58btc
+	b, ok := strings.CutPrefix(s, "z")
+	if !ok {
+		return nil, fmt.Errorf("invalid multibase; must start with z")
+	}
+	decoded := base58.Decode(b)
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("invalid multibase; not base58btc")
+	}
+	return decoded, nil
+}
+
+// NewDIDKeyFromMultibase returns the DIDKey of the publicKeyMultibase in the Multikey format,
+// base58btc of the multicodec and the compressed key
+func NewDIDKeyFromMultibase(s string) (*DIDKey, error) {
+	decoded, err := decodeMultibase(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if this key is supported -- P256Pub and Secp256k1Pub are supported
+	code, bytes, err := multicodec.ParseMulticodec(decoded)
+	if err != nil {
+		return nil, err
+	}
+	var curve elliptic.Curve
+	switch code {
+	case multicodec.P256Pub:
+		curve = elliptic.P256()
+	case multicodec.Secp256k1Pub:
+		curve = Secp256k1()
+	default:
+		return nil, fmt.Errorf("multicodec not supported; code: %d", code)
+	}
+
+	pub, err := parseCompressed(curve, bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &DIDKey{PublicKey: *pub}, nil
+}
+
+// NewDIDKeyFromLegacyMultibase returns the DIDKey of the publicKeyMultibase in the legacy format,
+// base58btc of the uncompressed or compressed key without the multicodec
+func NewDIDKeyFromLegacyMultibase(curve elliptic.Curve, s string) (*DIDKey, error) {
+	decoded, err := decodeMultibase(s)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := parseUncompressed
+	if len(decoded) == 33 {
+		parse = parseCompressed
+	}
+	pub, err := parse(curve, decoded)
+	if err != nil {
+		return nil, err
+	}
+	return &DIDKey{PublicKey: *pub}, nil
+}
+
+// NewDIDKeyFromVerificationMethod returns the DIDKey of the publicKeyMultibase of the verification method type
+func NewDIDKeyFromVerificationMethod(typ string, publicKeyMultibase string) (*DIDKey, error) {
+	switch typ {
+	case TYPE_MULTIKEY:
+		return NewDIDKeyFromMultibase(publicKeyMultibase)
+	case TYPE_ECDSA_SECP256R1_2019:
+		return NewDIDKeyFromLegacyMultibase(elliptic.P256(), publicKeyMultibase)
+	case TYPE_ECDSA_SECP256K1_2019:
+		return NewDIDKeyFromLegacyMultibase(Secp256k1(), publicKeyMultibase)
+	}
+	return nil, fmt.Errorf("verification method type not supported: %s", typ)
+}
+
+// Multibase returns the publicKeyMultibase of the key in the Multikey format
+func (did DIDKey) Multibase() string {
+	code := uint64(multicodec.P256Pub)
+	if did.PublicKey.Curve == Secp256k1() {
+		code = multicodec.Secp256k1Pub
+	}
+
+	return "z" + base58.Encode(
+		multicodec.EncodeMulticodec(
+			code,
+			elliptic.MarshalCompressed(did.PublicKey.Curve, did.PublicKey.X, did.PublicKey.Y),
+		),
+	)
+}
+
+// LegacyMultibase returns the publicKeyMultibase of the key in the legacy format with the uncompressed key
+func (did DIDKey) LegacyMultibase() string {
+	return "z" + base58.Encode(marshalUncompressed(&did.PublicKey))
+}
+
+// LegacyType returns the legacy verification method type of the key
+func (did DIDKey) LegacyType() string {
+	if did.PublicKey.Curve == Secp256k1() {
+		return TYPE_ECDSA_SECP256K1_2019
+	}
+	return TYPE_ECDSA_SECP256R1_2019
+}
@@ -0,0 +1,94 @@
+package key_test
+
+import (
+	"crypto/elliptic"
+	"strings"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/did/key"
+)
+
+func TestNewDIDKeyFromVerificationMethod_Fixtures(t *testing.T) {
+	var cases []signatureTestCase
+	readTestData(t, "signature-fixtures.json", &cases)
+
+	for _, tc := range cases {
+		t.Run(tc.Comment, func(t *testing.T) {
+			want, err := key.NewDIDKeyFromDID(tc.PublicKeyDid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the legacy format
+			got, err := key.NewDIDKeyFromVerificationMethod(tc.DIDDocSuite, tc.PublicKeyMultibase)
+			if err != nil {
+				t.Fatalf("NewDIDKeyFromVerificationMethod() error = %v", err)
+			}
+			if got.DID() != tc.PublicKeyDid {
+				t.Errorf("NewDIDKeyFromVerificationMethod() = %v, want %v", got.DID(), tc.PublicKeyDid)
+			}
+			if got.LegacyType() != tc.DIDDocSuite {
+				t.Errorf("LegacyType() = %v, want %v", got.LegacyType(), tc.DIDDocSuite)
+			}
+
+			// the Multikey format
+			multibase := strings.TrimPrefix(tc.PublicKeyDid, "did:key:")
+			if got := want.Multibase(); got != multibase {
+				t.Errorf("Multibase() = %v, want %v", got, multibase)
+			}
+			got, err = key.NewDIDKeyFromVerificationMethod(key.TYPE_MULTIKEY, multibase)
+			if err != nil {
+				t.Fatalf("NewDIDKeyFromVerificationMethod() error = %v", err)
+			}
+			if got.DID() != tc.PublicKeyDid {
+				t.Errorf("NewDIDKeyFromVerificationMethod() = %v, want %v", got.DID(), tc.PublicKeyDid)
+			}
+		})
+	}
+}
+
+func TestDIDKey_LegacyMultibase(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), key.Secp256k1()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			k, err := key.GenerateDIDKey(curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := key.NewDIDKeyFromVerificationMethod(k.LegacyType(), k.LegacyMultibase())
+			if err != nil {
+				t.Fatalf("NewDIDKeyFromVerificationMethod() error = %v", err)
+			}
+			if got.DID() != k.DID() {
+				t.Errorf("NewDIDKeyFromVerificationMethod() = %v, want %v", got.DID(), k.DID())
+			}
+		})
+	}
+}
+
+func TestNewDIDKeyFromVerificationMethod_Failure(t *testing.T) {
+	p256, err := key.GenerateDIDKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		typ       string
+		multibase string
+	}{
+		{"failure case; unknown type", "Ed25519VerificationKey2020", p256.Multibase()},
+		{"failure case; not base58btc", key.TYPE_MULTIKEY, "m" + p256.Multibase()[1:]},
+		{"failure case; empty", key.TYPE_MULTIKEY, ""},
+		{"failure case; legacy key as Multikey", key.TYPE_MULTIKEY, p256.LegacyMultibase()},
+		{"failure case; Multikey as legacy", key.TYPE_ECDSA_SECP256R1_2019, p256.Multibase()},
+		{"failure case; wrong curve", key.TYPE_ECDSA_SECP256K1_2019, p256.LegacyMultibase()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := key.NewDIDKeyFromVerificationMethod(tt.typ, tt.multibase); err == nil {
+				t.Errorf("NewDIDKeyFromVerificationMethod() error = nil, wantErr true")
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// the package keystore stores the private keys on disk, encrypted with a passphrase
+
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	VERSION = 1
+
+	PURPOSE_ROTATION = "rotation"
+	PURPOSE_SIGNING  = "signing"
+
+	KDF_SCRYPT   = "scrypt"
+	KDF_ARGON2ID = "argon2id"
+
+	CIPHER_AES_256_GCM = "aes-256-gcm"
+
+	FILE_EXTENSION = ".json"
+	FILE_MODE      = 0600
+	DIR_MODE       = 0700
+
+	SALT_SIZE = 16
+	KEY_SIZE  = 32
+
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+
+	ARGON2_TIME    = 3
+	ARGON2_MEMORY  = 64 * 1024 // KiB
+	ARGON2_THREADS = 4
+
+	// the upper limits of the parameters in the entries, not to exhaust the resources
+	MAX_SCRYPT_N      = 1 << 20
+	MAX_SCRYPT_R      = 32
+	MAX_SCRYPT_P      = 16
+	MAX_SCRYPT_MEMORY = 1 << 30 // bytes; scrypt uses 128 * N * R bytes
+	MAX_ARGON2_TIME   = 16
+	MAX_ARGON2_MEMORY = 1024 * 1024 // KiB
+)
+
+var (
+	ErrNotFound          = errors.New("key not found")
+	ErrAlreadyExists     = errors.New("key already exists")
+	ErrInvalidPassphrase = errors.New("invalid passphrase")
+)
+
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// Metadata is the metadata of the key, stored in plaintext
+// The metadata is authenticated with the encrypted key, so it cannot be modified without the passphrase.
+type Metadata struct {
+	Name      string    `json:"name"`
+	Purpose   string    `json:"purpose"`       // PURPOSE_ROTATION or PURPOSE_SIGNING
+	DID       string    `json:"did,omitempty"` // the associated DID
+	PublicKey string    `json:"publicKey"`     // did:key of the key
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type KDFParams struct {
+	Salt string `json:"salt"` // base64
+
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// argon2id
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"` // KiB
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+type Crypto struct {
+	KDF        string    `json:"kdf"`
+	KDFParams  KDFParams `json:"kdfparams"`
+	Cipher     string    `json:"cipher"`
+	Nonce      string    `json:"nonce"`      // base64
+	Ciphertext string    `json:"ciphertext"` // base64 of the private key in multibase
+}
+
+// Entry is the file of the key in the keystore
+type Entry struct {
+	Version  int      `json:"version"`
+	Metadata Metadata `json:"metadata"`
+	Crypto   Crypto   `json:"crypto"`
+}
+
+// Keystore is the directory of the encrypted keys, one file per key
+type Keystore struct {
+	Dir string
+	KDF string // KDF_SCRYPT or KDF_ARGON2ID; KDF_SCRYPT if empty
+}
+
+// New returns the keystore in the directory, creating the directory if not exists
+func New(dir string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, DIR_MODE); err != nil {
+		return nil, fmt.Errorf("failed to create keystore; %w", err)
+	}
+	return &Keystore{Dir: dir, KDF: KDF_SCRYPT}, nil
+}
+
+func validateName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("invalid key name: %s; must be alphanumerics, '.', '_' or '-' up to 64 characters", name)
+	}
+	return nil
+}
+
+func validatePurpose(purpose string) error {
+	if purpose != PURPOSE_ROTATION && purpose != PURPOSE_SIGNING {
+		return fmt.Errorf("invalid purpose: %s; must be %s or %s", purpose, PURPOSE_ROTATION, PURPOSE_SIGNING)
+	}
+	return nil
+}
+
+func (ks *Keystore) path(name string) string {
+	return filepath.Join(ks.Dir, name+FILE_EXTENSION)
+}
+
+// deriveKey derives the encryption key from the passphrase
+func deriveKey(passphrase string, kdf string, params KDFParams) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt; %w", err)
+	}
+
+	switch kdf {
+	case KDF_SCRYPT:
+		if params.N > MAX_SCRYPT_N {
+			return nil, fmt.Errorf("invalid scrypt parameters; n must be at most %d", MAX_SCRYPT_N)
+		}
+		if params.R <= 0 || params.R > MAX_SCRYPT_R || params.P <= 0 || params.P > MAX_SCRYPT_P {
+			return nil, fmt.Errorf("invalid scrypt parameters; r must be 1 to %d, and p must be 1 to %d", MAX_SCRYPT_R, MAX_SCRYPT_P)
+		}
+		if 128*int64(params.N)*int64(params.R) > MAX_SCRYPT_MEMORY {
+			return nil, fmt.Errorf("invalid scrypt parameters; n * r must use at most %d bytes", MAX_SCRYPT_MEMORY)
+		}
+		return scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, KEY_SIZE)
+	case KDF_ARGON2ID:
+		if params.Time == 0 || params.Time > MAX_ARGON2_TIME || params.Memory > MAX_ARGON2_MEMORY || params.Threads == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters")
+		}
+		return argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, KEY_SIZE), nil
+	}
+	return nil, fmt.Errorf("kdf not supported: %s", kdf)
+}
+
+// encrypt encrypts the key with the metadata as the additional data
+func (ks *Keystore) encrypt(key *didkey.DIDKey, meta *Metadata, passphrase string) (*Entry, error) {
+	plaintext, err := key.PrivateKeyMultibase()
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	crypto := Crypto{
+		KDF:       ks.KDF,
+		KDFParams: KDFParams{Salt: base64.StdEncoding.EncodeToString(salt)},
+		Cipher:    CIPHER_AES_256_GCM,
+	}
+	switch ks.KDF {
+	case KDF_SCRYPT, "":
+		crypto.KDF = KDF_SCRYPT
+		crypto.KDFParams.N, crypto.KDFParams.R, crypto.KDFParams.P = SCRYPT_N, SCRYPT_R, SCRYPT_P
+	case KDF_ARGON2ID:
+		crypto.KDFParams.Time, crypto.KDFParams.Memory, crypto.KDFParams.Threads = ARGON2_TIME, ARGON2_MEMORY, ARGON2_THREADS
+	default:
+		return nil, fmt.Errorf("kdf not supported: %s", ks.KDF)
+	}
+
+	aead, err := newAEAD(passphrase, &crypto)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	crypto.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	crypto.Ciphertext = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, []byte(plaintext), ad))
+	return &Entry{Version: VERSION, Metadata: *meta, Crypto: crypto}, nil
+}
+
+func newAEAD(passphrase string, crypto *Crypto) (cipher.AEAD, error) {
+	if crypto.Cipher != CIPHER_AES_256_GCM {
+		return nil, fmt.Errorf("cipher not supported: %s", crypto.Cipher)
+	}
+	key, err := deriveKey(passphrase, crypto.KDF, crypto.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decrypt decrypts the key of the entry
+func decrypt(entry *Entry, passphrase string) (*didkey.DIDKey, error) {
+	if entry.Version != VERSION {
+		return nil, fmt.Errorf("invalid entry; version not supported: %d", entry.Version)
+	}
+
+	aead, err := newAEAD(passphrase, &entry.Crypto)
+	if err != nil {
+		return nil, fmt.Errorf("invalid entry; %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(entry.Crypto.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid entry; invalid nonce")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(entry.Crypto.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid entry; %w", err)
+	}
+	ad, err := json.Marshal(&entry.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		// the wrong passphrase, or the modified entry
+		return nil, ErrInvalidPassphrase
+	}
+
+	key, err := didkey.NewDIDKeyFromPrivateKeyMultibase(string(plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("invalid entry; %w", err)
+	}
+	if key.DID() != entry.Metadata.PublicKey {
+		return nil, fmt.Errorf("invalid entry; public key does not match the private key")
+	}
+	return key, nil
+}
+
+func (ks *Keystore) read(name string) (*Entry, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(ks.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, fmt.Errorf("invalid entry: %s; %w", name, err)
+	}
+	if entry.Metadata.Name != name {
+		return nil, fmt.Errorf("invalid entry: %s; name does not match the file", name)
+	}
+	return &entry, nil
+}
+
+// write writes the entry to the file
+// If overwrite is false, it fails with ErrAlreadyExists when the file exists.
+func (ks *Keystore) write(entry *Entry, overwrite bool) error {
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to the temporary file, then rename it not to leave the broken file
+	tmp, err := os.CreateTemp(ks.Dir, ".tmp-"+entry.Metadata.Name+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write key; %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(FILE_MODE); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key; %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key; %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key; %w", err)
+	}
+
+	path := ks.path(entry.Metadata.Name)
+	if overwrite {
+		return os.Rename(tmp.Name(), path)
+	}
+	// link fails if the file exists
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, entry.Metadata.Name)
+		}
+		return fmt.Errorf("failed to write key; %w", err)
+	}
+	return nil
+}
+
+// Add encrypts and stores the private key with the name
+// The did is the DID associated with the key, and may be empty.
+func (ks *Keystore) Add(name string, key *didkey.DIDKey, purpose string, did string, passphrase string) (*Metadata, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if err := validatePurpose(purpose); err != nil {
+		return nil, err
+	}
+	if key.PrivateKey == nil {
+		return nil, fmt.Errorf("failed to add key; private key not found")
+	}
+
+	meta := &Metadata{
+		Name:      name,
+		Purpose:   purpose,
+		DID:       did,
+		PublicKey: key.DID(),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	entry, err := ks.encrypt(key, meta, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.write(entry, false); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Load decrypts the private key with the name
+func (ks *Keystore) Load(name string, passphrase string) (*didkey.DIDKey, error) {
+	entry, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(entry, passphrase)
+}
+
+// LoadWithPurpose decrypts the key with the name, and checks that the key is for the purpose
+// The purpose is checked on the same entry as decrypted, so it is authenticated with the key.
+func (ks *Keystore) LoadWithPurpose(name string, purpose string, passphrase string) (*didkey.DIDKey, error) {
+	entry, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decrypt(entry, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Metadata.Purpose != purpose {
+		return nil, fmt.Errorf("invalid purpose of key: %s; %s, want %s", name, entry.Metadata.Purpose, purpose)
+	}
+	return key, nil
+}
+
+// Metadata returns the metadata of the key with the name, without the passphrase
+func (ks *Keystore) Metadata(name string) (*Metadata, error) {
+	entry, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return &entry.Metadata, nil
+}
+
+// SetDID associates the DID with the key
+// The key is encrypted again, since the metadata is authenticated with the key.
+func (ks *Keystore) SetDID(name string, did string, passphrase string) error {
+	entry, err := ks.read(name)
+	if err != nil {
+		return err
+	}
+	key, err := decrypt(entry, passphrase)
+	if err != nil {
+		return err
+	}
+
+	meta := entry.Metadata
+	meta.DID = did
+	// keep the kdf of the entry
+	updated, err := (&Keystore{Dir: ks.Dir, KDF: entry.Crypto.KDF}).encrypt(key, &meta, passphrase)
+	if err != nil {
+		return err
+	}
+	return ks.write(updated, true)
+}
+
+// List returns the metadata of all keys sorted by name
+func (ks *Keystore) List() ([]Metadata, error) {
+	files, err := os.ReadDir(ks.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys; %w", err)
+	}
+
+	list := make([]Metadata, 0, len(files))
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), FILE_EXTENSION)
+		if !ok || f.IsDir() || validateName(name) != nil {
+			continue
+		}
+		entry, err := ks.read(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entry.Metadata)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Export decrypts the private key with the name, and returns it in PKCS#8 PEM
+// Use Load to export the key in the other formats of DIDKey.
+func (ks *Keystore) Export(name string, passphrase string) ([]byte, error) {
+	key, err := ks.Load(name, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return key.PKCS8PEM()
+}
+
+// Delete deletes the key with the name
+func (ks *Keystore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	err := os.Remove(ks.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
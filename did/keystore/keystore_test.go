@@ -0,0 +1,270 @@
+package keystore_test
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/did/keystore"
+	"go.yumnet.cloud/orangesea/did/plc"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+func newKeystore(t *testing.T) *keystore.Keystore {
+	t.Helper()
+
+	ks, err := keystore.New(filepath.Join(t.TempDir(), "keystore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestKeystore_AddLoad(t *testing.T) {
+	for _, kdf := range []string{keystore.KDF_SCRYPT, keystore.KDF_ARGON2ID} {
+		for _, curve := range []elliptic.Curve{elliptic.P256(), key.Secp256k1()} {
+			t.Run(kdf+" "+curve.Params().Name, func(t *testing.T) {
+				ks := newKeystore(t)
+				ks.KDF = kdf
+
+				k, err := key.GenerateDIDKey(curve)
+				if err != nil {
+					t.Fatal(err)
+				}
+				meta, err := ks.Add("rotation-1", k, keystore.PURPOSE_ROTATION, "", testPassphrase)
+				if err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+				if meta.PublicKey != k.DID() || meta.Purpose != keystore.PURPOSE_ROTATION || meta.CreatedAt.IsZero() {
+					t.Errorf("Add() = %+v", meta)
+				}
+
+				info, err := os.Stat(filepath.Join(ks.Dir, "rotation-1.json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != keystore.FILE_MODE {
+					t.Errorf("file mode = %o, want %o", info.Mode().Perm(), keystore.FILE_MODE)
+				}
+
+				got, err := ks.Load("rotation-1", testPassphrase)
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				if got.DID() != k.DID() || got.PrivateKey.D.Cmp(k.PrivateKey.D) != 0 {
+					t.Errorf("Load() = %v, want %v", got.DID(), k.DID())
+				}
+
+				if _, err := ks.Load("rotation-1", "wrong"); !errors.Is(err, keystore.ErrInvalidPassphrase) {
+					t.Errorf("Load() error = %v, want %v", err, keystore.ErrInvalidPassphrase)
+				}
+			})
+		}
+	}
+}
+
+func TestKeystore_Entry(t *testing.T) {
+	ks := newKeystore(t)
+
+	k, err := key.GenerateDIDKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Add("signing", k, keystore.PURPOSE_SIGNING, "", testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Add("signing", k, keystore.PURPOSE_SIGNING, "", testPassphrase); !errors.Is(err, keystore.ErrAlreadyExists) {
+		t.Errorf("Add() error = %v, want %v", err, keystore.ErrAlreadyExists)
+	}
+
+	path := filepath.Join(ks.Dir, "signing.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _ := k.PrivateKeyMultibase()
+	hexKey, _ := k.PrivateKeyHex()
+	for _, secret := range []string{privateKey, hexKey} {
+		if bytes.Contains(b, []byte(secret)) {
+			t.Errorf("entry contains the plaintext private key")
+		}
+	}
+
+	// the metadata is authenticated
+	var entry keystore.Entry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		t.Fatal(err)
+	}
+	entry.Metadata.Purpose = keystore.PURPOSE_ROTATION
+	modified, err := json.Marshal(&entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, modified, keystore.FILE_MODE); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Load("signing", testPassphrase); !errors.Is(err, keystore.ErrInvalidPassphrase) {
+		t.Errorf("Load() error = %v, want %v", err, keystore.ErrInvalidPassphrase)
+	}
+}
+
+func TestKeystore_Manage(t *testing.T) {
+	ks := newKeystore(t)
+	did := "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+	rotation, err := key.GenerateDIDKey(key.Secp256k1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := key.GenerateDIDKey(key.Secp256k1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Add("rotation", rotation, keystore.PURPOSE_ROTATION, "", testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Add("atproto", signing, keystore.PURPOSE_SIGNING, did, testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.SetDID("rotation", did, testPassphrase); err != nil {
+		t.Fatalf("SetDID() error = %v", err)
+	}
+	meta, err := ks.Metadata("rotation")
+	if err != nil {
+		t.Fatalf("Metadata() error = %v", err)
+	}
+	if meta.DID != did || meta.PublicKey != rotation.DID() {
+		t.Errorf("Metadata() = %+v", meta)
+	}
+
+	list, err := ks.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "atproto" || list[1].Name != "rotation" {
+		t.Errorf("List() = %+v", list)
+	}
+
+	exported, err := ks.Export("atproto", testPassphrase)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if got, err := key.ParseKey(exported, nil); err != nil || got.DID() != signing.DID() {
+		t.Errorf("Export() = %s, %v", exported, err)
+	}
+
+	d := plc.NewDIDPlc(did)
+	if err := d.LoadKeys(ks, testPassphrase, []string{"rotation"}, map[string]string{"atproto": "atproto"}); err != nil {
+		t.Fatalf("LoadKeys() error = %v", err)
+	}
+	if d.RotationKeys[0].DID() != rotation.DID() || d.VerificationMethods["atproto"].DID() != signing.DID() {
+		t.Errorf("LoadKeys() = %v, %v", d.RotationKeys, d.VerificationMethods)
+	}
+
+	// the keys must be used for their purposes
+	if err := d.LoadKeys(ks, testPassphrase, []string{"atproto"}, nil); err == nil {
+		t.Errorf("LoadKeys() with the signing key for rotation error = nil, wantErr true")
+	}
+	if err := d.LoadKeys(ks, testPassphrase, []string{"rotation"}, map[string]string{"atproto": "rotation"}); err == nil {
+		t.Errorf("LoadKeys() with the rotation key for signing error = nil, wantErr true")
+	}
+
+	if err := ks.Delete("atproto"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := ks.Load("atproto", testPassphrase); !errors.Is(err, keystore.ErrNotFound) {
+		t.Errorf("Load() error = %v, want %v", err, keystore.ErrNotFound)
+	}
+	if err := ks.Delete("atproto"); !errors.Is(err, keystore.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, keystore.ErrNotFound)
+	}
+}
+
+func TestKeystore_Add_Failure(t *testing.T) {
+	ks := newKeystore(t)
+
+	k, err := key.GenerateDIDKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := key.NewDIDKeyFromDID(k.DID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyName string
+		key     *key.DIDKey
+		purpose string
+	}{
+		{"failure case; path traversal", "../key", k, keystore.PURPOSE_SIGNING},
+		{"failure case; empty name", "", k, keystore.PURPOSE_SIGNING},
+		{"failure case; unknown purpose", "key", k, "encryption"},
+		{"failure case; public key", "key", public, keystore.PURPOSE_SIGNING},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ks.Add(tt.keyName, tt.key, tt.purpose, "", testPassphrase); err == nil {
+				t.Errorf("Add() error = nil, wantErr true")
+			}
+		})
+	}
+}
+
+func TestKeystore_Load_InvalidKDFParams(t *testing.T) {
+	ks := newKeystore(t)
+
+	k, err := key.GenerateDIDKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Add("signing", k, keystore.PURPOSE_SIGNING, "", testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(ks.Dir, "signing.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the crafted entries must be rejected before deriving the key, not to exhaust the memory
+	tests := []struct {
+		name   string
+		modify func(p *keystore.KDFParams)
+	}{
+		{"failure case; huge r", func(p *keystore.KDFParams) { p.R = 1 << 20 }},
+		{"failure case; huge p", func(p *keystore.KDFParams) { p.P = 1 << 20 }},
+		{"failure case; zero r", func(p *keystore.KDFParams) { p.R = 0 }},
+		{"failure case; n * r exceeds the memory limit", func(p *keystore.KDFParams) {
+			p.N, p.R = keystore.MAX_SCRYPT_N, keystore.MAX_SCRYPT_R
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry keystore.Entry
+			if err := json.Unmarshal(b, &entry); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&entry.Crypto.KDFParams)
+			modified, err := json.Marshal(&entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, modified, keystore.FILE_MODE); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := ks.Load("signing", testPassphrase); err == nil || errors.Is(err, keystore.ErrInvalidPassphrase) {
+				t.Errorf("Load() error = %v, want invalid parameters", err)
+			}
+		})
+	}
+}
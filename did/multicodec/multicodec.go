@@ -11,7 +11,10 @@ const (
 )
 
 const (
-	P256Pub = 0x1200
+	P256Pub       = 0x1200
+	Secp256k1Pub  = 0xe7
+	P256Priv      = 0x1306
+	Secp256k1Priv = 0x1301
 )
 
 func ParseMulticodec(multicodec []byte) (uint64, []byte, error) {
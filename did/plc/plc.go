@@ -22,6 +22,7 @@ import (
 	"github.com/ipld/go-ipld-prime/node/bindnode"
 	"github.com/ipld/go-ipld-prime/schema"
 	didkey "go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/did/keystore"
 )
 
 const (
@@ -188,6 +189,33 @@ func NewDIDPlc(did string) *DIDPlc {
 	}
 }
 
+// LoadKeys sets the rotation keys and the verification methods to the keys in the keystore by name
+// The verificationMethods maps the ids of the verification methods (e.g. "atproto") to the names of the keys.
+// The keys must have been added for the purposes, rotation or signing.
+func (d *DIDPlc) LoadKeys(ks *keystore.Keystore, passphrase string, rotationKeys []string, verificationMethods map[string]string) error {
+	keys := make([]*didkey.DIDKey, len(rotationKeys))
+	for i, name := range rotationKeys {
+		key, err := ks.LoadWithPurpose(name, keystore.PURPOSE_ROTATION, passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to load rotation key: %s; %w", name, err)
+		}
+		keys[i] = key
+	}
+
+	methods := make(map[string]*didkey.DIDKey, len(verificationMethods))
+	for id, name := range verificationMethods {
+		key, err := ks.LoadWithPurpose(name, keystore.PURPOSE_SIGNING, passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to load verification method key: %s; %w", name, err)
+		}
+		methods[id] = key
+	}
+
+	d.RotationKeys = keys
+	d.VerificationMethods = methods
+	return nil
+}
+
 func (d *DIDPlc) unsignedOperation() (*OperationObject, error) {
 	if len(d.RotationKeys) < 1 {
 		return nil, fmt.Errorf("rotationKeys must be at least 1")
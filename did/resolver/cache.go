@@ -0,0 +1,153 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_CACHE_TTL         = 10 * time.Minute
+	DEFAULT_REFRESH_INTERVAL  = time.Minute
+	DEFAULT_CACHE_MAX_ENTRIES = 100000
+)
+
+type cachedDocument struct {
+	did         string
+	doc         *Document
+	expiresAt   time.Time
+	refreshedAt time.Time // the time of the last forced refresh
+}
+
+// CachedResolver caches the documents resolved by Resolver for TTL
+// Refresh resolves the document bypassing the cache at most once per RefreshInterval for each DID,
+// so that invalid signatures cannot make it hit the directory on every request.
+// The least recently used documents are evicted when the cache has MaxEntries documents.
+// CachedResolver is safe for concurrent use.
+type CachedResolver struct {
+	Resolver        DIDResolver
+	TTL             time.Duration
+	RefreshInterval time.Duration
+	MaxEntries      int // zero for no limit
+
+	// Now returns the current time; nil for time.Now
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *cachedDocument
+	lru     list.List                // the front is the most recently used
+}
+
+var _ DIDResolver = (*CachedResolver)(nil)
+
+// NewCachedResolver returns a new CachedResolver in front of the resolver
+func NewCachedResolver(r DIDResolver) *CachedResolver {
+	return &CachedResolver{
+		Resolver:        r,
+		TTL:             DEFAULT_CACHE_TTL,
+		RefreshInterval: DEFAULT_REFRESH_INTERVAL,
+		MaxEntries:      DEFAULT_CACHE_MAX_ENTRIES,
+	}
+}
+
+func (r *CachedResolver) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// get returns the cached document, and marks it as recently used
+// r.mu must be held.
+func (r *CachedResolver) get(did string) *cachedDocument {
+	e, ok := r.entries[did]
+	if !ok {
+		return nil
+	}
+	r.lru.MoveToFront(e)
+	return e.Value.(*cachedDocument)
+}
+
+// put caches the document, and evicts the least recently used documents over MaxEntries
+// r.mu must be held.
+func (r *CachedResolver) put(c *cachedDocument) {
+	if r.entries == nil {
+		r.entries = make(map[string]*list.Element)
+	}
+	if e, ok := r.entries[c.did]; ok {
+		e.Value = c
+		r.lru.MoveToFront(e)
+		return
+	}
+
+	r.entries[c.did] = r.lru.PushFront(c)
+	for r.MaxEntries > 0 && r.lru.Len() > r.MaxEntries {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cachedDocument).did)
+	}
+}
+
+// Resolve returns the cached document, or resolves the DID if it is not cached or expired
+func (r *CachedResolver) Resolve(ctx context.Context, did string) (*Document, error) {
+	r.mu.Lock()
+	c := r.get(did)
+	if c != nil && r.now().Before(c.expiresAt) {
+		r.mu.Unlock()
+		return c.doc, nil
+	}
+	r.mu.Unlock()
+
+	return r.resolve(ctx, did, false)
+}
+
+// Refresh resolves the DID bypassing the cache, e.g. when the signing key may have been rotated
+// If the DID has been resolved within RefreshInterval, the cached document is returned.
+func (r *CachedResolver) Refresh(ctx context.Context, did string) (*Document, error) {
+	r.mu.Lock()
+	if c := r.get(did); c != nil {
+		if r.now().Sub(c.refreshedAt) < r.RefreshInterval {
+			r.mu.Unlock()
+			return c.doc, nil
+		}
+		// claim the refresh before resolving, so that concurrent refreshes use the cached document
+		claimed := *c
+		claimed.refreshedAt = r.now()
+		r.put(&claimed)
+	}
+	r.mu.Unlock()
+
+	return r.resolve(ctx, did, true)
+}
+
+// Invalidate removes the document from the cache, e.g. on an #identity event of the DID
+func (r *CachedResolver) Invalidate(did string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entries[did]; ok {
+		r.lru.Remove(e)
+		delete(r.entries, did)
+	}
+}
+
+func (r *CachedResolver) resolve(ctx context.Context, did string, forced bool) (*Document, error) {
+	doc, err := r.Resolver.Resolve(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.now()
+	c := &cachedDocument{did: did, doc: doc, expiresAt: t.Add(r.TTL)}
+	if forced {
+		c.refreshedAt = t
+	} else if prev := r.get(did); prev != nil {
+		c.refreshedAt = prev.refreshedAt
+	}
+	r.put(c)
+	return doc, nil
+}
@@ -0,0 +1,82 @@
+package resolver_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.yumnet.cloud/orangesea/did/resolver"
+)
+
+// countingDIDs resolves any DID, and counts the resolutions of each DID
+type countingDIDs map[string]int
+
+func (d countingDIDs) Resolve(ctx context.Context, did string) (*resolver.Document, error) {
+	d[did]++
+	doc := testDocument(did)
+	doc.AlsoKnownAs = []string{fmt.Sprintf("at://v%d.example.com", d[did])}
+	return doc, nil
+}
+
+func TestCachedResolver(t *testing.T) {
+	did := "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+	dids := countingDIDs{}
+
+	now := time.Unix(1700000000, 0)
+	r := resolver.NewCachedResolver(dids)
+	r.Now = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		resolve  func(ctx context.Context, did string) (*resolver.Document, error)
+		want     string
+		resolved int
+	}{
+		{"successfull case; resolved", 0, r.Resolve, "v1.example.com", 1},
+		{"successfull case; cached", time.Second, r.Resolve, "v1.example.com", 1},
+		{"successfull case; first refresh", 0, r.Refresh, "v2.example.com", 2},
+		{"successfull case; refresh within the interval uses the cache", time.Second, r.Refresh, "v2.example.com", 2},
+		{"successfull case; refresh after the interval", resolver.DEFAULT_REFRESH_INTERVAL, r.Refresh, "v3.example.com", 3},
+		{"successfull case; expired", resolver.DEFAULT_CACHE_TTL, r.Resolve, "v4.example.com", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+
+			doc, err := tt.resolve(context.Background(), did)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if doc.Handle() != tt.want || dids[did] != tt.resolved {
+				t.Errorf("Resolve() = %v, resolved %d, want %v, resolved %d", doc.Handle(), dids[did], tt.want, tt.resolved)
+			}
+		})
+	}
+
+	// invalidated documents are resolved again
+	r.Invalidate(did)
+	if doc, err := r.Resolve(context.Background(), did); err != nil || doc.Handle() != "v5.example.com" {
+		t.Errorf("Resolve() after Invalidate() = %v, %v, want v5.example.com", doc, err)
+	}
+}
+
+func TestCachedResolver_MaxEntries(t *testing.T) {
+	dids := countingDIDs{}
+	r := resolver.NewCachedResolver(dids)
+	r.MaxEntries = 2
+
+	ctx := context.Background()
+	for _, did := range []string{"did:plc:a", "did:plc:b", "did:plc:a", "did:plc:c", "did:plc:a", "did:plc:b"} {
+		if _, err := r.Resolve(ctx, did); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b is the least recently used when c is added
+	want := countingDIDs{"did:plc:a": 1, "did:plc:b": 2, "did:plc:c": 1}
+	if fmt.Sprint(dids) != fmt.Sprint(want) {
+		t.Errorf("resolved = %v, want %v", dids, want)
+	}
+}
@@ -0,0 +1,206 @@
+// the package resolver resolves DIDs (did:plc and did:web) into DID documents
+
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/did/plc"
+)
+
+const (
+	ATPROTO_VERIFICATION_METHOD = "#atproto"
+	ATPROTO_PDS_SERVICE         = "#atproto_pds"
+	ATPROTO_PDS_SERVICE_TYPE    = "AtprotoPersonalDataServer"
+)
+
+// the hostname with an optional port, the only form of did:web supported by atproto
+var webHostRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*(:[0-9]{1,5})?$`)
+
+type VerificationMethod struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase,omitempty"`
+}
+
+type Service struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+// Document is a DID document
+// Only the properties used by atproto are supported.
+type Document struct {
+	Context            json.RawMessage      `json:"@context,omitempty"`
+	ID                 string               `json:"id"`
+	AlsoKnownAs        []string             `json:"alsoKnownAs,omitempty"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod,omitempty"`
+	Service            []Service            `json:"service,omitempty"`
+}
+
+// matchID returns true if the id is the fragment of the document (e.g. "#atproto")
+// or the fully qualified id of the fragment (e.g. "did:plc:xxx#atproto")
+func (doc *Document) matchID(id string, fragment string) bool {
+	return id == fragment || id == doc.ID+fragment
+}
+
+// VerificationMethodByID returns the verification method with the fragment (e.g. "#atproto")
+func (doc *Document) VerificationMethodByID(fragment string) (*VerificationMethod, error) {
+	for i, vm := range doc.VerificationMethod {
+		if doc.matchID(vm.ID, fragment) {
+			return &doc.VerificationMethod[i], nil
+		}
+	}
+	return nil, fmt.Errorf("verification method not found: %s", fragment)
+}
+
+// ServiceByID returns the service with the fragment (e.g. "#atproto_pds")
+func (doc *Document) ServiceByID(fragment string) (*Service, error) {
+	for i, svc := range doc.Service {
+		if doc.matchID(svc.ID, fragment) {
+			return &doc.Service[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service not found: %s", fragment)
+}
+
+// SigningKey returns the atproto signing key of the DID
+// Multikey and the legacy EcdsaSecp256r1VerificationKey2019 and EcdsaSecp256k1VerificationKey2019 are supported.
+func (doc *Document) SigningKey() (*didkey.DIDKey, error) {
+	vm, err := doc.VerificationMethodByID(ATPROTO_VERIFICATION_METHOD)
+	if err != nil {
+		return nil, err
+	}
+	if vm.PublicKeyMultibase == "" {
+		return nil, fmt.Errorf("invalid verification method: %s; publicKeyMultibase is empty", vm.ID)
+	}
+
+	key, err := didkey.NewDIDKeyFromVerificationMethod(vm.Type, vm.PublicKeyMultibase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification method: %s; %w", vm.ID, err)
+	}
+	return key, nil
+}
+
+// PDSEndpoint returns the endpoint of the atproto PDS of the DID
+func (doc *Document) PDSEndpoint() (string, error) {
+	svc, err := doc.ServiceByID(ATPROTO_PDS_SERVICE)
+	if err != nil {
+		return "", err
+	}
+	if svc.Type != ATPROTO_PDS_SERVICE_TYPE {
+		return "", fmt.Errorf("invalid service: %s; type must be %s", svc.ID, ATPROTO_PDS_SERVICE_TYPE)
+	}
+
+	u, err := url.Parse(svc.ServiceEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid service endpoint: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid service endpoint: %s; scheme must be http or https", svc.ServiceEndpoint)
+	}
+
+	return strings.TrimSuffix(svc.ServiceEndpoint, "/"), nil
+}
+
+// Handle returns the handle of the DID from alsoKnownAs
+// If no handle is found, it returns empty string
+func (doc *Document) Handle() string {
+	for _, aka := range doc.AlsoKnownAs {
+		if handle, ok := strings.CutPrefix(aka, "at://"); ok {
+			return handle
+		}
+	}
+	return ""
+}
+
+// DIDResolver resolves DIDs into DID documents
+// *Resolver satisfies this interface.
+type DIDResolver interface {
+	Resolve(ctx context.Context, did string) (*Document, error)
+}
+
+var _ DIDResolver = (*Resolver)(nil)
+
+// Resolver resolves did:plc with the PLC directory and did:web with HTTPS
+type Resolver struct {
+	PLCDirectory string
+	Client       *http.Client
+}
+
+// NewResolver returns a new Resolver with the default PLC directory and HTTP client
+func NewResolver() *Resolver {
+	return &Resolver{
+		PLCDirectory: plc.PLC_DIRECTORY_BASEURL,
+		Client:       http.DefaultClient,
+	}
+}
+
+// Resolve resolves the DID into the DID document
+func (r *Resolver) Resolve(ctx context.Context, did string) (*Document, error) {
+	var docURL string
+
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		docURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(r.PLCDirectory, "/"), did)
+	case strings.HasPrefix(did, "did:web:"):
+		id := strings.TrimPrefix(did, "did:web:")
+		// atproto only supports hostname-level did:web (with an optional port),
+		// so path segments separated by ":" are not allowed
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid did:web: %s; path is not supported", did)
+		}
+		host, err := url.PathUnescape(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid did:web: %s; %w", did, err)
+		}
+		// the escaped characters must not inject the path, query or userinfo into the URL
+		if !webHostRegex.MatchString(host) {
+			return nil, fmt.Errorf("invalid did:web: %s; must be a hostname with an optional port", did)
+		}
+		docURL = fmt.Sprintf("https://%s/.well-known/did.json", host)
+	default:
+		return nil, fmt.Errorf("unsupported DID method: %s", did)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, docURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve DID: %s; %w", did, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"failed to resolve DID: %s; status code: %d", did, resp.StatusCode,
+		)
+	}
+
+	var doc Document
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to resolve DID: %s; %w", did, err)
+	}
+	if doc.ID != did {
+		return nil, fmt.Errorf("failed to resolve DID: %s; document id mismatch: %s", did, doc.ID)
+	}
+
+	return &doc, nil
+}
@@ -0,0 +1,176 @@
+package resolver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/did/resolver"
+)
+
+const testSigningKey = "zDnaecyEypFVtV9dKXhuvyLGviX369L2dqSMUEcgVZSBt2t9L"
+
+func testDocument(did string) *resolver.Document {
+	return &resolver.Document{
+		ID:          did,
+		AlsoKnownAs: []string{"at://alice.example.com"},
+		VerificationMethod: []resolver.VerificationMethod{
+			{
+				ID:                 did + "#atproto",
+				Type:               "Multikey",
+				Controller:         did,
+				PublicKeyMultibase: testSigningKey,
+			},
+		},
+		Service: []resolver.Service{
+			{
+				ID:              "#atproto_pds",
+				Type:            "AtprotoPersonalDataServer",
+				ServiceEndpoint: "https://pds.example.com/",
+			},
+		},
+	}
+}
+
+func TestResolver_Resolve_PLC(t *testing.T) {
+	did := "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+did {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(testDocument(did))
+	}))
+	defer srv.Close()
+
+	r := &resolver.Resolver{PLCDirectory: srv.URL, Client: srv.Client()}
+
+	doc, err := r.Resolve(context.Background(), did)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if got := doc.Handle(); got != "alice.example.com" {
+		t.Errorf("Handle() = %v, want %v", got, "alice.example.com")
+	}
+
+	endpoint, err := doc.PDSEndpoint()
+	if err != nil {
+		t.Fatalf("PDSEndpoint() error = %v", err)
+	}
+	if endpoint != "https://pds.example.com" {
+		t.Errorf("PDSEndpoint() = %v, want %v", endpoint, "https://pds.example.com")
+	}
+
+	key, err := doc.SigningKey()
+	if err != nil {
+		t.Fatalf("SigningKey() error = %v", err)
+	}
+	if got := key.DID(); got != "did:key:"+testSigningKey {
+		t.Errorf("SigningKey() = %v, want %v", got, "did:key:"+testSigningKey)
+	}
+
+	if _, err := r.Resolve(context.Background(), "did:plc:notfound"); err == nil {
+		t.Errorf("Resolve() error = nil, wantErr true")
+	}
+}
+
+func TestResolver_Resolve_Web(t *testing.T) {
+	var did string
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/did.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(testDocument(did))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	did = "did:web:" + strings.ReplaceAll(u.Host, ":", "%3A")
+
+	r := &resolver.Resolver{Client: srv.Client()}
+
+	doc, err := r.Resolve(context.Background(), did)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if doc.ID != did {
+		t.Errorf("Resolve().ID = %v, want %v", doc.ID, did)
+	}
+
+	for _, invalid := range []string{
+		"did:web:",
+		"did:web:example.com:path",
+		"did:web:evil.com%2Fx%3F",
+		"did:web:evil.com%23x",
+		"did:web:user%40evil.com",
+		"did:web:evil.com%3Ax%2F",
+		"did:example:123",
+	} {
+		if _, err := r.Resolve(context.Background(), invalid); err == nil {
+			t.Errorf("Resolve(%v) error = nil, wantErr true", invalid)
+		}
+	}
+}
+
+func TestDocument_SigningKey(t *testing.T) {
+	did := "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+	tests := []struct {
+		name      string
+		typ       string
+		multibase string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "successfull case; Multikey",
+			typ:       "Multikey",
+			multibase: testSigningKey,
+			want:      "did:key:" + testSigningKey,
+		},
+		{
+			name:      "successfull case; EcdsaSecp256r1VerificationKey2019",
+			typ:       "EcdsaSecp256r1VerificationKey2019",
+			multibase: "zxdM8dSstjrpZaRUwBmDvjGXweKuEMVN95A9oJBFjkWMh",
+			want:      "did:key:zDnaembgSGUhZULN2Caob4HLJPaxBh92N7rtH21TErzqf8HQo",
+		},
+		{
+			name:      "successfull case; EcdsaSecp256k1VerificationKey2019",
+			typ:       "EcdsaSecp256k1VerificationKey2019",
+			multibase: "z25z9DTpsiYYJKGsWmSPJK2NFN8PcJtZig12K59UgW7q5t",
+			want:      "did:key:zQ3shqwJEJyMBsBXCWyCBpUBMqxcon9oHB7mCvx4sSpMdLJwc",
+		},
+		{
+			name:      "failure case; unknown type",
+			typ:       "Ed25519VerificationKey2020",
+			multibase: testSigningKey,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := testDocument(did)
+			doc.VerificationMethod[0].Type = tt.typ
+			doc.VerificationMethod[0].PublicKeyMultibase = tt.multibase
+
+			key, err := doc.SigningKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SigningKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && key.DID() != tt.want {
+				t.Errorf("SigningKey() = %v, want %v", key.DID(), tt.want)
+			}
+		})
+	}
+}
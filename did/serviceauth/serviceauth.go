@@ -0,0 +1,261 @@
+// the package serviceauth mints and verifies the inter-service authentication JWTs of atproto
+// https://atproto.com/specs/xrpc#inter-service-authentication-jwt
+
+package serviceauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/did/resolver"
+)
+
+const (
+	ALG_ES256  = "ES256"  // P-256
+	ALG_ES256K = "ES256K" // secp256k1
+
+	DEFAULT_EXPIRATION = 60 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Header is the JOSE header of the token
+type Header struct {
+	Type      string `json:"typ,omitempty"`
+	Algorithm string `json:"alg"`
+}
+
+// Claims is the claims of the token
+type Claims struct {
+	Issuer    string `json:"iss"`           // the DID of the account, optionally with the service fragment
+	Audience  string `json:"aud"`           // the DID of the service
+	ExpiresAt int64  `json:"exp"`           // unix seconds
+	IssuedAt  int64  `json:"iat,omitempty"` // unix seconds
+	Method    string `json:"lxm,omitempty"` // the NSID of the XRPC method bound to the token
+	Nonce     string `json:"jti,omitempty"`
+}
+
+// IssuerDID returns the DID of the issuer without the service fragment
+func (c *Claims) IssuerDID() string {
+	did, _, _ := strings.Cut(c.Issuer, "#")
+	return did
+}
+
+// Algorithm returns the JWT algorithm of the key
+func Algorithm(key *didkey.DIDKey) string {
+	if key.CurveName() == didkey.SECP256K1 {
+		return ALG_ES256K
+	}
+	return ALG_ES256
+}
+
+// Sign signs the claims with the key and returns the token
+func Sign(key *didkey.DIDKey, claims *Claims) (string, error) {
+	header, err := json.Marshal(&Header{Type: "JWT", Algorithm: Algorithm(key)})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	sig, err := key.Sign(sha256.Sum256([]byte(signingInput)))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token; %w", err)
+	}
+	return signingInput + "." + encoding.EncodeToString(sig), nil
+}
+
+// NewToken mints the token of the issuer for the audience and the method
+// The method may be empty to mint the token not bound to a method.
+// If exp is zero, DEFAULT_EXPIRATION is used.
+func NewToken(key *didkey.DIDKey, iss string, aud string, method string, exp time.Duration) (string, error) {
+	if exp == 0 {
+		exp = DEFAULT_EXPIRATION
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return Sign(key, &Claims{
+		Issuer:    iss,
+		Audience:  aud,
+		ExpiresAt: now.Add(exp).Unix(),
+		IssuedAt:  now.Unix(),
+		Method:    method,
+		Nonce:     hex.EncodeToString(nonce),
+	})
+}
+
+// token is the parsed token before the signature is verified
+type token struct {
+	header       Header
+	claims       Claims
+	signingInput string
+	signature    []byte
+}
+
+func parse(s string) (*token, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: must have 3 parts", ErrInvalidToken)
+	}
+
+	var t token
+	for i, v := range []interface{}{&t.header, &t.claims} {
+		b, err := encoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+	}
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	t.signingInput = parts[0] + "." + parts[1]
+	t.signature = sig
+	return &t, nil
+}
+
+// verify verifies the signature of the token with the key
+func (t *token) verify(key *didkey.DIDKey) bool {
+	if t.header.Algorithm != Algorithm(key) {
+		return false
+	}
+	return key.Verify(sha256.Sum256([]byte(t.signingInput)), t.signature)
+}
+
+// KeyResolver resolves the atproto signing key of the DID
+// If refresh is true, the key must be resolved again instead of from the cache.
+type KeyResolver interface {
+	SigningKey(ctx context.Context, did string, refresh bool) (*didkey.DIDKey, error)
+}
+
+// Verifier verifies the tokens sent to the service
+type Verifier struct {
+	Audience string // the DID of the service
+	Keys     KeyResolver
+
+	// Now returns the current time; nil for time.Now
+	Now func() time.Time
+}
+
+// NewVerifier returns a new Verifier of the service
+func NewVerifier(audience string, keys KeyResolver) *Verifier {
+	return &Verifier{
+		Audience: audience,
+		Keys:     keys,
+	}
+}
+
+// Verify verifies the token for the method and returns its claims
+// If the method is not empty, the token must be bound to the method.
+// If the signature does not match, the signing key is resolved again once
+// in case the key of the issuer has been rotated.
+func (v *Verifier) Verify(ctx context.Context, s string, method string) (*Claims, error) {
+	t, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.header.Type {
+	case "", "JWT":
+	default:
+		return nil, fmt.Errorf("%w: unexpected type: %s", ErrInvalidToken, t.header.Type)
+	}
+	if t.header.Algorithm != ALG_ES256 && t.header.Algorithm != ALG_ES256K {
+		return nil, fmt.Errorf("%w: algorithm not supported: %s", ErrInvalidToken, t.header.Algorithm)
+	}
+
+	claims := &t.claims
+	if !strings.HasPrefix(claims.Issuer, "did:") {
+		return nil, fmt.Errorf("%w: issuer must be a DID: %s", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.Audience != v.Audience {
+		return nil, fmt.Errorf("%w: audience mismatch: %s", ErrInvalidToken, claims.Audience)
+	}
+	if method != "" && claims.Method != method {
+		return nil, fmt.Errorf("%w: method mismatch: %s", ErrInvalidToken, claims.Method)
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("%w: exp is missing", ErrInvalidToken)
+	}
+	if now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	key, err := v.Keys.SigningKey(ctx, claims.IssuerDID(), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve signing key: %s; %w", claims.IssuerDID(), err)
+	}
+	if t.verify(key) {
+		return claims, nil
+	}
+
+	// the key may have been rotated
+	refreshed, err := v.Keys.SigningKey(ctx, claims.IssuerDID(), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve signing key: %s; %w", claims.IssuerDID(), err)
+	}
+	if refreshed.DID() != key.DID() && t.verify(refreshed) {
+		return claims, nil
+	}
+	return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+// DocumentKeyResolver resolves the signing keys from the DID documents cached by Documents
+// A forced refresh resolves the document at most once per RefreshInterval of Documents for each DID,
+// so that invalid tokens cannot make the resolver hit the directory on every request.
+type DocumentKeyResolver struct {
+	Documents *resolver.CachedResolver
+}
+
+var _ KeyResolver = (*DocumentKeyResolver)(nil)
+
+// NewDocumentKeyResolver returns a new DocumentKeyResolver caching the documents resolved by the resolver
+func NewDocumentKeyResolver(r resolver.DIDResolver) *DocumentKeyResolver {
+	return &DocumentKeyResolver{
+		Documents: resolver.NewCachedResolver(r),
+	}
+}
+
+func (r *DocumentKeyResolver) SigningKey(ctx context.Context, did string, refresh bool) (*didkey.DIDKey, error) {
+	resolve := r.Documents.Resolve
+	if refresh {
+		resolve = r.Documents.Refresh
+	}
+
+	doc, err := resolve(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	return doc.SigningKey()
+}
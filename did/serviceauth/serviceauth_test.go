@@ -0,0 +1,247 @@
+package serviceauth_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/did/resolver"
+	"go.yumnet.cloud/orangesea/did/serviceauth"
+)
+
+const (
+	testIssuer   = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+	testAudience = "did:web:api.example.com"
+	testMethod   = "com.example.feed.getTimeline"
+)
+
+// staticKeys resolves the keys in order; the last key is returned after the others
+type staticKeys struct {
+	keys      []*didkey.DIDKey
+	refreshed int
+}
+
+func (s *staticKeys) SigningKey(ctx context.Context, did string, refresh bool) (*didkey.DIDKey, error) {
+	if did != testIssuer {
+		return nil, errors.New("unknown DID")
+	}
+	if refresh && s.refreshed < len(s.keys)-1 {
+		s.refreshed++
+	}
+	return s.keys[s.refreshed], nil
+}
+
+func generateKey(t *testing.T, curve elliptic.Curve) *didkey.DIDKey {
+	t.Helper()
+
+	key, err := didkey.GenerateDIDKey(curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), didkey.Secp256k1()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			key := generateKey(t, curve)
+			v := serviceauth.NewVerifier(testAudience, &staticKeys{keys: []*didkey.DIDKey{key}})
+
+			token, err := serviceauth.NewToken(key, testIssuer+"#atproto_labeler", testAudience, testMethod, 0)
+			if err != nil {
+				t.Fatalf("NewToken() error = %v", err)
+			}
+
+			claims, err := v.Verify(context.Background(), token, testMethod)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.IssuerDID() != testIssuer || claims.Method != testMethod || claims.Nonce == "" {
+				t.Errorf("Verify() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifier_Verify_Failure(t *testing.T) {
+	key := generateKey(t, elliptic.P256())
+	other := generateKey(t, didkey.Secp256k1())
+	now := time.Now()
+
+	sign := func(k *didkey.DIDKey, c serviceauth.Claims) string {
+		token, err := serviceauth.Sign(k, &c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := serviceauth.Claims{Issuer: testIssuer, Audience: testAudience, ExpiresAt: now.Add(time.Minute).Unix(), Method: testMethod}
+
+	expired := valid
+	expired.ExpiresAt = now.Add(-time.Second).Unix()
+	noExp := valid
+	noExp.ExpiresAt = 0
+	wrongAudience := valid
+	wrongAudience.Audience = "did:web:other.example.com"
+	wrongMethod := valid
+	wrongMethod.Method = "com.example.repo.createRecord"
+	noMethod := valid
+	noMethod.Method = ""
+	notDID := valid
+	notDID.Issuer = "alice.example.com"
+
+	tampered := sign(key, valid)
+	payload, _ := json.Marshal(&serviceauth.Claims{Issuer: testIssuer, Audience: testAudience, ExpiresAt: now.Add(time.Hour).Unix(), Method: testMethod})
+	parts := strings.Split(tampered, ".")
+	tampered = parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"failure case; expired", sign(key, expired), serviceauth.ErrExpiredToken},
+		{"failure case; no exp", sign(key, noExp), serviceauth.ErrInvalidToken},
+		{"failure case; audience mismatch", sign(key, wrongAudience), serviceauth.ErrInvalidToken},
+		{"failure case; method mismatch", sign(key, wrongMethod), serviceauth.ErrInvalidToken},
+		{"failure case; method missing", sign(key, noMethod), serviceauth.ErrInvalidToken},
+		{"failure case; issuer is not a DID", sign(key, notDID), serviceauth.ErrInvalidToken},
+		{"failure case; signed by other key", sign(other, valid), serviceauth.ErrInvalidToken},
+		{"failure case; tampered", tampered, serviceauth.ErrInvalidToken},
+		{"failure case; malformed", "a.b", serviceauth.ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := serviceauth.NewVerifier(testAudience, &staticKeys{keys: []*didkey.DIDKey{key}})
+			if _, err := v.Verify(context.Background(), tt.token, testMethod); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifier_Verify_Rotation(t *testing.T) {
+	oldKey := generateKey(t, elliptic.P256())
+	newKey := generateKey(t, didkey.Secp256k1())
+
+	keys := &staticKeys{keys: []*didkey.DIDKey{oldKey, newKey}}
+	v := serviceauth.NewVerifier(testAudience, keys)
+
+	token, err := serviceauth.NewToken(newKey, testIssuer, testAudience, testMethod, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(context.Background(), token, testMethod); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if keys.refreshed != 1 {
+		t.Errorf("refreshed = %d, want 1", keys.refreshed)
+	}
+}
+
+func TestDocumentKeyResolver(t *testing.T) {
+	key := generateKey(t, didkey.Secp256k1())
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(&resolver.Document{
+			ID: testIssuer,
+			VerificationMethod: []resolver.VerificationMethod{{
+				ID:                 testIssuer + "#atproto",
+				Type:               "Multikey",
+				Controller:         testIssuer,
+				PublicKeyMultibase: strings.TrimPrefix(key.DID(), "did:key:"),
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	keys := serviceauth.NewDocumentKeyResolver(&resolver.Resolver{PLCDirectory: srv.URL, Client: srv.Client()})
+	v := serviceauth.NewVerifier(testAudience, keys)
+
+	token, err := serviceauth.NewToken(key, testIssuer, testAudience, testMethod, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := v.Verify(context.Background(), token, testMethod); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1; the key must be cached", requests)
+	}
+}
+
+// rotatingDIDs resolves the documents with the keys in order; the last key is returned after the others
+type rotatingDIDs struct {
+	keys     []*didkey.DIDKey
+	resolved int
+}
+
+func (d *rotatingDIDs) Resolve(ctx context.Context, did string) (*resolver.Document, error) {
+	key := d.keys[len(d.keys)-1]
+	if d.resolved < len(d.keys) {
+		key = d.keys[d.resolved]
+	}
+	d.resolved++
+
+	return &resolver.Document{
+		ID: did,
+		VerificationMethod: []resolver.VerificationMethod{{
+			ID:                 did + "#atproto",
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: strings.TrimPrefix(key.DID(), "did:key:"),
+		}},
+	}, nil
+}
+
+func TestDocumentKeyResolver_Refresh(t *testing.T) {
+	old := generateKey(t, didkey.Secp256k1())
+	rotated := generateKey(t, didkey.Secp256k1())
+	dids := &rotatingDIDs{keys: []*didkey.DIDKey{old, rotated}}
+
+	now := time.Unix(1700000000, 0)
+	keys := serviceauth.NewDocumentKeyResolver(dids)
+	keys.Documents.Now = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		refresh  bool
+		want     *didkey.DIDKey
+		resolved int
+	}{
+		{"successfull case; resolved", 0, false, old, 1},
+		{"successfull case; cached", time.Second, false, old, 1},
+		{"successfull case; first refresh", 0, true, rotated, 2},
+		{"successfull case; refresh within the interval uses the cache", time.Second, true, rotated, 2},
+		{"successfull case; refresh after the interval", resolver.DEFAULT_REFRESH_INTERVAL, true, rotated, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+
+			got, err := keys.SigningKey(context.Background(), testIssuer, tt.refresh)
+			if err != nil {
+				t.Fatalf("SigningKey() error = %v", err)
+			}
+			if got.DID() != tt.want.DID() {
+				t.Errorf("SigningKey() = %v, want %v", got.DID(), tt.want.DID())
+			}
+			if dids.resolved != tt.resolved {
+				t.Errorf("resolved = %d, want %d", dids.resolved, tt.resolved)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// the package blockstore provides storages of content-addressed blocks
+
+package blockstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/car"
+)
+
+var ErrNotFound = errors.New("block not found")
+
+// Blockstore is a storage of content-addressed blocks
+// The callers are responsible for the data matching its CID.
+// Put must not retain the data after it returns, as the callers may reuse it, e.g. ImportCAR.
+type Blockstore interface {
+	Get(c cid.Cid) ([]byte, error)
+	Put(c cid.Cid, data []byte) error
+	Has(c cid.Cid) (bool, error)
+	Delete(c cid.Cid) error
+	AllKeys() ([]cid.Cid, error)
+}
+
+// MemBlockstore is an in-memory Blockstore
+// MemBlockstore is safe for concurrent use.
+type MemBlockstore struct {
+	mu     sync.RWMutex
+	blocks map[cid.Cid][]byte
+}
+
+// NewMemBlockstore returns a new empty MemBlockstore
+func NewMemBlockstore() *MemBlockstore {
+	return &MemBlockstore{
+		blocks: make(map[cid.Cid][]byte),
+	}
+}
+
+// Get returns the data of the block
+// If the block is not found, it returns ErrNotFound
+func (bs *MemBlockstore) Get(c cid.Cid) ([]byte, error) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	data, ok := bs.blocks[c]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, c)
+	}
+	return data, nil
+}
+
+// Put stores the block
+func (bs *MemBlockstore) Put(c cid.Cid, data []byte) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.blocks[c] = append([]byte{}, data...)
+	return nil
+}
+
+// Has returns true if the block is stored
+func (bs *MemBlockstore) Has(c cid.Cid) (bool, error) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	_, ok := bs.blocks[c]
+	return ok, nil
+}
+
+// Delete removes the block
+// Deleting a block which is not stored is not an error.
+func (bs *MemBlockstore) Delete(c cid.Cid) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	delete(bs.blocks, c)
+	return nil
+}
+
+// AllKeys returns the CIDs of all stored blocks
+func (bs *MemBlockstore) AllKeys() ([]cid.Cid, error) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	keys := make([]cid.Cid, 0, len(bs.blocks))
+	for c := range bs.blocks {
+		keys = append(keys, c)
+	}
+	sortCids(keys)
+
+	return keys, nil
+}
+
+func sortCids(cids []cid.Cid) {
+	sort.Slice(cids, func(i, j int) bool {
+		return cids[i].KeyString() < cids[j].KeyString()
+	})
+}
+
+// ImportCAR reads all blocks in the CAR stream into the Blockstore,
+// and returns the roots of the CAR
+// The buffer of the block data is reused for the next block after Put.
+func ImportCAR(bs Blockstore, r io.Reader) ([]cid.Cid, error) {
+	reader, err := car.NewReader(r, &car.Options{ReuseBuffer: true})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		block, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := bs.Put(block.CID, block.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return reader.Roots(), nil
+}
+
+// ExportCAR writes all blocks in the Blockstore into the CAR stream with the roots
+func ExportCAR(bs Blockstore, w io.Writer, roots []cid.Cid) error {
+	writer, err := car.NewWriter(w, roots)
+	if err != nil {
+		return err
+	}
+
+	keys, err := bs.AllKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range keys {
+		data, err := bs.Get(c)
+		if err != nil {
+			return err
+		}
+		if err := writer.WriteBlock(c, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
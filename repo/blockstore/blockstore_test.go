@@ -0,0 +1,195 @@
+package blockstore_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/data"
+)
+
+func testBlock(t *testing.T, i int) (cid.Cid, []byte) {
+	t.Helper()
+
+	b := []byte(fmt.Sprintf("block-%d", i))
+	c, err := data.CIDPrefix.Sum(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, b
+}
+
+func testBlockstores(t *testing.T) map[string]blockstore.Blockstore {
+	t.Helper()
+
+	file, err := blockstore.NewFileBlockstore(filepath.Join(t.TempDir(), "blocks"))
+	if err != nil {
+		t.Fatalf("NewFileBlockstore() error = %v", err)
+	}
+
+	return map[string]blockstore.Blockstore{
+		"mem":      blockstore.NewMemBlockstore(),
+		"file":     file,
+		"cached":   blockstore.NewCachedBlockstore(blockstore.NewMemBlockstore(), 2),
+		"tracking": blockstore.NewTrackingBlockstore(blockstore.NewMemBlockstore()),
+	}
+}
+
+func TestBlockstore(t *testing.T) {
+	for name, bs := range testBlockstores(t) {
+		t.Run(name, func(t *testing.T) {
+			var cids []cid.Cid
+			for i := 0; i < 5; i++ {
+				c, data := testBlock(t, i)
+				if err := bs.Put(c, data); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+				// the caller may reuse the data after Put
+				for j := range data {
+					data[j] = 0
+				}
+				cids = append(cids, c)
+			}
+
+			for i, c := range cids {
+				_, want := testBlock(t, i)
+				got, err := bs.Get(c)
+				if err != nil {
+					t.Fatalf("Get() error = %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("Get() = %s, want %s", got, want)
+				}
+
+				has, err := bs.Has(c)
+				if err != nil || !has {
+					t.Errorf("Has() = %v, %v, want true", has, err)
+				}
+			}
+
+			keys, err := bs.AllKeys()
+			if err != nil {
+				t.Fatalf("AllKeys() error = %v", err)
+			}
+			if len(keys) != len(cids) {
+				t.Errorf("AllKeys() = %v, want %d keys", keys, len(cids))
+			}
+
+			if err := bs.Delete(cids[0]); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := bs.Delete(cids[0]); err != nil {
+				t.Errorf("Delete() of missing block error = %v", err)
+			}
+			if _, err := bs.Get(cids[0]); !errors.Is(err, blockstore.ErrNotFound) {
+				t.Errorf("Get() error = %v, want %v", err, blockstore.ErrNotFound)
+			}
+			if has, err := bs.Has(cids[0]); err != nil || has {
+				t.Errorf("Has() = %v, %v, want false", has, err)
+			}
+		})
+	}
+}
+
+func TestFileBlockstore_IgnoresTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	bs, err := blockstore.NewFileBlockstore(dir)
+	if err != nil {
+		t.Fatalf("NewFileBlockstore() error = %v", err)
+	}
+
+	c, data := testBlock(t, 0)
+	if err := bs.Put(c, data); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := bs.AllKeys()
+	if err != nil {
+		t.Fatalf("AllKeys() error = %v", err)
+	}
+	if len(keys) != 1 || !keys[0].Equals(c) {
+		t.Errorf("AllKeys() = %v, want %v", keys, []cid.Cid{c})
+	}
+}
+
+func TestTrackingBlockstore(t *testing.T) {
+	backend := blockstore.NewMemBlockstore()
+	old, oldData := testBlock(t, 0)
+	if err := backend.Put(old, oldData); err != nil {
+		t.Fatal(err)
+	}
+
+	bs := blockstore.NewTrackingBlockstore(backend)
+	if err := bs.Put(old, oldData); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	var want []cid.Cid
+	for i := 1; i < 4; i++ {
+		c, data := testBlock(t, i)
+		if err := bs.Put(c, data); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		want = append(want, c)
+	}
+
+	if got := bs.Written(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Written() = %v, want %v", got, want)
+	}
+
+	written := bs.WrittenBlocks()
+	if has, _ := written.Has(old); has {
+		t.Errorf("WrittenBlocks() has %v, which was already in the backend", old)
+	}
+	for _, c := range want {
+		if has, _ := written.Has(c); !has {
+			t.Errorf("WrittenBlocks() does not have %v", c)
+		}
+	}
+
+	bs.Reset()
+	if got := bs.Written(); len(got) != 0 {
+		t.Errorf("Written() after Reset() = %v, want empty", got)
+	}
+}
+
+func TestImportExportCAR(t *testing.T) {
+	src := blockstore.NewMemBlockstore()
+	var roots []cid.Cid
+	for i := 0; i < 5; i++ {
+		c, data := testBlock(t, i)
+		if err := src.Put(c, data); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			roots = append(roots, c)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := blockstore.ExportCAR(src, buf, roots); err != nil {
+		t.Fatalf("ExportCAR() error = %v", err)
+	}
+
+	dst := blockstore.NewMemBlockstore()
+	gotRoots, err := blockstore.ImportCAR(dst, buf)
+	if err != nil {
+		t.Fatalf("ImportCAR() error = %v", err)
+	}
+	if fmt.Sprint(gotRoots) != fmt.Sprint(roots) {
+		t.Errorf("ImportCAR() = %v, want %v", gotRoots, roots)
+	}
+
+	srcKeys, _ := src.AllKeys()
+	dstKeys, _ := dst.AllKeys()
+	if fmt.Sprint(srcKeys) != fmt.Sprint(dstKeys) {
+		t.Errorf("AllKeys() = %v, want %v", dstKeys, srcKeys)
+	}
+}
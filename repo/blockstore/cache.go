@@ -0,0 +1,127 @@
+package blockstore
+
+import (
+	"container/list"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+const (
+	DEFAULT_CACHE_SIZE = 1024
+)
+
+type cacheEntry struct {
+	cid  cid.Cid
+	data []byte
+}
+
+// CachedBlockstore is a read-through cache of a Blockstore
+// The most recently used blocks are kept in memory up to the size.
+// CachedBlockstore is safe for concurrent use if the backend is.
+type CachedBlockstore struct {
+	backend Blockstore
+	size    int
+
+	mu      sync.Mutex
+	entries map[cid.Cid]*list.Element
+	lru     *list.List
+}
+
+// NewCachedBlockstore returns a new CachedBlockstore of the backend
+// If size is not positive, DEFAULT_CACHE_SIZE is used.
+func NewCachedBlockstore(backend Blockstore, size int) *CachedBlockstore {
+	if size <= 0 {
+		size = DEFAULT_CACHE_SIZE
+	}
+
+	return &CachedBlockstore{
+		backend: backend,
+		size:    size,
+		entries: make(map[cid.Cid]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (bs *CachedBlockstore) cached(c cid.Cid) ([]byte, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	elem, ok := bs.entries[c]
+	if !ok {
+		return nil, false
+	}
+	bs.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).data, true
+}
+
+func (bs *CachedBlockstore) cache(c cid.Cid, data []byte) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if elem, ok := bs.entries[c]; ok {
+		bs.lru.MoveToFront(elem)
+		return
+	}
+
+	bs.entries[c] = bs.lru.PushFront(&cacheEntry{cid: c, data: data})
+	for bs.lru.Len() > bs.size {
+		oldest := bs.lru.Back()
+		bs.lru.Remove(oldest)
+		delete(bs.entries, oldest.Value.(*cacheEntry).cid)
+	}
+}
+
+func (bs *CachedBlockstore) uncache(c cid.Cid) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if elem, ok := bs.entries[c]; ok {
+		bs.lru.Remove(elem)
+		delete(bs.entries, c)
+	}
+}
+
+// Get returns the data of the block from the cache or the backend
+func (bs *CachedBlockstore) Get(c cid.Cid) ([]byte, error) {
+	if data, ok := bs.cached(c); ok {
+		return data, nil
+	}
+
+	data, err := bs.backend.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	bs.cache(c, data)
+	return data, nil
+}
+
+// Put stores the block into the backend and the cache
+func (bs *CachedBlockstore) Put(c cid.Cid, data []byte) error {
+	if err := bs.backend.Put(c, data); err != nil {
+		return err
+	}
+
+	bs.cache(c, append([]byte{}, data...))
+	return nil
+}
+
+// Has returns true if the block is in the cache or the backend
+func (bs *CachedBlockstore) Has(c cid.Cid) (bool, error) {
+	if _, ok := bs.cached(c); ok {
+		return true, nil
+	}
+	return bs.backend.Has(c)
+}
+
+// Delete removes the block from the cache and the backend
+func (bs *CachedBlockstore) Delete(c cid.Cid) error {
+	bs.uncache(c)
+	return bs.backend.Delete(c)
+}
+
+// AllKeys returns the CIDs of all blocks in the backend
+func (bs *CachedBlockstore) AllKeys() ([]cid.Cid, error) {
+	return bs.backend.AllKeys()
+}
@@ -0,0 +1,125 @@
+package blockstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+const (
+	tempFilePrefix = ".tmp-"
+)
+
+// FileBlockstore is a Blockstore which stores each block as a flat file in a directory
+// The file name is the string representation of the CID.
+// Blocks are written atomically; the data is written into a temporary file,
+// which is renamed to the file name after it is synced.
+type FileBlockstore struct {
+	dir string
+}
+
+// NewFileBlockstore returns a new FileBlockstore in the directory
+// If the directory does not exist, it will be created.
+func NewFileBlockstore(dir string) (*FileBlockstore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create blockstore directory; %w", err)
+	}
+
+	return &FileBlockstore{
+		dir: dir,
+	}, nil
+}
+
+func (bs *FileBlockstore) path(c cid.Cid) string {
+	return filepath.Join(bs.dir, c.String())
+}
+
+// Get returns the data of the block
+// If the block is not found, it returns ErrNotFound
+func (bs *FileBlockstore) Get(c cid.Cid) ([]byte, error) {
+	data, err := os.ReadFile(bs.path(c))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Put stores the block atomically
+func (bs *FileBlockstore) Put(c cid.Cid, data []byte) error {
+	f, err := os.CreateTemp(bs.dir, tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// this fails after the rename, which is expected
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), bs.path(c))
+}
+
+// Has returns true if the block is stored
+func (bs *FileBlockstore) Has(c cid.Cid) (bool, error) {
+	_, err := os.Stat(bs.path(c))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes the block
+// Deleting a block which is not stored is not an error.
+func (bs *FileBlockstore) Delete(c cid.Cid) error {
+	err := os.Remove(bs.path(c))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// AllKeys returns the CIDs of all stored blocks
+func (bs *FileBlockstore) AllKeys() ([]cid.Cid, error) {
+	files, err := os.ReadDir(bs.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]cid.Cid, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), tempFilePrefix) {
+			continue
+		}
+
+		c, err := cid.Decode(f.Name())
+		if err != nil {
+			// ignore files which are not blocks
+			continue
+		}
+		keys = append(keys, c)
+	}
+	sortCids(keys)
+
+	return keys, nil
+}
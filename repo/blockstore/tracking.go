@@ -0,0 +1,117 @@
+package blockstore
+
+import (
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// TrackingBlockstore is a Blockstore which records the blocks written through it
+// It is used to collect the new blocks of a commit, so that the diff can be emitted.
+// The blocks which are already in the backend are not new, and are not recorded.
+// TrackingBlockstore is safe for concurrent use if the backend is.
+type TrackingBlockstore struct {
+	backend Blockstore
+
+	mu      sync.Mutex
+	written map[cid.Cid][]byte
+	order   []cid.Cid
+}
+
+// NewTrackingBlockstore returns a new TrackingBlockstore of the backend
+func NewTrackingBlockstore(backend Blockstore) *TrackingBlockstore {
+	return &TrackingBlockstore{
+		backend: backend,
+		written: make(map[cid.Cid][]byte),
+	}
+}
+
+// Get returns the data of the block from the backend
+func (bs *TrackingBlockstore) Get(c cid.Cid) ([]byte, error) {
+	return bs.backend.Get(c)
+}
+
+// Put stores the block into the backend and records it, unless the backend already has it
+func (bs *TrackingBlockstore) Put(c cid.Cid, data []byte) error {
+	has, err := bs.backend.Has(c)
+	if err != nil {
+		return err
+	}
+	if has {
+		return nil
+	}
+	if err := bs.backend.Put(c, data); err != nil {
+		return err
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if _, ok := bs.written[c]; !ok {
+		bs.order = append(bs.order, c)
+	}
+	bs.written[c] = append([]byte{}, data...)
+
+	return nil
+}
+
+// Has returns true if the block is in the backend
+func (bs *TrackingBlockstore) Has(c cid.Cid) (bool, error) {
+	return bs.backend.Has(c)
+}
+
+// Delete removes the block from the backend and forgets it if it was recorded
+func (bs *TrackingBlockstore) Delete(c cid.Cid) error {
+	if err := bs.backend.Delete(c); err != nil {
+		return err
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if _, ok := bs.written[c]; ok {
+		delete(bs.written, c)
+		for i, o := range bs.order {
+			if o == c {
+				bs.order = append(bs.order[:i], bs.order[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// AllKeys returns the CIDs of all blocks in the backend
+func (bs *TrackingBlockstore) AllKeys() ([]cid.Cid, error) {
+	return bs.backend.AllKeys()
+}
+
+// Written returns the CIDs of the recorded blocks in the written order
+func (bs *TrackingBlockstore) Written() []cid.Cid {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	return append([]cid.Cid{}, bs.order...)
+}
+
+// WrittenBlocks returns a new MemBlockstore with the recorded blocks
+func (bs *TrackingBlockstore) WrittenBlocks() *MemBlockstore {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	mem := NewMemBlockstore()
+	for c, data := range bs.written {
+		mem.blocks[c] = data
+	}
+	return mem
+}
+
+// Reset forgets the recorded blocks
+func (bs *TrackingBlockstore) Reset() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.written = make(map[cid.Cid][]byte)
+	bs.order = nil
+}
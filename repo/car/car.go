@@ -0,0 +1,292 @@
+// the package car implements streaming reader and writer of CAR (Content Addressable aRchives) v1
+// https://ipld.io/specs/transport/car/carv1/
+//
+// A CAR v1 file is a varint-length-prefixed DAG-CBOR header with the roots,
+// followed by varint-length-prefixed blocks of the CID and the data.
+
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+const (
+	VERSION = 1
+
+	DEFAULT_MAX_HEADER_SIZE = 1 << 20 // 1 MiB
+	DEFAULT_MAX_BLOCK_SIZE  = 2 << 20 // 2 MiB
+)
+
+var HeaderSchema schema.Type
+
+func init() {
+	schema, err := ipld.LoadSchemaBytes([]byte(`
+		type Header struct {
+			version Int
+			roots [Link]
+		} representation map
+	`))
+	if err != nil {
+		panic(err)
+	}
+
+	HeaderSchema = schema.TypeByName("Header")
+}
+
+// Header is the header of CAR v1
+type Header struct {
+	Version int64
+	Roots   []cid.Cid
+}
+
+// Block is a block of CAR with the CID and the data
+type Block struct {
+	CID  cid.Cid
+	Data []byte
+}
+
+// Options is the options of Reader
+type Options struct {
+	// MaxHeaderSize is the maximum size of the header in bytes.
+	// If zero, DEFAULT_MAX_HEADER_SIZE is used.
+	MaxHeaderSize int
+
+	// MaxBlockSize is the maximum size of a block (the CID and the data) in bytes.
+	// If zero, DEFAULT_MAX_BLOCK_SIZE is used.
+	MaxBlockSize int
+
+	// ReuseBuffer makes the reader reuse a single buffer for the data of blocks,
+	// so that the memory usage is bounded by MaxBlockSize regardless of the size of the CAR.
+	// The data of a block returned by Next is valid only until the next call of Next.
+	ReuseBuffer bool
+}
+
+// Reader reads blocks from CAR v1 stream
+// Every block is verified against its CID on read.
+type Reader struct {
+	r       *bufio.Reader
+	header  *Header
+	options Options
+	buf     []byte
+}
+
+// NewReader reads the header from the stream and returns a new Reader
+// If opts is nil, the default options are used.
+func NewReader(r io.Reader, opts *Options) (*Reader, error) {
+	options := Options{}
+	if opts != nil {
+		options = *opts
+	}
+	if options.MaxHeaderSize <= 0 {
+		options.MaxHeaderSize = DEFAULT_MAX_HEADER_SIZE
+	}
+	if options.MaxBlockSize <= 0 {
+		options.MaxBlockSize = DEFAULT_MAX_BLOCK_SIZE
+	}
+
+	reader := &Reader{
+		r:       bufio.NewReader(r),
+		options: options,
+	}
+
+	b, err := reader.readSection(options.MaxHeaderSize, nil)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read CAR header; %w", err)
+	}
+
+	header, err := DecodeHeader(b)
+	if err != nil {
+		return nil, err
+	}
+
+	reader.header = header
+	return reader, nil
+}
+
+// Header returns the header of the CAR
+func (r *Reader) Header() *Header {
+	return r.header
+}
+
+// Roots returns the roots of the CAR
+func (r *Reader) Roots() []cid.Cid {
+	return r.header.Roots
+}
+
+// readSection reads a varint-length-prefixed section
+// it returns io.EOF only if the stream ends before the section.
+func (r *Reader) readSection(max int, buf []byte) ([]byte, error) {
+	length, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("invalid section length; %w", err)
+	}
+	if length == 0 {
+		return nil, fmt.Errorf("invalid section length; must not be zero")
+	}
+	if length > uint64(max) {
+		return nil, fmt.Errorf("section is too large: %d bytes; max %d bytes", length, max)
+	}
+
+	if cap(buf) < int(length) {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// Next reads the next block from the stream
+// At the end of the stream, it returns io.EOF.
+func (r *Reader) Next() (*Block, error) {
+	var buf []byte
+	if r.options.ReuseBuffer {
+		buf = r.buf
+	}
+
+	b, err := r.readSection(r.options.MaxBlockSize, buf)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read CAR block; %w", err)
+	}
+	if r.options.ReuseBuffer {
+		r.buf = b
+	}
+
+	n, c, err := cid.CidFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR block; invalid CID; %w", err)
+	}
+	data := b[n:]
+
+	if err := Verify(c, data); err != nil {
+		return nil, err
+	}
+
+	return &Block{
+		CID:  c,
+		Data: data,
+	}, nil
+}
+
+// Verify checks the data matches the CID
+func Verify(c cid.Cid, data []byte) error {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return fmt.Errorf("failed to verify block: %s; %w", c, err)
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("failed to verify block: %s; CID mismatch: %s", c, sum)
+	}
+	return nil
+}
+
+// Writer writes blocks into CAR v1 stream
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter writes the header with the roots into the stream and returns a new Writer
+func NewWriter(w io.Writer, roots []cid.Cid) (*Writer, error) {
+	header, err := EncodeHeader(&Header{
+		Version: VERSION,
+		Roots:   roots,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &Writer{
+		w:   w,
+		buf: make([]byte, binary.MaxVarintLen64),
+	}
+
+	if err := writer.writeSection(header); err != nil {
+		return nil, fmt.Errorf("failed to write CAR header; %w", err)
+	}
+
+	return writer, nil
+}
+
+func (w *Writer) writeSection(sections ...[]byte) error {
+	length := 0
+	for _, s := range sections {
+		length += len(s)
+	}
+
+	n := binary.PutUvarint(w.buf, uint64(length))
+	if _, err := w.w.Write(w.buf[:n]); err != nil {
+		return err
+	}
+	for _, s := range sections {
+		if _, err := w.w.Write(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteBlock writes a block into the stream
+func (w *Writer) WriteBlock(c cid.Cid, data []byte) error {
+	if err := w.writeSection(c.Bytes(), data); err != nil {
+		return fmt.Errorf("failed to write CAR block: %s; %w", c, err)
+	}
+	return nil
+}
+
+// EncodeHeader encodes the header into DAG-CBOR bytes
+func EncodeHeader(header *Header) ([]byte, error) {
+	if header.Roots == nil {
+		header.Roots = []cid.Cid{}
+	}
+
+	buf := new(bytes.Buffer)
+	node := bindnode.Wrap(header, HeaderSchema).Representation()
+	if err := dagcbor.Encode(node, buf); err != nil {
+		return nil, fmt.Errorf("failed to encode CAR header; %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeHeader decodes DAG-CBOR bytes into the header
+// Only CAR v1 is supported.
+func DecodeHeader(b []byte) (*Header, error) {
+	builder := bindnode.Prototype((*Header)(nil), HeaderSchema).Representation().NewBuilder()
+	if err := dagcbor.Decode(builder, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("failed to decode CAR header; %w", err)
+	}
+
+	header := bindnode.Unwrap(builder.Build()).(*Header)
+	if header.Version != VERSION {
+		return nil, fmt.Errorf("unsupported CAR version: %d", header.Version)
+	}
+
+	return header, nil
+}
@@ -0,0 +1,142 @@
+package car_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"go.yumnet.cloud/orangesea/repo/car"
+)
+
+var testPrefix = cid.Prefix{
+	Version:  1,
+	Codec:    cid.DagCBOR,
+	MhType:   mh.SHA2_256,
+	MhLength: -1,
+}
+
+func testBlocks(t *testing.T, n int) []car.Block {
+	t.Helper()
+
+	blocks := make([]car.Block, n)
+	for i := range blocks {
+		data := []byte(fmt.Sprintf("block-%d", i))
+		c, err := testPrefix.Sum(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks[i] = car.Block{CID: c, Data: data}
+	}
+	return blocks
+}
+
+func writeCAR(t *testing.T, roots []cid.Cid, blocks []car.Block) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	w, err := car.NewWriter(buf, roots)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	for _, b := range blocks {
+		if err := w.WriteBlock(b.CID, b.Data); err != nil {
+			t.Fatalf("WriteBlock() error = %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadWrite(t *testing.T) {
+	for _, reuse := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ReuseBuffer=%v", reuse), func(t *testing.T) {
+			blocks := testBlocks(t, 10)
+			roots := []cid.Cid{blocks[0].CID}
+			b := writeCAR(t, roots, blocks)
+
+			r, err := car.NewReader(bytes.NewReader(b), &car.Options{ReuseBuffer: reuse})
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			if len(r.Roots()) != 1 || !r.Roots()[0].Equals(roots[0]) {
+				t.Errorf("Roots() = %v, want %v", r.Roots(), roots)
+			}
+
+			for i := 0; ; i++ {
+				block, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					if i != len(blocks) {
+						t.Errorf("Next() returned %d blocks, want %d", i, len(blocks))
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				if !block.CID.Equals(blocks[i].CID) || !bytes.Equal(block.Data, blocks[i].Data) {
+					t.Errorf("Next() = %v, want %v", block, blocks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReader_EmptyRoots(t *testing.T) {
+	b := writeCAR(t, nil, nil)
+
+	r, err := car.NewReader(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if len(r.Roots()) != 0 {
+		t.Errorf("Roots() = %v, want empty", r.Roots())
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReader_Failure(t *testing.T) {
+	blocks := testBlocks(t, 2)
+	valid := writeCAR(t, []cid.Cid{blocks[0].CID}, blocks)
+
+	tampered := append([]byte{}, valid...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		b    []byte
+		opts *car.Options
+	}{
+		{name: "tampered block", b: tampered},
+		{name: "truncated block", b: valid[:len(valid)-1]},
+		{name: "block too large", b: valid, opts: &car.Options{MaxBlockSize: 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := car.NewReader(bytes.NewReader(tt.b), tt.opts)
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			for {
+				_, err = r.Next()
+				if err != nil {
+					break
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				t.Errorf("Next() error = %v, want non-EOF error", err)
+			}
+		})
+	}
+
+	for _, b := range [][]byte{nil, valid[:5], {0x01, 0xf6}} {
+		if _, err := car.NewReader(bytes.NewReader(b), nil); err == nil {
+			t.Errorf("NewReader(%x) error = nil, wantErr true", b)
+		}
+	}
+}
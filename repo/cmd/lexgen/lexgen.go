@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+	"go.yumnet.cloud/orangesea/repo/lexicon/gen"
+)
+
+func generate(lexiconDir string, outDir string, importPrefix string) error {
+	catalog := lexicon.NewCatalog()
+	if err := catalog.LoadFS(os.DirFS(lexiconDir)); err != nil {
+		return err
+	}
+
+	files, err := gen.NewGenerator(catalog, importPrefix).Generate()
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		out := filepath.Join(outDir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(out, files[p], 0o644); err != nil {
+			return err
+		}
+		fmt.Println(out)
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Println("Usage: lexgen <lexicon_dir> <out_dir> <import_prefix>")
+		fmt.Println("Generates Go code from the Lexicon JSON files in <lexicon_dir> into <out_dir>,")
+		fmt.Println("whose import path is <import_prefix>, e.g. example.com/api")
+		os.Exit(1)
+	}
+
+	if err := generate(os.Args[1], os.Args[2], os.Args[3]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,293 @@
+// the package commit implements signed repository commit objects (version 3)
+
+package commit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	didresolver "go.yumnet.cloud/orangesea/did/resolver"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/rkey"
+)
+
+const (
+	VERSION = 3
+)
+
+var (
+	CommitSchema   schema.Type
+	UnsignedSchema schema.Type
+)
+
+func init() {
+	schema, err := ipld.LoadSchemaBytes([]byte(`
+		type Commit struct {
+			did String
+			version Int
+			data Link
+			rev String
+			prev nullable Link
+			sig Bytes
+		} representation map
+
+		type UnsignedCommit struct {
+			did String
+			version Int
+			data Link
+			rev String
+			prev nullable Link
+		} representation map
+	`))
+	if err != nil {
+		panic(err)
+	}
+
+	CommitSchema = schema.TypeByName("Commit")
+	UnsignedSchema = schema.TypeByName("UnsignedCommit")
+}
+
+// Commit is a signed repository commit object
+type Commit struct {
+	DID     string   // DID of the repository
+	Version int64    // always VERSION
+	Data    cid.Cid  // root CID of the MST
+	Rev     string   // revision of the repository; TID
+	Prev    *cid.Cid // CID of the previous commit; usually nil
+	Sig     []byte   // signature of the unsigned commit
+}
+
+// the go structs for bindnode; the field names must match the schema
+type unsignedCommit struct {
+	Did     string
+	Version int64
+	Data    cid.Cid
+	Rev     string
+	Prev    *cid.Cid
+}
+
+type signedCommit struct {
+	Did     string
+	Version int64
+	Data    cid.Cid
+	Rev     string
+	Prev    *cid.Cid
+	Sig     []byte
+}
+
+// NewCommit returns a new unsigned commit with a new revision
+func NewCommit(did string, data cid.Cid, prev *cid.Cid) *Commit {
+	return &Commit{
+		DID:     did,
+		Version: VERSION,
+		Data:    data,
+		Rev:     rkey.NewTID().String(),
+		Prev:    prev,
+	}
+}
+
+// UnsignedBytes returns the DAG-CBOR bytes of the commit without the signature,
+// which are the bytes to be signed
+func (c *Commit) UnsignedBytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	node := bindnode.Wrap(&unsignedCommit{
+		Did:     c.DID,
+		Version: c.Version,
+		Data:    c.Data,
+		Rev:     c.Rev,
+		Prev:    c.Prev,
+	}, UnsignedSchema).Representation()
+	if err := dagcbor.Encode(node, buf); err != nil {
+		return nil, fmt.Errorf("failed to encode commit; %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Bytes returns the DAG-CBOR bytes of the signed commit
+func (c *Commit) Bytes() ([]byte, error) {
+	if c.Sig == nil {
+		return nil, fmt.Errorf("failed to encode commit; commit is not signed")
+	}
+
+	buf := new(bytes.Buffer)
+	node := bindnode.Wrap(&signedCommit{
+		Did:     c.DID,
+		Version: c.Version,
+		Data:    c.Data,
+		Rev:     c.Rev,
+		Prev:    c.Prev,
+		Sig:     c.Sig,
+	}, CommitSchema).Representation()
+	if err := dagcbor.Encode(node, buf); err != nil {
+		return nil, fmt.Errorf("failed to encode commit; %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Block returns the CID and the DAG-CBOR bytes of the signed commit
+func (c *Commit) Block() (cid.Cid, []byte, error) {
+	b, err := c.Bytes()
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	sum, err := data.CIDPrefix.Sum(b)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to calculate CID; %w", err)
+	}
+	return sum, b, nil
+}
+
+// CID returns the CID of the signed commit
+func (c *Commit) CID() (cid.Cid, error) {
+	sum, _, err := c.Block()
+	return sum, err
+}
+
+// Decode decodes the DAG-CBOR bytes into the signed commit
+func Decode(b []byte) (*Commit, error) {
+	builder := bindnode.Prototype((*signedCommit)(nil), CommitSchema).Representation().NewBuilder()
+	if err := dagcbor.Decode(builder, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("failed to decode commit; %w", err)
+	}
+
+	sc := bindnode.Unwrap(builder.Build()).(*signedCommit)
+	if sc.Version != VERSION {
+		return nil, fmt.Errorf("unsupported commit version: %d", sc.Version)
+	}
+
+	return &Commit{
+		DID:     sc.Did,
+		Version: sc.Version,
+		Data:    sc.Data,
+		Rev:     sc.Rev,
+		Prev:    sc.Prev,
+		Sig:     sc.Sig,
+	}, nil
+}
+
+// Sign signs the commit with the key
+func (c *Commit) Sign(key *didkey.DIDKey) error {
+	b, err := c.UnsignedBytes()
+	if err != nil {
+		return err
+	}
+
+	sig, err := key.Sign(sha256.Sum256(b))
+	if err != nil {
+		return fmt.Errorf("failed to sign commit; %w", err)
+	}
+
+	c.Sig = sig
+	return nil
+}
+
+// VerifySignature verifies the signature of the commit with the key
+func (c *Commit) VerifySignature(key *didkey.DIDKey) error {
+	if c.Sig == nil {
+		return fmt.Errorf("invalid commit; commit is not signed")
+	}
+
+	b, err := c.UnsignedBytes()
+	if err != nil {
+		return err
+	}
+
+	if !key.Verify(sha256.Sum256(b), c.Sig) {
+		return fmt.Errorf("invalid commit; signature verification failed")
+	}
+	return nil
+}
+
+// refresher resolves DIDs bypassing the cache, e.g. *didresolver.CachedResolver
+type refresher interface {
+	Refresh(ctx context.Context, did string) (*didresolver.Document, error)
+}
+
+// Verifier verifies commits with the signing keys of the DIDs
+// If DIDs can refresh its cache (e.g. *didresolver.CachedResolver),
+// the signature is verified again with the refreshed key when it fails, as the key may have been rotated.
+type Verifier struct {
+	DIDs didresolver.DIDResolver
+}
+
+// NewVerifier returns a new Verifier with the default DID resolver and cache
+func NewVerifier() *Verifier {
+	return &Verifier{
+		DIDs: didresolver.NewCachedResolver(didresolver.NewResolver()),
+	}
+}
+
+// Verify verifies the commit
+// It checks the structure of the commit, and the signature with the signing key of the DID.
+// If prev (a previously seen commit of the repository) is not nil,
+// it also checks the revision of the commit is greater than the revision of prev.
+func (v *Verifier) Verify(ctx context.Context, c *Commit, prev *Commit) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if prev != nil {
+		if prev.DID != c.DID {
+			return fmt.Errorf("invalid commit; DID mismatch with previous commit: %s", prev.DID)
+		}
+		if c.Rev <= prev.Rev {
+			return fmt.Errorf("invalid commit; rev %s must be greater than previous rev %s", c.Rev, prev.Rev)
+		}
+	}
+
+	key, err := signingKey(v.DIDs.Resolve(ctx, c.DID))
+	if err != nil {
+		return err
+	}
+	err = c.VerifySignature(key)
+
+	r, ok := v.DIDs.(refresher)
+	if err == nil || !ok {
+		return err
+	}
+	refreshed, rerr := signingKey(r.Refresh(ctx, c.DID))
+	if rerr != nil {
+		return rerr
+	}
+	if refreshed.DID() == key.DID() {
+		return err
+	}
+	return c.VerifySignature(refreshed)
+}
+
+func signingKey(doc *didresolver.Document, err error) (*didkey.DIDKey, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify commit; %w", err)
+	}
+	key, err := doc.SigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify commit; %w", err)
+	}
+	return key, nil
+}
+
+// Validate checks the structure of the commit
+func (c *Commit) Validate() error {
+	if c.Version != VERSION {
+		return fmt.Errorf("invalid commit; unsupported version: %d", c.Version)
+	}
+	if c.DID == "" {
+		return fmt.Errorf("invalid commit; DID is empty")
+	}
+	if !c.Data.Defined() {
+		return fmt.Errorf("invalid commit; data is undefined")
+	}
+	if _, err := rkey.ParseTID(c.Rev); err != nil {
+		return fmt.Errorf("invalid commit; invalid rev; %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package commit_test
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	didresolver "go.yumnet.cloud/orangesea/did/resolver"
+	"go.yumnet.cloud/orangesea/repo/commit"
+	"go.yumnet.cloud/orangesea/repo/internal/testutil"
+)
+
+const testDID = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+var testData = cid.MustParse("bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+
+func TestCommit_SignAndDecode(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+
+	c := commit.NewCommit(testDID, testData, nil)
+	if _, err := c.Bytes(); err == nil {
+		t.Errorf("Bytes() of unsigned commit error = nil, wantErr true")
+	}
+	if err := c.Sign(key); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	_, b, err := c.Block()
+	if err != nil {
+		t.Fatalf("Block() error = %v", err)
+	}
+
+	decoded, err := commit.Decode(b)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if decoded.DID != c.DID || decoded.Rev != c.Rev || !decoded.Data.Equals(c.Data) || decoded.Prev != nil {
+		t.Errorf("Decode() = %+v, want %+v", decoded, c)
+	}
+
+	if err := decoded.VerifySignature(key); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+
+	other := testutil.Key(t, "eTjwKVXf49uG6Bx-MoT3dtF3vdXtadujEQg1UOd5eDs")
+	if err := decoded.VerifySignature(other); err == nil {
+		t.Errorf("VerifySignature() with other key error = nil, wantErr true")
+	}
+
+	decoded.Data = cid.MustParse("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err := decoded.VerifySignature(key); err == nil {
+		t.Errorf("VerifySignature() of tampered commit error = nil, wantErr true")
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	v := &commit.Verifier{DIDs: testutil.DIDs{testDID: key}}
+
+	prev := commit.NewCommit(testDID, testData, nil)
+	if err := prev.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	prevCID, err := prev.CID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := commit.NewCommit(testDID, testData, &prevCID)
+	if err := c.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Verify(context.Background(), prev, nil); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := v.Verify(context.Background(), c, prev); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// rev must be strictly increasing
+	if err := v.Verify(context.Background(), prev, c); err == nil {
+		t.Errorf("Verify() with older rev error = nil, wantErr true")
+	}
+	if err := v.Verify(context.Background(), c, c); err == nil {
+		t.Errorf("Verify() with same rev error = nil, wantErr true")
+	}
+
+	unknown := commit.NewCommit("did:plc:unknown", testData, nil)
+	if err := unknown.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(context.Background(), unknown, nil); err == nil {
+		t.Errorf("Verify() with unresolvable DID error = nil, wantErr true")
+	}
+
+	invalid := *c
+	invalid.Rev = "invalid"
+	if err := v.Verify(context.Background(), &invalid, nil); err == nil {
+		t.Errorf("Verify() with invalid rev error = nil, wantErr true")
+	}
+}
+
+func TestVerifier_Verify_RotatedKey(t *testing.T) {
+	old := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	rotated := testutil.Key(t, "JkJ5gm2y4HqzrjumUCZ7X4hyqXT1CuhrV5QUZYxeRss")
+
+	dids := testutil.DIDs{testDID: old}
+	v := &commit.Verifier{DIDs: didresolver.NewCachedResolver(dids)}
+
+	sign := func(key *didkey.DIDKey) *commit.Commit {
+		c := commit.NewCommit(testDID, testData, nil)
+		if err := c.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if err := v.Verify(context.Background(), sign(old), nil); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// the cached key is refreshed once when the signature fails
+	dids[testDID] = rotated
+	if err := v.Verify(context.Background(), sign(rotated), nil); err != nil {
+		t.Errorf("Verify() with rotated key error = %v", err)
+	}
+	if err := v.Verify(context.Background(), sign(rotated), nil); err != nil {
+		t.Errorf("Verify() with cached rotated key error = %v", err)
+	}
+
+	// the refresh is rate limited, so the key rotated again is not resolved yet
+	dids[testDID] = old
+	if err := v.Verify(context.Background(), sign(old), nil); err == nil {
+		t.Errorf("Verify() within the refresh interval error = nil, wantErr true")
+	}
+}
@@ -0,0 +1,498 @@
+// the package data converts the atproto data model between JSON and DAG-CBOR
+// https://atproto.com/specs/data-model
+//
+// In JSON, CIDs are `{"$link": "<cid>"}`, bytes are `{"$bytes": "<base64 without padding>"}`,
+// and blobs are `{"$type": "blob", "ref": <cid-link>, "mimeType": ..., "size": ...}`.
+// Floats are not allowed in either representation.
+
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	MAX_DEPTH = 128 // maximum nesting of maps and lists
+
+	TYPE_BLOB = "blob"
+)
+
+var ErrInvalidData = errors.New("invalid atproto data")
+
+// CIDPrefix is the CID prefix of records, MST nodes and commits (CIDv1, dag-cbor, sha2-256)
+var CIDPrefix = cid.Prefix{
+	Version:  1,
+	Codec:    cid.DagCBOR,
+	MhType:   mh.SHA2_256,
+	MhLength: -1,
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidData, fmt.Sprintf(format, args...))
+}
+
+// Blob is a reference to a blob
+type Blob struct {
+	Ref      cid.Cid
+	MimeType string
+	Size     int64
+}
+
+// ParseBlob parses the blob node of `{"$type": "blob", "ref": ..., "mimeType": ..., "size": ...}`
+func ParseBlob(n datamodel.Node) (*Blob, error) {
+	if n.Kind() != datamodel.Kind_Map {
+		return nil, invalid("blob must be a map")
+	}
+	if typ, err := lookupString(n, "$type"); err != nil || typ != TYPE_BLOB {
+		return nil, invalid("blob must have $type of blob")
+	}
+
+	refNode, err := n.LookupByString("ref")
+	if err != nil {
+		return nil, invalid("blob ref is missing")
+	}
+	ref, err := refNode.AsLink()
+	if err != nil {
+		return nil, invalid("blob ref must be a link")
+	}
+	cl, ok := ref.(cidlink.Link)
+	if !ok {
+		return nil, invalid("blob ref must be a CID")
+	}
+
+	mimeType, err := lookupString(n, "mimeType")
+	if err != nil || mimeType == "" {
+		return nil, invalid("blob mimeType must be a non-empty string")
+	}
+
+	sizeNode, err := n.LookupByString("size")
+	if err != nil {
+		return nil, invalid("blob size is missing")
+	}
+	size, err := sizeNode.AsInt()
+	if err != nil || size < 0 {
+		return nil, invalid("blob size must be a non-negative integer")
+	}
+
+	return &Blob{Ref: cl.Cid, MimeType: mimeType, Size: size}, nil
+}
+
+// Node returns the node of the blob
+func (b *Blob) Node() (datamodel.Node, error) {
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(4)
+	if err != nil {
+		return nil, err
+	}
+	entries := []struct {
+		key    string
+		assign func(datamodel.NodeAssembler) error
+	}{
+		{"$type", func(na datamodel.NodeAssembler) error { return na.AssignString(TYPE_BLOB) }},
+		{"mimeType", func(na datamodel.NodeAssembler) error { return na.AssignString(b.MimeType) }},
+		{"ref", func(na datamodel.NodeAssembler) error { return na.AssignLink(cidlink.Link{Cid: b.Ref}) }},
+		{"size", func(na datamodel.NodeAssembler) error { return na.AssignInt(b.Size) }},
+	}
+	for _, e := range entries {
+		if err := ma.AssembleKey().AssignString(e.key); err != nil {
+			return nil, err
+		}
+		if err := e.assign(ma.AssembleValue()); err != nil {
+			return nil, err
+		}
+	}
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// Validate validates the node conforms to the atproto data model
+// Floats are rejected, $type must be a non-empty string, and blobs must be well-formed.
+func Validate(n datamodel.Node) error {
+	return validate(n, 0)
+}
+
+func validate(n datamodel.Node, depth int) error {
+	if depth > MAX_DEPTH {
+		return invalid("nested too deeply")
+	}
+
+	switch n.Kind() {
+	case datamodel.Kind_Float:
+		return invalid("floats are not allowed")
+	case datamodel.Kind_Link:
+		l, err := n.AsLink()
+		if err != nil {
+			return err
+		}
+		if _, ok := l.(cidlink.Link); !ok {
+			return invalid("unsupported link: %s", l)
+		}
+	case datamodel.Kind_List:
+		it := n.ListIterator()
+		for !it.Done() {
+			_, v, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if err := validate(v, depth+1); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_Map:
+		if typNode, err := n.LookupByString("$type"); err == nil {
+			typ, err := typNode.AsString()
+			if err != nil || typ == "" {
+				return invalid("$type must be a non-empty string")
+			}
+			if typ == TYPE_BLOB {
+				if _, err := ParseBlob(n); err != nil {
+					return err
+				}
+			}
+		}
+
+		it := n.MapIterator()
+		for !it.Done() {
+			k, v, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if k.Kind() != datamodel.Kind_String {
+				return invalid("map keys must be strings")
+			}
+			if err := validate(v, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateRecord validates the node is a record; a map with $type
+func ValidateRecord(n datamodel.Node) error {
+	if n.Kind() != datamodel.Kind_Map {
+		return invalid("record must be a map")
+	}
+	if _, err := lookupString(n, "$type"); err != nil {
+		return invalid("record must have $type")
+	}
+	return Validate(n)
+}
+
+// Blobs returns the blobs referenced in the node in the order of appearance
+func Blobs(n datamodel.Node) ([]*Blob, error) {
+	var blobs []*Blob
+	var walk func(n datamodel.Node) error
+	walk = func(n datamodel.Node) error {
+		switch n.Kind() {
+		case datamodel.Kind_List:
+			it := n.ListIterator()
+			for !it.Done() {
+				_, v, err := it.Next()
+				if err != nil {
+					return err
+				}
+				if err := walk(v); err != nil {
+					return err
+				}
+			}
+		case datamodel.Kind_Map:
+			if typ, err := lookupString(n, "$type"); err == nil && typ == TYPE_BLOB {
+				blob, err := ParseBlob(n)
+				if err != nil {
+					return err
+				}
+				blobs = append(blobs, blob)
+				return nil
+			}
+
+			it := n.MapIterator()
+			for !it.Done() {
+				_, v, err := it.Next()
+				if err != nil {
+					return err
+				}
+				if err := walk(v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := walk(n); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// EncodeCBOR validates the node and encodes it into DAG-CBOR
+func EncodeCBOR(n datamodel.Node) ([]byte, error) {
+	if err := Validate(n); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := dagcbor.Encode(n, buf); err != nil {
+		return nil, fmt.Errorf("failed to encode DAG-CBOR; %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeCBOR decodes the DAG-CBOR and validates the node
+func DecodeCBOR(b []byte) (datamodel.Node, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("failed to decode DAG-CBOR; %w", err)
+	}
+
+	n := nb.Build()
+	if err := Validate(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// CID returns the CID of the DAG-CBOR bytes
+func CID(b []byte) (cid.Cid, error) {
+	c, err := CIDPrefix.Sum(b)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to calculate CID; %w", err)
+	}
+	return c, nil
+}
+
+// RecordCID returns the CID of the record node encoded in DAG-CBOR
+func RecordCID(n datamodel.Node) (cid.Cid, error) {
+	b, err := EncodeCBOR(n)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return CID(b)
+}
+
+// DecodeJSON decodes the JSON into the node
+// The JSON must be a single value; `{"$link": ...}` is decoded into a link, and `{"$bytes": ...}` into bytes.
+func DecodeJSON(b []byte) (datamodel.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON; %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to decode JSON; trailing data")
+	}
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := assembleJSON(nb, v, 0); err != nil {
+		return nil, err
+	}
+
+	n := nb.Build()
+	if err := Validate(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func assembleJSON(na datamodel.NodeAssembler, v interface{}, depth int) error {
+	if depth > MAX_DEPTH {
+		return invalid("nested too deeply")
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return na.AssignNull()
+	case bool:
+		return na.AssignBool(v)
+	case string:
+		return na.AssignString(v)
+	case json.Number:
+		n, err := strconv.ParseInt(v.String(), 10, 64)
+		if err != nil {
+			return invalid("number %s is not an integer; floats are not allowed", v)
+		}
+		return na.AssignInt(n)
+	case []interface{}:
+		la, err := na.BeginList(int64(len(v)))
+		if err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := assembleJSON(la.AssembleValue(), item, depth+1); err != nil {
+				return err
+			}
+		}
+		return la.Finish()
+	case map[string]interface{}:
+		if raw, ok := v["$link"]; ok {
+			s, ok := raw.(string)
+			if !ok || len(v) != 1 {
+				return invalid("$link must be the only key with a string")
+			}
+			c, err := cid.Decode(s)
+			if err != nil {
+				return invalid("$link is not a CID: %s", s)
+			}
+			return na.AssignLink(cidlink.Link{Cid: c})
+		}
+		if raw, ok := v["$bytes"]; ok {
+			s, ok := raw.(string)
+			if !ok || len(v) != 1 {
+				return invalid("$bytes must be the only key with a string")
+			}
+			b, err := base64.RawStdEncoding.DecodeString(s)
+			if err != nil {
+				return invalid("$bytes is not base64 without padding")
+			}
+			return na.AssignBytes(b)
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		ma, err := na.BeginMap(int64(len(v)))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := ma.AssembleKey().AssignString(k); err != nil {
+				return err
+			}
+			if err := assembleJSON(ma.AssembleValue(), v[k], depth+1); err != nil {
+				return err
+			}
+		}
+		return ma.Finish()
+	}
+	return fmt.Errorf("unsupported JSON value: %T", v)
+}
+
+// EncodeJSON validates the node and encodes it into JSON
+func EncodeJSON(n datamodel.Node) ([]byte, error) {
+	if err := Validate(n); err != nil {
+		return nil, err
+	}
+
+	v, err := nodeToValue(n)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// link and bytesValue are the JSON representations of links and bytes
+type link struct {
+	Link string `json:"$link"`
+}
+
+type bytesValue struct {
+	Bytes string `json:"$bytes"`
+}
+
+func nodeToValue(n datamodel.Node) (interface{}, error) {
+	switch n.Kind() {
+	case datamodel.Kind_Null:
+		return nil, nil
+	case datamodel.Kind_Bool:
+		return n.AsBool()
+	case datamodel.Kind_Int:
+		return n.AsInt()
+	case datamodel.Kind_String:
+		return n.AsString()
+	case datamodel.Kind_Bytes:
+		b, err := n.AsBytes()
+		if err != nil {
+			return nil, err
+		}
+		return bytesValue{Bytes: base64.RawStdEncoding.EncodeToString(b)}, nil
+	case datamodel.Kind_Link:
+		l, err := n.AsLink()
+		if err != nil {
+			return nil, err
+		}
+		return link{Link: l.(cidlink.Link).Cid.String()}, nil
+	case datamodel.Kind_List:
+		list := make([]interface{}, 0, n.Length())
+		it := n.ListIterator()
+		for !it.Done() {
+			_, item, err := it.Next()
+			if err != nil {
+				return nil, err
+			}
+			v, err := nodeToValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case datamodel.Kind_Map:
+		m := make(map[string]interface{}, n.Length())
+		it := n.MapIterator()
+		for !it.Done() {
+			k, item, err := it.Next()
+			if err != nil {
+				return nil, err
+			}
+			key, err := k.AsString()
+			if err != nil {
+				return nil, err
+			}
+			v, err := nodeToValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	}
+	return nil, invalid("unsupported kind: %s", n.Kind())
+}
+
+// JSONToCBOR converts the JSON into DAG-CBOR
+func JSONToCBOR(b []byte) ([]byte, error) {
+	n, err := DecodeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeCBOR(n)
+}
+
+// CBORToJSON converts the DAG-CBOR into JSON
+func CBORToJSON(b []byte) ([]byte, error) {
+	n, err := DecodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeJSON(n)
+}
+
+func lookupString(n datamodel.Node, key string) (string, error) {
+	v, err := n.LookupByString(key)
+	if err != nil {
+		return "", err
+	}
+	return v.AsString()
+}
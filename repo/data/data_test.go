@@ -0,0 +1,216 @@
+package data_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"go.yumnet.cloud/orangesea/repo/data"
+)
+
+const (
+	testCID  = "bafyreidfayvfuwqa7qlnopdjiqrxzs6blmoeu4rujcjtnci5beludirz2a"
+	testBlob = "bafkreibme22gw2h7y2h7tg2fhqotaqjucnbc24deqo72b6mkl2egezxhvy"
+)
+
+func equalJSON(t *testing.T, a []byte, b []byte) bool {
+	t.Helper()
+
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestJSONToCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"successfull case; scalars", `{"$type": "com.example.record", "text": "hello", "count": -42, "ok": true, "none": null}`},
+		{"successfull case; link", `{"ref": {"$link": "` + testCID + `"}}`},
+		{"successfull case; bytes", `{"data": {"$bytes": "AAECAwQ"}}`},
+		{"successfull case; empty bytes", `{"data": {"$bytes": ""}}`},
+		{"successfull case; blob", `{"image": {"$type": "blob", "ref": {"$link": "` + testBlob + `"}, "mimeType": "image/png", "size": 1024}}`},
+		{"successfull case; legacy blob", `{"image": {"cid": "` + testBlob + `", "mimeType": "image/png"}}`},
+		{"successfull case; nested", `{"a": [{"b": [1, 2, {"$link": "` + testCID + `"}]}, [], {}]}`},
+		{"successfull case; non-map", `[1, "two", {"$bytes": "AA"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := data.JSONToCBOR([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("JSONToCBOR() error = %v", err)
+			}
+
+			got, err := data.CBORToJSON(b)
+			if err != nil {
+				t.Fatalf("CBORToJSON() error = %v", err)
+			}
+			if !equalJSON(t, got, []byte(tt.json)) {
+				t.Errorf("CBORToJSON() = %s, want %s", got, tt.json)
+			}
+
+			again, err := data.JSONToCBOR(got)
+			if err != nil {
+				t.Fatalf("JSONToCBOR() error = %v", err)
+			}
+			if !bytes.Equal(again, b) {
+				t.Errorf("JSONToCBOR() is not deterministic")
+			}
+		})
+	}
+}
+
+func TestDecodeJSON_Failure(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"failure case; float", `{"score": 1.5}`},
+		{"failure case; float with exponent", `{"score": 1e3}`},
+		{"failure case; integer overflow", `{"count": 9223372036854775808}`},
+		{"failure case; $link is not a string", `{"ref": {"$link": 1}}`},
+		{"failure case; $link is not a CID", `{"ref": {"$link": "bafy"}}`},
+		{"failure case; $link with other keys", `{"ref": {"$link": "` + testCID + `", "x": 1}}`},
+		{"failure case; $bytes with padding", `{"data": {"$bytes": "AAE="}}`},
+		{"failure case; $bytes is not base64", `{"data": {"$bytes": "!!"}}`},
+		{"failure case; $bytes with other keys", `{"data": {"$bytes": "AA", "x": 1}}`},
+		{"failure case; $type is not a string", `{"$type": 1}`},
+		{"failure case; $type is empty", `{"$type": ""}`},
+		{"failure case; blob without ref", `{"$type": "blob", "mimeType": "image/png", "size": 1}`},
+		{"failure case; blob ref is not a link", `{"$type": "blob", "ref": "` + testBlob + `", "mimeType": "image/png", "size": 1}`},
+		{"failure case; blob without mimeType", `{"$type": "blob", "ref": {"$link": "` + testBlob + `"}, "size": 1}`},
+		{"failure case; blob with negative size", `{"$type": "blob", "ref": {"$link": "` + testBlob + `"}, "mimeType": "image/png", "size": -1}`},
+		{"failure case; trailing data", `{} {}`},
+		{"failure case; nested too deeply", strings.Repeat("[", data.MAX_DEPTH+2) + strings.Repeat("]", data.MAX_DEPTH+2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := data.DecodeJSON([]byte(tt.json)); err == nil {
+				t.Errorf("DecodeJSON() error = nil, wantErr true")
+			}
+		})
+	}
+}
+
+func TestDecodeCBOR_Float(t *testing.T) {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "score", qp.Float(1.5))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := dagcbor.Encode(n, buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := data.DecodeCBOR(buf.Bytes()); !errors.Is(err, data.ErrInvalidData) {
+		t.Errorf("DecodeCBOR() error = %v, want ErrInvalidData", err)
+	}
+	if _, err := data.EncodeCBOR(n); !errors.Is(err, data.ErrInvalidData) {
+		t.Errorf("EncodeCBOR() error = %v, want ErrInvalidData", err)
+	}
+	if _, err := data.EncodeJSON(n); !errors.Is(err, data.ErrInvalidData) {
+		t.Errorf("EncodeJSON() error = %v, want ErrInvalidData", err)
+	}
+}
+
+func TestRecordCID(t *testing.T) {
+	a, err := data.DecodeJSON([]byte(`{"$type": "com.example.record", "text": "hello", "count": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := data.DecodeJSON([]byte(`{"count": 1, "text": "hello", "$type": "com.example.record"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := data.RecordCID(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := data.RecordCID(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ca.Equals(cb) {
+		t.Errorf("RecordCID() = %s, want %s; key order must not matter", cb, ca)
+	}
+	if p := ca.Prefix(); p.Version != 1 || p.Codec != cid.DagCBOR {
+		t.Errorf("RecordCID() prefix = %v, want CIDv1 dag-cbor", p)
+	}
+
+	encoded, err := data.EncodeCBOR(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := data.CID(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equals(ca) {
+		t.Errorf("CID() = %s, want %s", c, ca)
+	}
+
+	if err := data.ValidateRecord(a); err != nil {
+		t.Errorf("ValidateRecord() error = %v", err)
+	}
+	noType, err := data.DecodeJSON([]byte(`{"text": "hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.ValidateRecord(noType); err == nil {
+		t.Errorf("ValidateRecord() error = nil, want missing $type")
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	n, err := data.DecodeJSON([]byte(`{
+		"$type": "com.example.record",
+		"avatar": {"$type": "blob", "ref": {"$link": "` + testBlob + `"}, "mimeType": "image/png", "size": 10},
+		"images": [{"image": {"$type": "blob", "ref": {"$link": "` + testCID + `"}, "mimeType": "image/jpeg", "size": 20}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := data.Blobs(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 2 {
+		t.Fatalf("Blobs() = %d blobs, want 2", len(blobs))
+	}
+	if blobs[0].Ref.String() != testBlob || blobs[0].MimeType != "image/png" || blobs[0].Size != 10 {
+		t.Errorf("Blobs()[0] = %+v", blobs[0])
+	}
+	if blobs[1].Ref.String() != testCID || blobs[1].Size != 20 {
+		t.Errorf("Blobs()[1] = %+v", blobs[1])
+	}
+
+	blobNode, err := blobs[0].Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := data.ParseBlob(blobNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, blobs[0]) {
+		t.Errorf("ParseBlob() = %+v, want %+v", got, blobs[0])
+	}
+}
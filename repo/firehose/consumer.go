@@ -0,0 +1,243 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	SUBSCRIBE_REPOS_PATH = "/xrpc/com.atproto.sync.subscribeRepos"
+
+	DEFAULT_MIN_BACKOFF = time.Second
+	DEFAULT_MAX_BACKOFF = time.Minute
+)
+
+// Handler handles an event of the stream
+// If it returns an error, the consumer stops with the error.
+type Handler func(ctx context.Context, e *Event) error
+
+// StreamError is the error sent by the server in an error frame
+type StreamError struct {
+	Frame *ErrorFrame
+}
+
+func (e *StreamError) Error() string {
+	return "stream error: " + e.Frame.String()
+}
+
+// fatalError is an error which stops the consumer without reconnecting
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+// Consumer consumes the repository event stream of a relay or a PDS
+// The cursor is saved after each event is handled, and the consumer
+// resumes from the saved cursor when it reconnects or restarts.
+type Consumer struct {
+	// URL is the base URL of the service, e.g. wss://bsky.network
+	// http and https schemes are converted into ws and wss.
+	URL string
+
+	// Cursor persists the cursor. If nil, the cursor is kept only in memory.
+	Cursor CursorStore
+
+	// Verifier verifies the events before they are handled. If nil, the events are not verified.
+	Verifier *Verifier
+
+	// OnInvalid is called with the events failed verification, which are skipped.
+	// The frames which cannot be decoded are skipped too, and e is nil for them.
+	OnInvalid func(e *Event, err error)
+
+	Dialer *websocket.Dialer
+
+	// MinBackoff and MaxBackoff are the bounds of the exponential backoff of reconnection.
+	// If zero, DEFAULT_MIN_BACKOFF and DEFAULT_MAX_BACKOFF are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewConsumer returns a new Consumer of the service
+func NewConsumer(serviceURL string) *Consumer {
+	return &Consumer{
+		URL:        serviceURL,
+		Cursor:     &MemCursor{},
+		Dialer:     websocket.DefaultDialer,
+		MinBackoff: DEFAULT_MIN_BACKOFF,
+		MaxBackoff: DEFAULT_MAX_BACKOFF,
+	}
+}
+
+// streamURL returns the URL of the stream from the cursor
+func (c *Consumer) streamURL(cursor int64) (string, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid service URL: %s; %w", c.URL, err)
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid service URL: %s; scheme must be ws, wss, http or https", c.URL)
+	}
+
+	u.Path = SUBSCRIBE_REPOS_PATH
+	u.RawQuery = ""
+	if cursor > 0 {
+		u.RawQuery = url.Values{"cursor": {strconv.FormatInt(cursor, 10)}}.Encode()
+	}
+	return u.String(), nil
+}
+
+// Run consumes the stream with the handler
+// It reconnects with backoff when the connection is lost, and returns when
+// the context is done, the handler returns an error, or the server sends an error frame (*StreamError).
+func (c *Consumer) Run(ctx context.Context, handler Handler) error {
+	cursorStore := c.Cursor
+	if cursorStore == nil {
+		cursorStore = &MemCursor{}
+	}
+	cursor, err := cursorStore.LoadCursor()
+	if err != nil {
+		return err
+	}
+
+	minBackoff, maxBackoff := c.MinBackoff, c.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = DEFAULT_MIN_BACKOFF
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DEFAULT_MAX_BACKOFF
+	}
+
+	backoff := minBackoff
+	for {
+		connected, err := c.consume(ctx, cursorStore, &cursor, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var fatal *fatalError
+		if errors.As(err, &fatal) {
+			return fatal.err
+		}
+
+		if connected {
+			backoff = minBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// consume connects to the stream and handles the events until the connection is lost
+// It returns true if the connection was established.
+func (c *Consumer) consume(ctx context.Context, cursorStore CursorStore, cursor *int64, handler Handler) (bool, error) {
+	u, err := c.streamURL(*cursor)
+	if err != nil {
+		return false, &fatalError{err}
+	}
+
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	conn, _, err := dialer.DialContext(ctx, u, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to stream; %w", err)
+	}
+	defer conn.Close()
+
+	// close the connection to unblock reading when the context is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		typ, b, err := conn.ReadMessage()
+		if err != nil {
+			return true, fmt.Errorf("failed to read stream; %w", err)
+		}
+		if typ != websocket.BinaryMessage {
+			continue
+		}
+
+		e, err := DecodeFrame(b)
+		if err != nil {
+			// skip the frame; reconnecting would receive the same frame again
+			if c.OnInvalid != nil {
+				c.OnInvalid(nil, err)
+			}
+			continue
+		}
+		if e.Error != nil {
+			return true, &fatalError{&StreamError{Frame: e.Error}}
+		}
+
+		seq := e.Seq()
+		if seq > 0 && seq <= *cursor {
+			// already handled before reconnecting
+			continue
+		}
+
+		if err := c.handle(ctx, e, handler); err != nil {
+			return true, &fatalError{err}
+		}
+
+		if seq > 0 {
+			*cursor = seq
+			if err := cursorStore.SaveCursor(seq); err != nil {
+				return true, &fatalError{err}
+			}
+		}
+	}
+}
+
+// handle verifies the event and calls the handler
+// The events of unknown types are skipped.
+func (c *Consumer) handle(ctx context.Context, e *Event, handler Handler) error {
+	if e.Commit == nil && e.Identity == nil && e.Account == nil && e.Sync == nil && e.Info == nil {
+		return nil
+	}
+
+	if c.Verifier != nil {
+		if err := c.Verifier.VerifyEvent(ctx, e); err != nil {
+			if c.OnInvalid != nil {
+				c.OnInvalid(e, err)
+			}
+			return nil
+		}
+	}
+
+	return handler(ctx, e)
+}
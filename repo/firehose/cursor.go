@@ -0,0 +1,103 @@
+package firehose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CursorStore persists the cursor of the stream, the sequence number of the last processed event
+type CursorStore interface {
+	// LoadCursor returns the saved cursor, or zero if there is no cursor
+	LoadCursor() (int64, error)
+	SaveCursor(seq int64) error
+}
+
+// MemCursor is an in-memory CursorStore
+// MemCursor is safe for concurrent use.
+type MemCursor struct {
+	mu  sync.Mutex
+	seq int64
+}
+
+// LoadCursor returns the saved cursor
+func (c *MemCursor) LoadCursor() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seq, nil
+}
+
+// SaveCursor saves the cursor
+func (c *MemCursor) SaveCursor(seq int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq = seq
+	return nil
+}
+
+// FileCursor is a CursorStore which stores the cursor as a decimal number in a file
+// The cursor is written atomically; it is written into a temporary file,
+// which is renamed to the file after it is synced.
+type FileCursor struct {
+	path string
+}
+
+// NewFileCursor returns a new FileCursor of the file
+func NewFileCursor(path string) *FileCursor {
+	return &FileCursor{
+		path: path,
+	}
+}
+
+// LoadCursor reads the cursor from the file
+// If the file does not exist, it returns zero.
+func (c *FileCursor) LoadCursor() (int64, error) {
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cursor; %w", err)
+	}
+
+	seq, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid cursor: %s; cursor must be a non-negative integer", c.path)
+	}
+	return seq, nil
+}
+
+// SaveCursor writes the cursor into the file atomically
+func (c *FileCursor) SaveCursor(seq int64) error {
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to save cursor; %w", err)
+	}
+	defer func() {
+		// this fails after the rename, which is expected
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.WriteString(strconv.FormatInt(seq, 10)); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save cursor; %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save cursor; %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save cursor; %w", err)
+	}
+
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save cursor; %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,654 @@
+package firehose_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	didresolver "go.yumnet.cloud/orangesea/did/resolver"
+	"go.yumnet.cloud/orangesea/repo"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/commit"
+	"go.yumnet.cloud/orangesea/repo/firehose"
+	"go.yumnet.cloud/orangesea/repo/internal/testutil"
+)
+
+const (
+	testDID        = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+	testCollection = "app.bsky.feed.post"
+	testTime       = "2024-01-02T03:04:05.678Z"
+)
+
+var testCID = cid.MustParse("bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// commitEvent applies the writes to the repository, and returns the #commit event of the commit
+func commitEvent(t *testing.T, r *repo.Repo, seq int64, writes []repo.Write) *firehose.Event {
+	t.Helper()
+
+	prev, _ := r.Commit()
+	prevCIDs := map[string]cid.Cid{}
+	for _, w := range writes {
+		if record, err := r.GetRecord(w.Collection, w.RKey); err == nil {
+			prevCIDs[w.Collection+"/"+w.RKey] = record.CID
+		}
+	}
+
+	result, err := r.ApplyWrites(writes)
+	if err != nil {
+		t.Fatalf("ApplyWrites() error = %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := blockstore.ExportCAR(result.Blocks, buf, []cid.Cid{result.CID}); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := make([]firehose.RepoOp, 0, len(result.Results))
+	for _, wr := range result.Results {
+		op := firehose.RepoOp{Action: wr.Action.String(), Path: wr.Path()}
+		if wr.CID.Defined() {
+			c := wr.CID
+			op.CID = &c
+		}
+		if c, ok := prevCIDs[wr.Path()]; ok {
+			op.Prev = &c
+		}
+		ops = append(ops, op)
+	}
+
+	prevData := prev.Data
+	return &firehose.Event{
+		Type: firehose.TYPE_COMMIT,
+		Commit: &firehose.CommitEvent{
+			Seq:      seq,
+			Repo:     r.DID(),
+			Commit:   result.CID,
+			Rev:      result.Commit.Rev,
+			Since:    strPtr(prev.Rev),
+			Blocks:   buf.Bytes(),
+			Ops:      ops,
+			Blobs:    []cid.Cid{},
+			PrevData: &prevData,
+			Time:     testTime,
+		},
+	}
+}
+
+func TestFrame_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		e    *firehose.Event
+	}{
+		{
+			name: "successfull case: #commit",
+			e: &firehose.Event{
+				Type: firehose.TYPE_COMMIT,
+				Commit: &firehose.CommitEvent{
+					Seq:    1,
+					Repo:   testDID,
+					Commit: testCID,
+					Rev:    "3jzfcijpj2z2a",
+					Blocks: []byte{},
+					Ops: []firehose.RepoOp{
+						{Action: "create", Path: testCollection + "/3jzfcijpj2z2a", CID: &testCID},
+						{Action: "delete", Path: testCollection + "/3jzfcijpj2z2b", Prev: &testCID},
+					},
+					Blobs: []cid.Cid{testCID},
+					Time:  testTime,
+				},
+			},
+		},
+		{
+			name: "successfull case: #identity",
+			e: &firehose.Event{
+				Type:     firehose.TYPE_IDENTITY,
+				Identity: &firehose.IdentityEvent{Seq: 2, DID: testDID, Time: testTime, Handle: strPtr("alice.test")},
+			},
+		},
+		{
+			name: "successfull case: #account",
+			e: &firehose.Event{
+				Type:    firehose.TYPE_ACCOUNT,
+				Account: &firehose.AccountEvent{Seq: 3, DID: testDID, Time: testTime, Status: strPtr("takendown")},
+			},
+		},
+		{
+			name: "successfull case: #sync",
+			e: &firehose.Event{
+				Type: firehose.TYPE_SYNC,
+				Sync: &firehose.SyncEvent{Seq: 4, DID: testDID, Blocks: []byte{1, 2, 3}, Rev: "3jzfcijpj2z2a", Time: testTime},
+			},
+		},
+		{
+			name: "successfull case: #info",
+			e: &firehose.Event{
+				Type: firehose.TYPE_INFO,
+				Info: &firehose.InfoEvent{Name: "OutdatedCursor"},
+			},
+		},
+		{
+			name: "successfull case: error",
+			e: &firehose.Event{
+				Error: &firehose.ErrorFrame{Error: "FutureCursor", Message: strPtr("cursor is in the future")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := firehose.EncodeFrame(tt.e)
+			if err != nil {
+				t.Fatalf("EncodeFrame() error = %v", err)
+			}
+			got, err := firehose.DecodeFrame(b)
+			if err != nil {
+				t.Fatalf("DecodeFrame() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.e) {
+				t.Errorf("DecodeFrame() = %+v, want %+v", got, tt.e)
+			}
+		})
+	}
+}
+
+// rawFrame encodes the header and the body maps into a frame
+func rawFrame(t *testing.T, op int64, typ string, body func(ma datamodel.MapAssembler)) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	header, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "op", qp.Int(op))
+		qp.MapEntry(ma, "t", qp.String(typ))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dagcbor.Encode(header, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagcbor.Encode(n, buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *firehose.Event
+		wantErr bool
+	}{
+		{
+			name: "successfull case: unknown fields are ignored",
+			b: rawFrame(t, firehose.OP_MESSAGE, firehose.TYPE_IDENTITY, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "seq", qp.Int(5))
+				qp.MapEntry(ma, "did", qp.String(testDID))
+				qp.MapEntry(ma, "time", qp.String(testTime))
+				qp.MapEntry(ma, "newField", qp.Bool(true))
+			}),
+			want: &firehose.Event{
+				Type:     firehose.TYPE_IDENTITY,
+				Identity: &firehose.IdentityEvent{Seq: 5, DID: testDID, Time: testTime},
+			},
+		},
+		{
+			name: "successfull case: unknown type",
+			b: rawFrame(t, firehose.OP_MESSAGE, "#future", func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "seq", qp.Int(6))
+			}),
+			want: &firehose.Event{Type: "#future"},
+		},
+		{
+			name: "failure case: missing field",
+			b: rawFrame(t, firehose.OP_MESSAGE, firehose.TYPE_IDENTITY, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "seq", qp.Int(5))
+			}),
+			wantErr: true,
+		},
+		{
+			name: "failure case: unknown operation",
+			b: rawFrame(t, 2, firehose.TYPE_INFO, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "name", qp.String("info"))
+			}),
+			wantErr: true,
+		},
+		{
+			name: "failure case: trailing data",
+			b: append(rawFrame(t, firehose.OP_MESSAGE, firehose.TYPE_INFO, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "name", qp.String("info"))
+			}), 0xa0),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := firehose.DecodeFrame(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeFrame() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeFrame() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyCommit(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	r, _, err := repo.NewRepo(testDID, key, blockstore.NewMemBlockstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var writes []repo.Write
+	for i := 0; i < 100; i++ {
+		writes = append(writes, repo.Write{
+			Action:     repo.ACTION_CREATE,
+			Collection: testCollection,
+			RKey:       fmt.Sprintf("record%04d", i),
+			Value:      testutil.Record(t, testCollection, fmt.Sprint(i)),
+		})
+	}
+	created := commitEvent(t, r, 1, writes)
+	changed := commitEvent(t, r, 2, []repo.Write{
+		{Action: repo.ACTION_UPDATE, Collection: testCollection, RKey: "record0010", Value: testutil.Record(t, testCollection, "updated")},
+		{Action: repo.ACTION_DELETE, Collection: testCollection, RKey: "record0020"},
+		{Action: repo.ACTION_CREATE, Collection: testCollection, RKey: "record1000", Value: testutil.Record(t, testCollection, "new")},
+	})
+
+	verifier := &firehose.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: key}}}
+	if err := verifier.VerifyEvent(context.Background(), created); err != nil {
+		t.Fatalf("VerifyEvent() error = %v", err)
+	}
+	if err := verifier.VerifyEvent(context.Background(), changed); err != nil {
+		t.Fatalf("VerifyEvent() error = %v", err)
+	}
+
+	t.Run("failure case: replayed commit", func(t *testing.T) {
+		if err := verifier.VerifyEvent(context.Background(), changed); err == nil {
+			t.Errorf("VerifyEvent() error = nil, wantErr true")
+		}
+	})
+
+	t.Run("failure case: operation not in the MST", func(t *testing.T) {
+		e := *changed.Commit
+		e.Ops = append([]firehose.RepoOp{}, e.Ops...)
+		e.Ops[2].Path = testCollection + "/record2000"
+
+		v := &firehose.Verifier{Commits: verifier.Commits}
+		if err := v.VerifyCommit(context.Background(), &e); err == nil {
+			t.Errorf("VerifyCommit() error = nil, wantErr true")
+		}
+	})
+
+	t.Run("failure case: missing operation", func(t *testing.T) {
+		e := *changed.Commit
+		e.Ops = e.Ops[:2]
+
+		v := &firehose.Verifier{Commits: verifier.Commits}
+		if err := v.VerifyCommit(context.Background(), &e); err == nil {
+			t.Errorf("VerifyCommit() error = nil, wantErr true")
+		}
+	})
+
+	t.Run("successfull case: identity event invalidates the cached key", func(t *testing.T) {
+		other := testutil.Key(t, "JkJ5gm2y4HqzrjumUCZ7X4hyqXT1CuhrV5QUZYxeRss")
+		dids := testutil.DIDs{testDID: other}
+		v := &firehose.Verifier{Commits: &commit.Verifier{DIDs: didresolver.NewCachedResolver(dids)}}
+		if err := v.VerifyEvent(context.Background(), created); err == nil {
+			t.Fatalf("VerifyEvent() with another key error = nil, wantErr true")
+		}
+
+		// the refresh is rate limited, so the updated document is not resolved without the #identity event
+		dids[testDID] = key
+		if err := v.VerifyEvent(context.Background(), created); err == nil {
+			t.Fatalf("VerifyEvent() with the cached key error = nil, wantErr true")
+		}
+
+		identity := &firehose.Event{Type: firehose.TYPE_IDENTITY, Identity: &firehose.IdentityEvent{Seq: 3, DID: testDID, Time: testTime}}
+		if err := v.VerifyEvent(context.Background(), identity); err != nil {
+			t.Fatalf("VerifyEvent() error = %v", err)
+		}
+		if err := v.VerifyEvent(context.Background(), created); err != nil {
+			t.Errorf("VerifyEvent() after #identity error = %v", err)
+		}
+	})
+
+	t.Run("failure case: signed by another key", func(t *testing.T) {
+		other := testutil.Key(t, "JkJ5gm2y4HqzrjumUCZ7X4hyqXT1CuhrV5QUZYxeRss")
+		v := &firehose.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: other}}}
+		if err := v.VerifyEvent(context.Background(), created); err == nil {
+			t.Errorf("VerifyEvent() error = nil, wantErr true")
+		}
+	})
+}
+
+// barrierDIDs blocks the resolutions until all the expected resolutions have started
+type barrierDIDs struct {
+	testutil.DIDs
+	sync.WaitGroup
+}
+
+func (d *barrierDIDs) Resolve(ctx context.Context, did string) (*didresolver.Document, error) {
+	d.Done()
+	d.Wait()
+	return d.DIDs.Resolve(ctx, did)
+}
+
+func TestVerifier_VerifyCommit_Concurrent(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	r, _, err := repo.NewRepo(testDID, key, blockstore.NewMemBlockstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := commitEvent(t, r, 1, []repo.Write{
+		{Action: repo.ACTION_CREATE, Collection: testCollection, RKey: "record0000", Value: testutil.Record(t, testCollection, "0")},
+	})
+
+	// the same commit is accepted only once, even if all the verifications read the head before any of them sets it
+	const n = 10
+	dids := &barrierDIDs{DIDs: testutil.DIDs{testDID: key}}
+	dids.Add(n)
+	v := &firehose.Verifier{Commits: &commit.Verifier{DIDs: dids}}
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- v.VerifyEvent(context.Background(), e)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	verified := 0
+	for err := range errs {
+		if err == nil {
+			verified++
+		}
+	}
+	if verified != 1 {
+		t.Errorf("VerifyEvent() succeeded %d times, want 1", verified)
+	}
+}
+
+func TestVerifier_MaxHeads(t *testing.T) {
+	const otherDID = "did:plc:44ybard66vv44zksje25o7dz"
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+
+	events := map[string]*firehose.Event{}
+	for _, did := range []string{testDID, otherDID} {
+		r, _, err := repo.NewRepo(did, key, blockstore.NewMemBlockstore())
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[did] = commitEvent(t, r, 1, []repo.Write{
+			{Action: repo.ACTION_CREATE, Collection: testCollection, RKey: "record0000", Value: testutil.Record(t, testCollection, "0")},
+		})
+	}
+
+	v := &firehose.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: key, otherDID: key}}, MaxHeads: 1}
+	if err := v.VerifyEvent(context.Background(), events[testDID]); err != nil {
+		t.Fatalf("VerifyEvent() error = %v", err)
+	}
+	if err := v.VerifyEvent(context.Background(), events[testDID]); err == nil {
+		t.Errorf("VerifyEvent() of replayed commit error = nil, wantErr true")
+	}
+
+	// the commit of testDID is forgotten, so its revision is not checked any more
+	if err := v.VerifyEvent(context.Background(), events[otherDID]); err != nil {
+		t.Fatalf("VerifyEvent() error = %v", err)
+	}
+	if err := v.VerifyEvent(context.Background(), events[testDID]); err != nil {
+		t.Errorf("VerifyEvent() of forgotten repository error = %v", err)
+	}
+	if err := v.VerifyEvent(context.Background(), events[otherDID]); err != nil {
+		t.Errorf("VerifyEvent() of forgotten repository error = %v", err)
+	}
+}
+
+type testFrame struct {
+	seq int64
+	b   []byte
+}
+
+func encodeFrames(t *testing.T, events ...*firehose.Event) []testFrame {
+	t.Helper()
+
+	frames := make([]testFrame, 0, len(events))
+	for _, e := range events {
+		b, err := firehose.EncodeFrame(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, testFrame{seq: e.Seq(), b: b})
+	}
+	return frames
+}
+
+// testServer is a local stand-in of the stream
+// It sends the frames after the cursor followed by the final error frame,
+// and drops the first connection after dropAfter frames.
+type testServer struct {
+	frames    []testFrame
+	dropAfter int
+	final     *firehose.ErrorFrame
+
+	mu      sync.Mutex
+	cursors []string
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != firehose.SUBSCRIBE_REPOS_PATH {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.cursors = append(s.cursors, r.URL.Query().Get("cursor"))
+	first := len(s.cursors) == 1
+	s.mu.Unlock()
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var cursor int64
+	fmt.Sscan(r.URL.Query().Get("cursor"), &cursor)
+
+	// start after the last frame of the cursor
+	start := 0
+	for i, f := range s.frames {
+		if f.seq != 0 && f.seq <= cursor {
+			start = i + 1
+		}
+	}
+
+	for i, f := range s.frames[start:] {
+		if first && i == s.dropAfter {
+			return
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, f.b); err != nil {
+			return
+		}
+	}
+
+	b, _ := firehose.EncodeFrame(&firehose.Event{Error: s.final})
+	_ = conn.WriteMessage(websocket.BinaryMessage, b)
+}
+
+func TestConsumer_Run(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	other := testutil.Key(t, "JkJ5gm2y4HqzrjumUCZ7X4hyqXT1CuhrV5QUZYxeRss")
+	r, _, err := repo.NewRepo(testDID, key, blockstore.NewMemBlockstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _, err := repo.NewRepo(testDID, other, blockstore.NewMemBlockstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(rk string) []repo.Write {
+		return []repo.Write{{Action: repo.ACTION_CREATE, Collection: testCollection, RKey: rk, Value: testutil.Record(t, testCollection, rk)}}
+	}
+	frames := encodeFrames(t,
+		commitEvent(t, r, 1, write("a")),
+		&firehose.Event{Type: firehose.TYPE_INFO, Info: &firehose.InfoEvent{Name: "info"}},
+		&firehose.Event{Type: firehose.TYPE_IDENTITY, Identity: &firehose.IdentityEvent{Seq: 2, DID: testDID, Time: testTime}},
+		commitEvent(t, forged, 3, write("forged")),
+		commitEvent(t, r, 4, write("b")),
+	)
+	frames = append(frames, testFrame{
+		b: rawFrame(t, firehose.OP_MESSAGE, "#future", func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "seq", qp.Int(6))
+		}),
+	})
+	frames = append(frames, encodeFrames(t,
+		&firehose.Event{Type: firehose.TYPE_ACCOUNT, Account: &firehose.AccountEvent{Seq: 5, DID: testDID, Time: testTime, Active: true}},
+	)...)
+
+	server := &testServer{
+		frames:    frames,
+		dropAfter: 3,
+		final:     &firehose.ErrorFrame{Error: "ConsumerTooSlow"},
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cursorPath := filepath.Join(t.TempDir(), "cursor")
+	c := firehose.NewConsumer(ts.URL)
+	c.Cursor = firehose.NewFileCursor(cursorPath)
+	c.Verifier = &firehose.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: key}}}
+	c.MinBackoff = 10 * time.Millisecond
+
+	var invalid []int64
+	c.OnInvalid = func(e *firehose.Event, err error) {
+		invalid = append(invalid, e.Seq())
+	}
+
+	var got []string
+	err = c.Run(context.Background(), func(ctx context.Context, e *firehose.Event) error {
+		got = append(got, fmt.Sprintf("%s:%d", e.Type, e.Seq()))
+		return nil
+	})
+
+	var streamErr *firehose.StreamError
+	if !errors.As(err, &streamErr) || streamErr.Frame.Error != "ConsumerTooSlow" {
+		t.Errorf("Run() error = %v, want ConsumerTooSlow", err)
+	}
+
+	want := []string{"#commit:1", "#info:0", "#identity:2", "#commit:4", "#account:5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() handled = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(invalid, []int64{3}) {
+		t.Errorf("Run() invalid = %v, want [3]", invalid)
+	}
+	if !reflect.DeepEqual(server.cursors, []string{"", "2"}) {
+		t.Errorf("Run() cursors = %v, want [ 2]", server.cursors)
+	}
+
+	cursor, err := firehose.NewFileCursor(cursorPath).LoadCursor()
+	if err != nil || cursor != 5 {
+		t.Errorf("LoadCursor() = %v, %v, want 5", cursor, err)
+	}
+}
+
+func TestConsumer_Run_HandlerError(t *testing.T) {
+	server := &testServer{
+		frames: encodeFrames(t,
+			&firehose.Event{Type: firehose.TYPE_IDENTITY, Identity: &firehose.IdentityEvent{Seq: 1, DID: testDID, Time: testTime}},
+		),
+		dropAfter: -1,
+		final:     &firehose.ErrorFrame{Error: "ConsumerTooSlow"},
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := firehose.NewConsumer(ts.URL)
+	wantErr := errors.New("handler error")
+	err := c.Run(context.Background(), func(ctx context.Context, e *firehose.Event) error {
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("Run() error = %v, want %v", err, wantErr)
+	}
+
+	cursor, _ := c.Cursor.LoadCursor()
+	if cursor != 0 {
+		t.Errorf("LoadCursor() = %v, want 0", cursor)
+	}
+}
+
+func TestConsumer_Run_InvalidFrame(t *testing.T) {
+	frames := encodeFrames(t,
+		&firehose.Event{Type: firehose.TYPE_IDENTITY, Identity: &firehose.IdentityEvent{Seq: 1, DID: testDID, Time: testTime}},
+	)
+	frames = append(frames, testFrame{b: []byte{0xff, 0x00, 0x01}})
+	frames = append(frames, encodeFrames(t,
+		&firehose.Event{Type: firehose.TYPE_IDENTITY, Identity: &firehose.IdentityEvent{Seq: 2, DID: testDID, Time: testTime}},
+	)...)
+
+	server := &testServer{
+		frames:    frames,
+		dropAfter: -1,
+		final:     &firehose.ErrorFrame{Error: "ConsumerTooSlow"},
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := firehose.NewConsumer(ts.URL)
+	c.MinBackoff = 10 * time.Millisecond
+
+	invalid := 0
+	c.OnInvalid = func(e *firehose.Event, err error) {
+		if e != nil || err == nil {
+			t.Errorf("OnInvalid() = %v, %v, want nil event and an error", e, err)
+		}
+		invalid++
+	}
+
+	var got []int64
+	err := c.Run(context.Background(), func(ctx context.Context, e *firehose.Event) error {
+		got = append(got, e.Seq())
+		return nil
+	})
+
+	var streamErr *firehose.StreamError
+	if !errors.As(err, &streamErr) {
+		t.Errorf("Run() error = %v, want ConsumerTooSlow", err)
+	}
+	if !reflect.DeepEqual(got, []int64{1, 2}) || invalid != 1 {
+		t.Errorf("Run() handled = %v, invalid = %d, want [1 2] and 1", got, invalid)
+	}
+	// the undecodable frame is skipped without reconnecting
+	if !reflect.DeepEqual(server.cursors, []string{""}) {
+		t.Errorf("Run() cursors = %v, want []", server.cursors)
+	}
+}
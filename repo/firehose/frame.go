@@ -0,0 +1,436 @@
+// the package firehose implements the repository event stream (com.atproto.sync.subscribeRepos)
+// https://atproto.com/specs/event-stream
+//
+// Each websocket message is a frame of two concatenated DAG-CBOR objects,
+// the header with the operation and the type of the message, followed by the body.
+
+package firehose
+
+import (
+	"bytes"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+const (
+	// operations of frames
+	OP_MESSAGE = 1
+	OP_ERROR   = -1
+
+	// types of message frames
+	TYPE_COMMIT   = "#commit"
+	TYPE_IDENTITY = "#identity"
+	TYPE_ACCOUNT  = "#account"
+	TYPE_SYNC     = "#sync"
+	TYPE_INFO     = "#info"
+)
+
+var (
+	HeaderSchema   schema.Type
+	ErrorSchema    schema.Type
+	CommitSchema   schema.Type
+	IdentitySchema schema.Type
+	AccountSchema  schema.Type
+	SyncSchema     schema.Type
+	InfoSchema     schema.Type
+)
+
+// bodySchemas are the schemas of the message bodies by the type
+var bodySchemas map[string]schema.Type
+
+func init() {
+	ts, err := ipld.LoadSchemaBytes([]byte(`
+		type Header struct {
+			op Int
+			t optional String
+		} representation map
+
+		type ErrorFrame struct {
+			error String
+			message optional String
+		} representation map
+
+		type RepoOp struct {
+			action String
+			path String
+			CID nullable Link (rename "cid")
+			prev optional Link
+		} representation map
+
+		type CommitEvent struct {
+			seq Int
+			rebase Bool
+			tooBig Bool
+			repo String
+			commit Link
+			rev String
+			since nullable String
+			blocks Bytes
+			ops [RepoOp]
+			blobs [Link]
+			prevData optional Link
+			time String
+		} representation map
+
+		type IdentityEvent struct {
+			seq Int
+			DID String (rename "did")
+			time String
+			handle optional String
+		} representation map
+
+		type AccountEvent struct {
+			seq Int
+			DID String (rename "did")
+			time String
+			active Bool
+			status optional String
+		} representation map
+
+		type SyncEvent struct {
+			seq Int
+			DID String (rename "did")
+			blocks Bytes
+			rev String
+			time String
+		} representation map
+
+		type InfoEvent struct {
+			name String
+			message optional String
+		} representation map
+	`))
+	if err != nil {
+		panic(err)
+	}
+
+	HeaderSchema = ts.TypeByName("Header")
+	ErrorSchema = ts.TypeByName("ErrorFrame")
+	CommitSchema = ts.TypeByName("CommitEvent")
+	IdentitySchema = ts.TypeByName("IdentityEvent")
+	AccountSchema = ts.TypeByName("AccountEvent")
+	SyncSchema = ts.TypeByName("SyncEvent")
+	InfoSchema = ts.TypeByName("InfoEvent")
+
+	bodySchemas = map[string]schema.Type{
+		TYPE_COMMIT:   CommitSchema,
+		TYPE_IDENTITY: IdentitySchema,
+		TYPE_ACCOUNT:  AccountSchema,
+		TYPE_SYNC:     SyncSchema,
+		TYPE_INFO:     InfoSchema,
+	}
+}
+
+// Header is the header of a frame
+// T is the type of the message, and is nil on error frames.
+type Header struct {
+	Op int64
+	T  *string
+}
+
+// ErrorFrame is the body of an error frame
+// The server closes the connection after sending an error frame.
+type ErrorFrame struct {
+	Error   string
+	Message *string
+}
+
+func (e *ErrorFrame) String() string {
+	if e.Message == nil {
+		return e.Error
+	}
+	return e.Error + ": " + *e.Message
+}
+
+// RepoOp is an operation on a record in a #commit event
+type RepoOp struct {
+	Action string // create, update or delete
+	Path   string
+	CID    *cid.Cid // nil on delete
+	Prev   *cid.Cid // the previous CID of the record on update and delete, if provided
+}
+
+// CommitEvent is the body of a #commit event
+// Blocks is a CAR of the commit, the MST nodes and the records changed by the commit.
+type CommitEvent struct {
+	Seq      int64
+	Rebase   bool // deprecated
+	TooBig   bool // deprecated
+	Repo     string
+	Commit   cid.Cid
+	Rev      string
+	Since    *string
+	Blocks   []byte
+	Ops      []RepoOp
+	Blobs    []cid.Cid
+	PrevData *cid.Cid // the MST root of the previous commit, if provided
+	Time     string
+}
+
+// IdentityEvent is the body of an #identity event
+type IdentityEvent struct {
+	Seq    int64
+	DID    string
+	Time   string
+	Handle *string
+}
+
+// AccountEvent is the body of an #account event
+type AccountEvent struct {
+	Seq    int64
+	DID    string
+	Time   string
+	Active bool
+	Status *string
+}
+
+// SyncEvent is the body of a #sync event
+// Blocks is a CAR of the commit only.
+type SyncEvent struct {
+	Seq    int64
+	DID    string
+	Blocks []byte
+	Rev    string
+	Time   string
+}
+
+// InfoEvent is the body of an #info event
+type InfoEvent struct {
+	Name    string
+	Message *string
+}
+
+// Event is a decoded frame
+// Exactly one of the bodies is set for the known types;
+// on unknown types, only Type is set so that the event can be skipped.
+type Event struct {
+	Type string // empty on error frames
+
+	Commit   *CommitEvent
+	Identity *IdentityEvent
+	Account  *AccountEvent
+	Sync     *SyncEvent
+	Info     *InfoEvent
+	Error    *ErrorFrame
+}
+
+// Seq returns the sequence number of the event, or zero if the event has no sequence number
+func (e *Event) Seq() int64 {
+	switch {
+	case e.Commit != nil:
+		return e.Commit.Seq
+	case e.Identity != nil:
+		return e.Identity.Seq
+	case e.Account != nil:
+		return e.Account.Seq
+	case e.Sync != nil:
+		return e.Sync.Seq
+	}
+	return 0
+}
+
+// body returns the body of the event and its schema
+func (e *Event) body() (interface{}, schema.Type, error) {
+	var body interface{}
+	var isNil bool
+	switch e.Type {
+	case TYPE_COMMIT:
+		body, isNil = e.Commit, e.Commit == nil
+	case TYPE_IDENTITY:
+		body, isNil = e.Identity, e.Identity == nil
+	case TYPE_ACCOUNT:
+		body, isNil = e.Account, e.Account == nil
+	case TYPE_SYNC:
+		body, isNil = e.Sync, e.Sync == nil
+	case TYPE_INFO:
+		body, isNil = e.Info, e.Info == nil
+	default:
+		return nil, nil, fmt.Errorf("invalid event; unknown type: %s", e.Type)
+	}
+
+	if isNil {
+		return nil, nil, fmt.Errorf("invalid event; body of %s is nil", e.Type)
+	}
+	return body, bodySchemas[e.Type], nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}, typ schema.Type) error {
+	if err := dagcbor.Encode(bindnode.Wrap(v, typ).Representation(), buf); err != nil {
+		return fmt.Errorf("failed to encode %s; %w", typ.Name(), err)
+	}
+	return nil
+}
+
+// EncodeFrame encodes the event into a frame
+func EncodeFrame(e *Event) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	if e.Error != nil {
+		if err := encode(buf, &Header{Op: OP_ERROR}, HeaderSchema); err != nil {
+			return nil, err
+		}
+		if err := encode(buf, e.Error, ErrorSchema); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	body, typ, err := e.body()
+	if err != nil {
+		return nil, err
+	}
+
+	t := e.Type
+	if err := encode(buf, &Header{Op: OP_MESSAGE, T: &t}, HeaderSchema); err != nil {
+		return nil, err
+	}
+	if err := encode(buf, body, typ); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode decodes the next DAG-CBOR object of the reader with the schema,
+// and returns the pointer to the Go value of the type of ptr
+// Unknown fields of the object are ignored for forward compatibility.
+func decode(r *bytes.Reader, ptr interface{}, typ schema.Type) (interface{}, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	opts := dagcbor.DecodeOptions{AllowLinks: true, DontParseBeyondEnd: true}
+	if err := opts.Decode(nb, r); err != nil {
+		return nil, fmt.Errorf("failed to decode %s; %w", typ.Name(), err)
+	}
+
+	n, err := knownFields(nb.Build(), typ)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s; %w", typ.Name(), err)
+	}
+
+	builder := bindnode.Prototype(ptr, typ).Representation().NewBuilder()
+	if err := datamodel.Copy(n, builder); err != nil {
+		return nil, fmt.Errorf("failed to decode %s; %w", typ.Name(), err)
+	}
+	return bindnode.Unwrap(builder.Build()), nil
+}
+
+// knownFields returns the map node with only the fields of the struct type
+func knownFields(n datamodel.Node, typ schema.Type) (datamodel.Node, error) {
+	if n.Kind() != datamodel.Kind_Map {
+		return nil, fmt.Errorf("expected a map, got %s", n.Kind())
+	}
+
+	st := typ.(*schema.TypeStruct)
+	repr := st.RepresentationStrategy().(schema.StructRepresentation_Map)
+	known := make(map[string]bool, len(st.Fields()))
+	for _, f := range st.Fields() {
+		known[repr.GetFieldKey(f)] = true
+	}
+
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(n.Length())
+	if err != nil {
+		return nil, err
+	}
+
+	it := n.MapIterator()
+	for !it.Done() {
+		k, v, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		key, err := k.AsString()
+		if err != nil {
+			return nil, err
+		}
+		if !known[key] {
+			continue
+		}
+		if err := ma.AssembleKey().AssignString(key); err != nil {
+			return nil, err
+		}
+		if err := ma.AssembleValue().AssignNode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+
+	return nb.Build(), nil
+}
+
+// DecodeFrame decodes the frame into the event
+// The frames of unknown types are decoded into the events with only Type set.
+func DecodeFrame(b []byte) (*Event, error) {
+	r := bytes.NewReader(b)
+
+	v, err := decode(r, (*Header)(nil), HeaderSchema)
+	if err != nil {
+		return nil, err
+	}
+	header := v.(*Header)
+
+	e := &Event{}
+	switch header.Op {
+	case OP_ERROR:
+		v, err := decode(r, (*ErrorFrame)(nil), ErrorSchema)
+		if err != nil {
+			return nil, err
+		}
+		e.Error = v.(*ErrorFrame)
+
+	case OP_MESSAGE:
+		if header.T == nil {
+			return nil, fmt.Errorf("invalid frame; message type is missing")
+		}
+		e.Type = *header.T
+
+		var v interface{}
+		var err error
+		switch e.Type {
+		case TYPE_COMMIT:
+			v, err = decode(r, (*CommitEvent)(nil), CommitSchema)
+		case TYPE_IDENTITY:
+			v, err = decode(r, (*IdentityEvent)(nil), IdentitySchema)
+		case TYPE_ACCOUNT:
+			v, err = decode(r, (*AccountEvent)(nil), AccountSchema)
+		case TYPE_SYNC:
+			v, err = decode(r, (*SyncEvent)(nil), SyncSchema)
+		case TYPE_INFO:
+			v, err = decode(r, (*InfoEvent)(nil), InfoSchema)
+		default:
+			// unknown types are skipped without decoding the body
+			return e, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := v.(type) {
+		case *CommitEvent:
+			e.Commit = v
+		case *IdentityEvent:
+			e.Identity = v
+		case *AccountEvent:
+			e.Account = v
+		case *SyncEvent:
+			e.Sync = v
+		case *InfoEvent:
+			e.Info = v
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid frame; unknown operation: %d", header.Op)
+	}
+
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("invalid frame; %d bytes of trailing data", r.Len())
+	}
+	return e, nil
+}
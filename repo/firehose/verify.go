@@ -0,0 +1,260 @@
+package firehose
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/commit"
+	"go.yumnet.cloud/orangesea/repo/mst"
+)
+
+const (
+	// actions of repository operations
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+	ACTION_DELETE = "delete"
+)
+
+const DEFAULT_MAX_HEADS = 100000
+
+// Verifier verifies the events of the stream
+// It keeps the last verified commit of each repository,
+// so that the revisions of the commits of a repository are checked to be increasing.
+// The commits of the least recently updated repositories are forgotten when it keeps MaxHeads commits,
+// and the revisions of their next commits are not checked.
+// Verifier is safe for concurrent use.
+type Verifier struct {
+	Commits  *commit.Verifier
+	MaxHeads int // zero for no limit
+
+	mu    sync.Mutex
+	heads map[string]*list.Element // of *commit.Commit
+	lru   list.List                // the front is the most recently updated
+}
+
+// NewVerifier returns a new Verifier with the default DID resolver
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Commits:  commit.NewVerifier(),
+		MaxHeads: DEFAULT_MAX_HEADS,
+	}
+}
+
+func (v *Verifier) head(did string) *commit.Commit {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if e, ok := v.heads[did]; ok {
+		return e.Value.(*commit.Commit)
+	}
+	return nil
+}
+
+// setHead sets the last verified commit of the repository,
+// and forgets the commits of the least recently updated repositories over MaxHeads
+// If newer is set, the commit must be newer than the current one,
+// as another commit of the repository may have been verified concurrently.
+func (v *Verifier) setHead(c *commit.Commit, newer bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if e, ok := v.heads[c.DID]; ok {
+		head := e.Value.(*commit.Commit)
+		if newer && c.Rev <= head.Rev {
+			return fmt.Errorf("invalid event; rev %s must be greater than previous rev %s", c.Rev, head.Rev)
+		}
+		e.Value = c
+		v.lru.MoveToFront(e)
+		return nil
+	}
+
+	if v.heads == nil {
+		v.heads = make(map[string]*list.Element)
+	}
+	v.heads[c.DID] = v.lru.PushFront(c)
+	for v.MaxHeads > 0 && v.lru.Len() > v.MaxHeads {
+		oldest := v.lru.Back()
+		v.lru.Remove(oldest)
+		delete(v.heads, oldest.Value.(*commit.Commit).DID)
+	}
+	return nil
+}
+
+// invalidator removes cached DID documents, e.g. *didresolver.CachedResolver
+type invalidator interface {
+	Invalidate(did string)
+}
+
+// VerifyEvent verifies the #commit and #sync events
+// The other events have nothing to verify, and always pass.
+// On #identity events, the cached document of the DID is invalidated if the DID resolver has a cache.
+func (v *Verifier) VerifyEvent(ctx context.Context, e *Event) error {
+	switch {
+	case e.Commit != nil:
+		return v.VerifyCommit(ctx, e.Commit)
+	case e.Sync != nil:
+		return v.VerifySync(ctx, e.Sync)
+	case e.Identity != nil:
+		if c, ok := v.Commits.DIDs.(invalidator); ok {
+			c.Invalidate(e.Identity.DID)
+		}
+	}
+	return nil
+}
+
+// readCommit reads the blocks of the CAR, and decodes the commit of its root
+func readCommit(b []byte, root *cid.Cid) (*commit.Commit, *blockstore.MemBlockstore, error) {
+	blocks := blockstore.NewMemBlockstore()
+	roots, err := blockstore.ImportCAR(blocks, bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid event; %w", err)
+	}
+	if len(roots) != 1 {
+		return nil, nil, fmt.Errorf("invalid event; CAR must have exactly one root, got %d", len(roots))
+	}
+	if root != nil && !roots[0].Equals(*root) {
+		return nil, nil, fmt.Errorf("invalid event; CAR root %s does not match the commit %s", roots[0], *root)
+	}
+
+	data, err := blocks.Get(roots[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid event; commit block is missing: %s", roots[0])
+	}
+	c, err := commit.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, blocks, nil
+}
+
+// VerifyCommit verifies the #commit event
+// It checks the commit is signed by the signing key of the repository,
+// the revision is greater than the last verified commit of the repository,
+// and the operations match the MST of the commit.
+// If the event has prevData, it also inverts the operations on the MST,
+// and checks the result matches the MST of the previous commit.
+func (v *Verifier) VerifyCommit(ctx context.Context, e *CommitEvent) error {
+	c, blocks, err := readCommit(e.Blocks, &e.Commit)
+	if err != nil {
+		return err
+	}
+	if c.DID != e.Repo {
+		return fmt.Errorf("invalid event; commit is of another DID: %s", c.DID)
+	}
+	if c.Rev != e.Rev {
+		return fmt.Errorf("invalid event; rev %s does not match the commit rev %s", e.Rev, c.Rev)
+	}
+
+	if err := v.Commits.Verify(ctx, c, v.head(e.Repo)); err != nil {
+		return err
+	}
+
+	tree, err := mst.LoadTree(blocks, c.Data)
+	if err != nil {
+		return fmt.Errorf("invalid event; %w", err)
+	}
+
+	for _, op := range e.Ops {
+		if err := verifyOp(tree, op); err != nil {
+			return err
+		}
+	}
+
+	if e.PrevData != nil {
+		if err := invertOps(tree, e.Ops, *e.PrevData); err != nil {
+			return err
+		}
+	}
+
+	return v.setHead(c, true)
+}
+
+// verifyOp checks the operation matches the MST
+func verifyOp(tree *mst.Tree, op RepoOp) error {
+	val, err := tree.Get(op.Path)
+	if err != nil && !errors.Is(err, mst.ErrNotFound) {
+		return fmt.Errorf("invalid event; %w", err)
+	}
+
+	switch op.Action {
+	case ACTION_CREATE, ACTION_UPDATE:
+		if op.CID == nil {
+			return fmt.Errorf("invalid event; CID of %s operation is missing: %s", op.Action, op.Path)
+		}
+		if errors.Is(err, mst.ErrNotFound) || !val.Equals(*op.CID) {
+			return fmt.Errorf("invalid event; %s operation does not match the MST: %s", op.Action, op.Path)
+		}
+	case ACTION_DELETE:
+		if !errors.Is(err, mst.ErrNotFound) {
+			return fmt.Errorf("invalid event; deleted record is in the MST: %s", op.Path)
+		}
+	default:
+		return fmt.Errorf("invalid event; unknown action: %s", op.Action)
+	}
+	return nil
+}
+
+// invertOps inverts the operations on the MST,
+// and checks the root of the result is the previous MST root
+func invertOps(tree *mst.Tree, ops []RepoOp, prevData cid.Cid) error {
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+
+		var err error
+		switch op.Action {
+		case ACTION_CREATE:
+			err = tree.Delete(op.Path)
+		case ACTION_UPDATE:
+			if op.Prev == nil {
+				return fmt.Errorf("invalid event; prev of update operation is missing: %s", op.Path)
+			}
+			err = tree.Update(op.Path, *op.Prev)
+		case ACTION_DELETE:
+			if op.Prev == nil {
+				return fmt.Errorf("invalid event; prev of delete operation is missing: %s", op.Path)
+			}
+			err = tree.Insert(op.Path, *op.Prev)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid event; failed to invert %s operation: %s; %w", op.Action, op.Path, err)
+		}
+	}
+
+	root, err := tree.Root()
+	if err != nil {
+		return fmt.Errorf("invalid event; %w", err)
+	}
+	if !root.Equals(prevData) {
+		return fmt.Errorf("invalid event; inverted MST root %s does not match prevData %s", root, prevData)
+	}
+	return nil
+}
+
+// VerifySync verifies the #sync event
+// It checks the commit is signed by the signing key of the repository.
+// As the #sync event resets the state of the repository,
+// the revision is not compared with the last verified commit.
+func (v *Verifier) VerifySync(ctx context.Context, e *SyncEvent) error {
+	c, _, err := readCommit(e.Blocks, nil)
+	if err != nil {
+		return err
+	}
+	if c.DID != e.DID {
+		return fmt.Errorf("invalid event; commit is of another DID: %s", c.DID)
+	}
+	if c.Rev != e.Rev {
+		return fmt.Errorf("invalid event; rev %s does not match the commit rev %s", e.Rev, c.Rev)
+	}
+
+	if err := v.Commits.Verify(ctx, c, nil); err != nil {
+		return err
+	}
+
+	return v.setHead(c, false)
+}
@@ -0,0 +1,227 @@
+// the package format validates the string formats of Lexicon
+// https://atproto.com/specs/lexicon#string-formats
+
+package format
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.yumnet.cloud/orangesea/repo/nsid"
+	"go.yumnet.cloud/orangesea/repo/rkey"
+)
+
+// string formats
+const (
+	AT_IDENTIFIER = "at-identifier"
+	AT_URI        = "at-uri"
+	CID           = "cid"
+	DATETIME      = "datetime"
+	DID           = "did"
+	HANDLE        = "handle"
+	NSID          = "nsid"
+	TID           = "tid"
+	RECORD_KEY    = "record-key"
+	URI           = "uri"
+	LANGUAGE      = "language"
+)
+
+const (
+	MAX_DID_LENGTH    = 2048
+	MAX_HANDLE_LENGTH = 253
+	MAX_URI_LENGTH    = 8192
+)
+
+var ErrUnknownFormat = errors.New("unknown string format")
+
+var (
+	didPattern      = regexp.MustCompile(`^did:[a-z]+:[a-zA-Z0-9._:%-]*[a-zA-Z0-9._-]$`)
+	handlePattern   = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	datetimePattern = regexp.MustCompile(`^[0-9]{4}-[01][0-9]-[0-3][0-9]T[0-2][0-9]:[0-6][0-9]:[0-6][0-9](\.[0-9]{1,20})?(Z|([+-][0-2][0-9]:[0-5][0-9]))$`)
+	languagePattern = regexp.MustCompile(`^(i|[a-z]{2,3})(-[a-zA-Z0-9]{1,8})*$`)
+	cidPattern      = regexp.MustCompile(`^[a-zA-Z0-9+=]{8,256}$`)
+	uriPattern      = regexp.MustCompile(`^[a-z][a-z0-9+.-]*:[^\s]+$`)
+	fragmentPattern = regexp.MustCompile(`^/[a-zA-Z0-9._~:@!$&%')(*+,;=\[\]/\\-]*$`)
+)
+
+// Known returns true if the string format is known
+func Known(format string) bool {
+	switch format {
+	case AT_IDENTIFIER, AT_URI, CID, DATETIME, DID, HANDLE, NSID, TID, RECORD_KEY, URI, LANGUAGE:
+		return true
+	}
+	return false
+}
+
+// Validate validates the string against the string format
+// If the format is unknown, it returns ErrUnknownFormat.
+func Validate(format string, s string) error {
+	switch format {
+	case AT_IDENTIFIER:
+		return ValidateATIdentifier(s)
+	case AT_URI:
+		return ValidateATURI(s)
+	case CID:
+		return ValidateCID(s)
+	case DATETIME:
+		return ValidateDatetime(s)
+	case DID:
+		return ValidateDID(s)
+	case HANDLE:
+		return ValidateHandle(s)
+	case NSID:
+		return ValidateNSID(s)
+	case TID:
+		return ValidateTID(s)
+	case RECORD_KEY:
+		return ValidateRecordKey(s)
+	case URI:
+		return ValidateURI(s)
+	case LANGUAGE:
+		return ValidateLanguage(s)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+// ValidateATIdentifier validates the DID or the handle
+func ValidateATIdentifier(s string) error {
+	if strings.HasPrefix(s, "did:") {
+		return ValidateDID(s)
+	}
+	return ValidateHandle(s)
+}
+
+// ValidateDID validates the DID of any method
+func ValidateDID(s string) error {
+	if len(s) > MAX_DID_LENGTH || !didPattern.MatchString(s) {
+		return fmt.Errorf("invalid did: %s", s)
+	}
+	return nil
+}
+
+// ValidateHandle validates the handle; the syntax only, without the disallowed TLDs
+func ValidateHandle(s string) error {
+	if len(s) > MAX_HANDLE_LENGTH || !handlePattern.MatchString(s) {
+		return fmt.Errorf("invalid handle: %s", s)
+	}
+	return nil
+}
+
+// ValidateNSID validates the NSID without glob and fragment
+func ValidateNSID(s string) error {
+	id, err := nsid.NewNSID(s)
+	if err != nil {
+		return err
+	}
+	if id.Glob() || id.Fragment() != "" {
+		return fmt.Errorf("invalid nsid: %s; must not have glob or fragment", s)
+	}
+	return nil
+}
+
+// ValidateCID validates the CID in the string representation; the syntax only
+// CIDv0 (base58btc starting with "Qmb") is not allowed.
+func ValidateCID(s string) error {
+	if !cidPattern.MatchString(s) {
+		return fmt.Errorf("invalid cid: %s", s)
+	}
+	if strings.HasPrefix(s, "Qmb") {
+		return fmt.Errorf("invalid cid: %s; CIDv0 is not allowed", s)
+	}
+	return nil
+}
+
+// ValidateTID validates the TID
+func ValidateTID(s string) error {
+	_, err := rkey.ParseTID(s)
+	return err
+}
+
+// ValidateRecordKey validates the record key of any type
+func ValidateRecordKey(s string) error {
+	_, err := rkey.NewAny(s)
+	return err
+}
+
+// ValidateLanguage validates the BCP-47 language tag; the syntax only
+func ValidateLanguage(s string) error {
+	if !languagePattern.MatchString(s) {
+		return fmt.Errorf("invalid language: %s", s)
+	}
+	return nil
+}
+
+// ValidateDatetime validates the datetime in the subset of RFC 3339 with the required timezone
+func ValidateDatetime(s string) error {
+	if !datetimePattern.MatchString(s) {
+		return fmt.Errorf("invalid datetime: %s", s)
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("invalid datetime: %s", s)
+	}
+	if strings.HasSuffix(s, "-00:00") {
+		return fmt.Errorf("invalid datetime: %s; -00:00 timezone is not allowed", s)
+	}
+	if t.UTC().Year() < 0 {
+		return fmt.Errorf("invalid datetime: %s; before year 0", s)
+	}
+	return nil
+}
+
+// ValidateATURI validates the at-uri of `at://<authority>[/<collection>[/<rkey>]][#/<fragment>]`
+func ValidateATURI(s string) error {
+	if len(s) > MAX_URI_LENGTH {
+		return fmt.Errorf("invalid at-uri: %s; too long", s)
+	}
+
+	rest, ok := strings.CutPrefix(s, "at://")
+	if !ok {
+		return fmt.Errorf("invalid at-uri: %s; scheme must be at", s)
+	}
+	rest, fragment, ok := strings.Cut(rest, "#")
+	if ok && !fragmentPattern.MatchString(fragment) {
+		return fmt.Errorf("invalid at-uri: %s; invalid fragment", s)
+	}
+	if strings.Contains(rest, "?") {
+		return fmt.Errorf("invalid at-uri: %s; query is not allowed", s)
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid at-uri: %s; too many path segments", s)
+	}
+
+	if err := ValidateATIdentifier(parts[0]); err != nil {
+		return fmt.Errorf("invalid at-uri: %s; %w", s, err)
+	}
+	if len(parts) > 1 {
+		if err := ValidateNSID(parts[1]); err != nil {
+			return fmt.Errorf("invalid at-uri: %s; %w", s, err)
+		}
+	}
+	if len(parts) > 2 {
+		if err := ValidateRecordKey(parts[2]); err != nil {
+			return fmt.Errorf("invalid at-uri: %s; %w", s, err)
+		}
+	}
+	return nil
+}
+
+// ValidateURI validates the generic URI with a scheme
+func ValidateURI(s string) error {
+	if len(s) > MAX_URI_LENGTH {
+		return fmt.Errorf("invalid uri: %s; too long", s)
+	}
+	if !uriPattern.MatchString(s) {
+		return fmt.Errorf("invalid uri: %s", s)
+	}
+	if _, err := url.Parse(s); err != nil {
+		return fmt.Errorf("invalid uri: %s", s)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package format_test
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/repo/format"
+)
+
+// readFixtures reads the lines of the atproto interop syntax fixture in testdata
+// https://github.com/bluesky-social/atproto-interop-tests/tree/main/syntax
+func readFixtures(t *testing.T, name string) []string {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestValidate_Interop(t *testing.T) {
+	tests := []struct {
+		format  string
+		valid   []string
+		invalid []string
+	}{
+		{format.AT_IDENTIFIER, []string{"atidentifier_syntax_valid.txt"}, []string{"atidentifier_syntax_invalid.txt"}},
+		{format.AT_URI, []string{"aturi_syntax_valid.txt"}, []string{"aturi_syntax_invalid.txt"}},
+		{format.CID, []string{"cid_syntax_valid.txt"}, []string{"cid_syntax_invalid.txt"}},
+		{format.DATETIME, []string{"datetime_syntax_valid.txt"}, []string{"datetime_syntax_invalid.txt", "datetime_parse_invalid.txt"}},
+		{format.DID, []string{"did_syntax_valid.txt"}, []string{"did_syntax_invalid.txt"}},
+		{format.HANDLE, []string{"handle_syntax_valid.txt"}, []string{"handle_syntax_invalid.txt"}},
+		{format.NSID, []string{"nsid_syntax_valid.txt"}, []string{"nsid_syntax_invalid.txt"}},
+		{format.TID, []string{"tid_syntax_valid.txt"}, []string{"tid_syntax_invalid.txt"}},
+		{format.RECORD_KEY, []string{"recordkey_syntax_valid.txt"}, []string{"recordkey_syntax_invalid.txt"}},
+		{format.URI, []string{"uri_syntax_valid.txt"}, []string{"uri_syntax_invalid.txt"}},
+		{format.LANGUAGE, []string{"language_syntax_valid.txt"}, []string{"language_syntax_invalid.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			for _, name := range tt.valid {
+				for _, s := range readFixtures(t, name) {
+					if err := format.Validate(tt.format, s); err != nil {
+						t.Errorf("Validate(%q) error = %v, want valid", s, err)
+					}
+				}
+			}
+			for _, name := range tt.invalid {
+				for _, s := range readFixtures(t, name) {
+					if err := format.Validate(tt.format, s); err == nil {
+						t.Errorf("Validate(%q) error = nil, want invalid", s)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_UnknownFormat(t *testing.T) {
+	if err := format.Validate("email", "a@example.com"); !errors.Is(err, format.ErrUnknownFormat) {
+		t.Errorf("Validate() error = %v, want ErrUnknownFormat", err)
+	}
+	if format.Known("email") || !format.Known(format.DATETIME) {
+		t.Errorf("Known() is wrong")
+	}
+}
@@ -0,0 +1,67 @@
+// the package testutil provides the fixtures shared by the tests of the repository packages
+
+package testutil
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	didresolver "go.yumnet.cloud/orangesea/did/resolver"
+)
+
+// Key returns the key of the base64url encoded private key
+func Key(t *testing.T, privateKey string) *didkey.DIDKey {
+	t.Helper()
+
+	d, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := didkey.NewDIDKeyFromPrivateKey(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Record returns a record of the type with the text
+func Record(t *testing.T, typ string, text string) datamodel.Node {
+	t.Helper()
+
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "$type", qp.String(typ))
+		qp.MapEntry(ma, "text", qp.String(text))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// DIDs resolves the DIDs to the documents with their signing keys
+type DIDs map[string]*didkey.DIDKey
+
+func (d DIDs) Resolve(ctx context.Context, did string) (*didresolver.Document, error) {
+	key, ok := d[did]
+	if !ok {
+		return nil, fmt.Errorf("DID not found: %s", did)
+	}
+
+	return &didresolver.Document{
+		ID: did,
+		VerificationMethod: []didresolver.VerificationMethod{
+			{
+				ID:                 did + "#atproto",
+				Type:               "Multikey",
+				Controller:         did,
+				PublicKeyMultibase: key.DID()[len("did:key:"):],
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,247 @@
+package lexicon
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+var (
+	ErrNotFound    = errors.New("lexicon not found")
+	ErrExists      = errors.New("lexicon already exists")
+	ErrDanglingRef = errors.New("dangling ref")
+	ErrRefCycle    = errors.New("ref cycle")
+)
+
+// Catalog is an in-memory collection of Lexicons keyed by NSID
+// Catalog is safe for concurrent use.
+type Catalog struct {
+	mu       sync.RWMutex
+	lexicons map[string]*Lexicon
+}
+
+// NewCatalog returns a new empty Catalog
+func NewCatalog() *Catalog {
+	return &Catalog{
+		lexicons: make(map[string]*Lexicon),
+	}
+}
+
+// catalogKey returns the key of the Lexicon of the NSID; the canonical NSID without fragment
+func catalogKey(id *nsid.NSID) string {
+	return strings.Join(id.DSegments(), ".") + "." + id.Name()
+}
+
+// Add adds the Lexicon to the catalog
+// If a Lexicon with the same ID exists, it returns ErrExists.
+func (c *Catalog) Add(lex *Lexicon) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := catalogKey(lex.ID)
+	if _, ok := c.lexicons[key]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, lex.ID)
+	}
+	c.lexicons[key] = lex
+	return nil
+}
+
+// AddJSON parses the Lexicon JSON document and adds it to the catalog
+func (c *Catalog) AddJSON(b []byte) (*Lexicon, error) {
+	lex, err := Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Add(lex); err != nil {
+		return nil, err
+	}
+	return lex, nil
+}
+
+// LoadFS adds all Lexicon JSON documents (*.json) in the file system to the catalog,
+// and checks all refs are resolvable
+func (c *Catalog) LoadFS(fsys fs.FS) error {
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != ".json" {
+			return nil
+		}
+
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		if _, err := c.AddJSON(b); err != nil {
+			return fmt.Errorf("failed to load Lexicon: %s; %w", p, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Check()
+}
+
+// Lexicon returns the Lexicon of the NSID
+// The fragment of the NSID is ignored. If the Lexicon is not found, it returns ErrNotFound.
+func (c *Catalog) Lexicon(id *nsid.NSID) (*Lexicon, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	lex, ok := c.lexicons[catalogKey(id)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return lex, nil
+}
+
+// IDs returns the IDs of the Lexicons in the catalog in sorted order
+func (c *Catalog) IDs() []*nsid.NSID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]*nsid.NSID, 0, len(c.lexicons))
+	for _, lex := range c.lexicons {
+		ids = append(ids, lex.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+	return ids
+}
+
+// Def returns the definition referenced by the NSID
+// The fragment of the NSID is the name of the definition, or "main" if the NSID has no fragment.
+// If the definition is not found, it returns ErrDanglingRef.
+func (c *Catalog) Def(ref *nsid.NSID) (Def, error) {
+	lex, err := c.Lexicon(ref)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s; %v", ErrDanglingRef, ref, err)
+	}
+
+	name := ref.Fragment()
+	if name == "" {
+		name = MAIN
+	}
+	def, ok := lex.Defs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s; definition not found", ErrDanglingRef, ref)
+	}
+	return def, nil
+}
+
+// Resolve returns the definition referenced by the NSID,
+// following the chain of definitions which are refs themselves
+// If the chain references a definition twice, it returns ErrRefCycle.
+func (c *Catalog) Resolve(ref *nsid.NSID) (Def, error) {
+	seen := map[string]bool{}
+	for {
+		key := ref.Canonical()
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s", ErrRefCycle, key)
+		}
+		seen[key] = true
+
+		def, err := c.Def(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := def.(*Ref)
+		if !ok {
+			return def, nil
+		}
+		ref = r.Ref
+	}
+}
+
+// Check checks all refs in the catalog are resolvable without cycles
+// It returns the first error in the order of the Lexicon IDs and the definition names.
+func (c *Catalog) Check() error {
+	for _, id := range c.IDs() {
+		lex, err := c.Lexicon(id)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range lex.DefNames() {
+			if err := c.checkDef(lex.Defs[name], id.String()+"#"+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkDef checks all refs in the definition are resolvable
+func (c *Catalog) checkDef(def Def, path string) error {
+	checkProperties := func(properties map[string]Def) error {
+		for name, d := range properties {
+			if err := c.checkDef(d, path+"/properties/"+name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	checkBody := func(body *Body, p string) error {
+		if body == nil || body.Schema == nil {
+			return nil
+		}
+		return c.checkDef(body.Schema, path+p+"/schema")
+	}
+	checkParams := func(params *Params) error {
+		if params == nil {
+			return nil
+		}
+		return c.checkDef(params, path+"/parameters")
+	}
+
+	switch d := def.(type) {
+	case *Record:
+		return c.checkDef(d.Record, path+"/record")
+	case *Query:
+		if err := checkParams(d.Parameters); err != nil {
+			return err
+		}
+		return checkBody(d.Output, "/output")
+	case *Procedure:
+		if err := checkParams(d.Parameters); err != nil {
+			return err
+		}
+		if err := checkBody(d.Input, "/input"); err != nil {
+			return err
+		}
+		return checkBody(d.Output, "/output")
+	case *Subscription:
+		if err := checkParams(d.Parameters); err != nil {
+			return err
+		}
+		return checkBody(d.Message, "/message")
+	case *Params:
+		return checkProperties(d.Properties)
+	case *Object:
+		return checkProperties(d.Properties)
+	case *Array:
+		return c.checkDef(d.Items, path+"/items")
+	case *Ref:
+		if _, err := c.Resolve(d.Ref); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case *Union:
+		for _, ref := range d.Refs {
+			if _, err := c.Resolve(ref); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
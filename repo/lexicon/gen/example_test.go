@@ -0,0 +1,161 @@
+package gen_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon/gen/internal/example/com/example/embed"
+	"go.yumnet.cloud/orangesea/repo/lexicon/gen/internal/example/com/example/feed"
+	"go.yumnet.cloud/orangesea/repo/lexicon/gen/internal/example/com/example/repo"
+)
+
+func TestGenerated_JSON(t *testing.T) {
+	in := []byte(`{
+		"$type": "com.example.feed.post",
+		"text": "hello",
+		"createdAt": "2024-01-01T00:00:00Z",
+		"embed": {
+			"$type": "com.example.embed.images",
+			"images": [{
+				"image": {"$type": "blob", "ref": {"$link": "bafkreibme22gw2h7y2h7tg2fhqotaqjucnbc24deqo72b6mkl2egezxhvy"}, "mimeType": "image/png", "size": 1024},
+				"alt": "a cat",
+				"thumb": {"$bytes": "AAEC"}
+			}]
+		},
+		"labels": {"$type": "com.example.feed.defs#selfLabels", "values": [{"val": "nsfw"}]},
+		"tags": ["cats"]
+	}`)
+
+	var post feed.Post
+	if err := json.Unmarshal(in, &post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Embed == nil || post.Embed.EmbedImages == nil || post.Embed.EmbedRecord != nil {
+		t.Fatalf("Embed = %+v, want images", post.Embed)
+	}
+	if got := post.Embed.EmbedImages.Images[0].Image.MimeType; got != "image/png" {
+		t.Errorf("Image.MimeType = %v, want image/png", got)
+	}
+	if post.Labels == nil || post.Labels.FeedDefs_SelfLabels == nil {
+		t.Fatalf("Labels = %+v, want self labels", post.Labels)
+	}
+
+	out, err := json.Marshal(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(in, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Marshal() = %s, want %s", out, in)
+	}
+}
+
+func TestGenerated_Union(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"successfull case", `{"$type": "com.example.embed.record", "record": {"uri": "at://did:plc:abc/com.example.feed.post/3k", "cid": "bafyrei"}}`, false},
+		{"successfull case; unknown type of open union", `{"$type": "com.example.embed.video", "video": 1}`, false},
+		{"failure case; no $type", `{"record": {}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u feed.Post_Embed
+			err := json.Unmarshal([]byte(tt.in), &u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			out, err := json.Marshal(&u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			_ = json.Unmarshal(out, &got)
+			_ = json.Unmarshal([]byte(tt.in), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Marshal() = %s, want %s", out, tt.in)
+			}
+		})
+	}
+
+	var labels feed.Post_Labels
+	if err := json.Unmarshal([]byte(`{"$type": "com.example.feed.defs#other"}`), &labels); err == nil {
+		t.Errorf("Unmarshal() error = nil, want unknown type of closed union")
+	}
+	if _, err := json.Marshal(&feed.Post_Embed{}); err == nil {
+		t.Errorf("Marshal() error = nil, want empty union")
+	}
+}
+
+func TestGenerated_CBOR(t *testing.T) {
+	post := &feed.Post{
+		Text:      "hello",
+		CreatedAt: "2024-01-01T00:00:00Z",
+		Embed: &feed.Post_Embed{
+			EmbedRecord: &embed.Record{
+				Record: &repo.StrongRef{Uri: "at://did:plc:abc/com.example.feed.post/3k", Cid: "bafyrei"},
+			},
+		},
+	}
+
+	b, err := post.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := &feed.Post{}
+	if err := got.UnmarshalCBOR(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.LexiconTypeID != feed.PostNSID {
+		t.Errorf("LexiconTypeID = %v, want %v", got.LexiconTypeID, feed.PostNSID)
+	}
+	if got.Embed.EmbedRecord.LexiconTypeID != "com.example.embed.record" {
+		t.Errorf("Embed.LexiconTypeID = %v, want com.example.embed.record", got.Embed.EmbedRecord.LexiconTypeID)
+	}
+	got.LexiconTypeID = ""
+	got.Embed.EmbedRecord.LexiconTypeID = ""
+	if !reflect.DeepEqual(got, post) {
+		t.Errorf("UnmarshalCBOR() = %+v, want %+v", got, post)
+	}
+
+	again, err := got.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, b) {
+		t.Errorf("MarshalCBOR() is not deterministic")
+	}
+}
+
+func TestGenerated_Params(t *testing.T) {
+	limit := int64(30)
+	reverse := true
+	params := &feed.GetTimeline_Params{
+		Limit:   &limit,
+		Reverse: &reverse,
+		Tags:    []string{"a", "b"},
+	}
+	if got, want := params.Values().Encode(), "limit=30&reverse=true&tags=a&tags=b"; got != want {
+		t.Errorf("Values() = %v, want %v", got, want)
+	}
+
+	var empty *feed.GetTimeline_Params
+	if got := empty.Values().Encode(); got != "" {
+		t.Errorf("Values() = %v, want empty", got)
+	}
+}
@@ -0,0 +1,745 @@
+// the package gen generates Go code from Lexicon schemas
+// Each Lexicon is generated into a file in the package of its domain segments,
+// e.g. "app.bsky.feed.post" into "app/bsky/feed/post.go" of the package "feed".
+
+package gen
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const (
+	LEXUTIL_PATH = "go.yumnet.cloud/orangesea/repo/lexicon/lexutil"
+)
+
+// Generator generates Go code from the Lexicons in the catalog
+type Generator struct {
+	Catalog      *lexicon.Catalog
+	ImportPrefix string // import path of the output directory, e.g. "example.com/api"
+}
+
+// NewGenerator returns a new Generator
+func NewGenerator(catalog *lexicon.Catalog, importPrefix string) *Generator {
+	return &Generator{
+		Catalog:      catalog,
+		ImportPrefix: strings.TrimSuffix(importPrefix, "/"),
+	}
+}
+
+// Generate generates the Go source files of all Lexicons in the catalog
+// It returns the formatted sources keyed by the slash-separated path relative to the output directory.
+func (g *Generator) Generate() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, id := range g.Catalog.IDs() {
+		lex, err := g.Catalog.Lexicon(id)
+		if err != nil {
+			return nil, err
+		}
+
+		src, err := g.GenerateLexicon(lex)
+		if err != nil {
+			return nil, err
+		}
+		if src != nil {
+			files[FilePath(id)] = src
+		}
+	}
+	return files, nil
+}
+
+// GenerateLexicon generates the formatted Go source file of the Lexicon
+// It returns nil if the Lexicon has nothing to generate, e.g. only a subscription.
+func (g *Generator) GenerateLexicon(lex *lexicon.Lexicon) ([]byte, error) {
+	f := &file{
+		g:       g,
+		lex:     lex,
+		pkg:     PackagePath(lex.ID),
+		imports: map[string]string{},
+	}
+
+	for _, name := range lex.DefNames() {
+		if err := f.genDef(name, lex.Defs[name]); err != nil {
+			return nil, fmt.Errorf("failed to generate %s#%s; %w", lex.ID, name, err)
+		}
+	}
+
+	if len(f.decls) == 0 {
+		return nil, nil
+	}
+
+	src := f.source()
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format %s; %w", lex.ID, err)
+	}
+	return formatted, nil
+}
+
+// PackagePath returns the slash-separated package path of the NSID relative to the output directory
+func PackagePath(id *nsid.NSID) string {
+	segments := make([]string, len(id.DSegments()))
+	for i, dsegment := range id.DSegments() {
+		segments[i] = identifier(dsegment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// PackageName returns the package name of the NSID; the last domain segment
+func PackageName(id *nsid.NSID) string {
+	return path.Base(PackagePath(id))
+}
+
+// FilePath returns the slash-separated path of the Go file of the NSID relative to the output directory
+func FilePath(id *nsid.NSID) string {
+	return PackagePath(id) + "/" + id.Name() + ".go"
+}
+
+// TypeName returns the Go type name of the definition referenced by the NSID
+// The main definition is named after the NSID name (e.g. "Post" for "app.bsky.feed.post"),
+// and others are suffixed with the definition name (e.g. "Post_ReplyRef" for "app.bsky.feed.post#replyRef").
+func TypeName(ref *nsid.NSID) string {
+	name := exported(ref.Name())
+	if ref.Fragment() == "" || ref.Fragment() == lexicon.MAIN {
+		return name
+	}
+	return name + "_" + exported(ref.Fragment())
+}
+
+// identifier returns the lower case Go identifier of the domain segment, e.g. "bsky"
+func identifier(s string) string {
+	s = strings.ToLower(strings.ReplaceAll(s, "-", ""))
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "x" + s
+	}
+	if token.IsKeyword(s) {
+		s += "_"
+	}
+	return s
+}
+
+// exported returns the exported Go identifier of the name, e.g. "CreatedAt" for "createdAt"
+func exported(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 || !unicode.IsLetter(rune(b.String()[0])) {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// file is the Go file of a Lexicon under generation
+type file struct {
+	g       *Generator
+	lex     *lexicon.Lexicon
+	pkg     string
+	imports map[string]string // import path to alias; empty alias if the default name is used
+	decls   []string
+}
+
+// use adds the import of the path and returns the qualifier
+func (f *file) use(importPath string, alias string) string {
+	f.imports[importPath] = alias
+	if alias == "" {
+		return path.Base(importPath)
+	}
+	return alias
+}
+
+func (f *file) lexutil() string {
+	return f.use(LEXUTIL_PATH, "")
+}
+
+// decl reserves the place of a declaration and returns the setter,
+// which keeps the declaration before the inline types generated while building it
+func (f *file) decl() func(string) {
+	i := len(f.decls)
+	f.decls = append(f.decls, "")
+	return func(s string) {
+		f.decls[i] = s
+	}
+}
+
+func (f *file) source() []byte {
+	var b strings.Builder
+	b.WriteString("// Code generated by lexgen. DO NOT EDIT.\n\n")
+	b.WriteString("package " + path.Base(f.pkg) + "\n\n")
+
+	if len(f.imports) > 0 {
+		paths := make([]string, 0, len(f.imports))
+		for p := range f.imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		// the standard library first, then the others
+		b.WriteString("import (\n")
+		for _, std := range []bool{true, false} {
+			for _, p := range paths {
+				if isStd(p) != std {
+					continue
+				}
+				if alias := f.imports[p]; alias != "" {
+					b.WriteString(alias + " ")
+				}
+				b.WriteString(strconv.Quote(p) + "\n")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(")\n\n")
+	}
+
+	for _, d := range f.decls {
+		b.WriteString(d)
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+func isStd(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// comment returns the doc comment of the type
+func comment(name string, what string, description string) string {
+	var b strings.Builder
+	b.WriteString("// " + name + " is " + what + "\n")
+	if description != "" {
+		b.WriteString("//\n")
+		for _, line := range strings.Split(strings.TrimSpace(description), "\n") {
+			b.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+		}
+	}
+	return b.String()
+}
+
+// genDef generates the declarations of the top-level definition
+func (f *file) genDef(name string, def lexicon.Def) error {
+	ref, err := f.lex.RefNSID(name)
+	if err != nil {
+		return err
+	}
+	typeName := TypeName(ref)
+	what := fmt.Sprintf("the %q definition of %s", name, f.lex.ID)
+
+	switch d := def.(type) {
+	case *lexicon.Record:
+		return f.genRecord(typeName, ref, d)
+	case *lexicon.Query:
+		return f.genQuery(typeName, ref, d)
+	case *lexicon.Procedure:
+		return f.genProcedure(typeName, ref, d)
+	case *lexicon.Subscription:
+		// subscriptions are streamed over WebSocket, which is not in the XRPC client
+		return nil
+	case *lexicon.Object:
+		return f.genObject(typeName, what, d)
+	case *lexicon.Union:
+		return f.genUnion(typeName, what, d)
+	case *lexicon.Token:
+		f.decl()(comment(typeName, "the token "+strconv.Quote(ref.String()), d.Description) +
+			fmt.Sprintf("const %s = %q\n", typeName, ref.String()))
+		return nil
+	}
+
+	// the other types are aliases of the Go types, so that refs to them have the type names
+	set := f.decl()
+	typ, err := f.goType(typeName, def)
+	if err != nil {
+		return err
+	}
+	set(comment(typeName, what, description(def)) + fmt.Sprintf("type %s = %s\n", typeName, typ.name))
+	return nil
+}
+
+// goType is the Go type of a field
+type goType struct {
+	name   string
+	kind   int
+	encode func(v string) string // encodes the value into a query parameter; params only
+}
+
+const (
+	kindScalar  = iota // bool, int64, string, and links; a pointer if optional
+	kindStruct         // always a pointer
+	kindNilable        // slices and interfaces; nil if absent
+)
+
+// goType returns the Go type of the definition
+// The inline objects and unions are generated as the types of the name.
+func (f *file) goType(name string, def lexicon.Def) (*goType, error) {
+	switch d := def.(type) {
+	case *lexicon.Null:
+		return &goType{name: "interface{}", kind: kindNilable}, nil
+	case *lexicon.Boolean:
+		return &goType{name: "bool", kind: kindScalar, encode: func(v string) string {
+			return f.use("strconv", "") + ".FormatBool(" + v + ")"
+		}}, nil
+	case *lexicon.Integer:
+		return &goType{name: "int64", kind: kindScalar, encode: func(v string) string {
+			return f.use("strconv", "") + ".FormatInt(" + v + ", 10)"
+		}}, nil
+	case *lexicon.String:
+		return &goType{name: "string", kind: kindScalar, encode: func(v string) string {
+			return v
+		}}, nil
+	case *lexicon.Bytes:
+		return &goType{name: f.lexutil() + ".Bytes", kind: kindNilable}, nil
+	case *lexicon.CIDLink:
+		return &goType{name: f.lexutil() + ".Link", kind: kindScalar}, nil
+	case *lexicon.Blob:
+		return &goType{name: f.lexutil() + ".Blob", kind: kindStruct}, nil
+	case *lexicon.Unknown:
+		return &goType{name: f.use("encoding/json", "") + ".RawMessage", kind: kindNilable}, nil
+	case *lexicon.Array:
+		item, err := f.goType(name+"_Elem", d.Items)
+		if err != nil {
+			return nil, err
+		}
+		elem := item.name
+		if item.kind == kindStruct {
+			elem = "*" + elem
+		}
+		return &goType{name: "[]" + elem, kind: kindNilable, encode: item.encode}, nil
+	case *lexicon.Object:
+		if err := f.genObject(name, "an inline object of "+f.lex.ID.String(), d); err != nil {
+			return nil, err
+		}
+		return &goType{name: name, kind: kindStruct}, nil
+	case *lexicon.Union:
+		if err := f.genUnion(name, "an inline union of "+f.lex.ID.String(), d); err != nil {
+			return nil, err
+		}
+		return &goType{name: name, kind: kindStruct}, nil
+	case *lexicon.Ref:
+		return f.refType(d.Ref)
+	}
+	return nil, fmt.Errorf("unsupported type: %s", def.Type())
+}
+
+// refType returns the Go type of the definition referenced by the NSID
+func (f *file) refType(ref *nsid.NSID) (*goType, error) {
+	def, err := f.g.Catalog.Def(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	name := f.qualified(ref)
+	switch d := def.(type) {
+	case *lexicon.Record, *lexicon.Object, *lexicon.Union:
+		return &goType{name: name, kind: kindStruct}, nil
+	case *lexicon.Token:
+		return &goType{name: "string", kind: kindScalar, encode: func(v string) string {
+			return v
+		}}, nil
+	case *lexicon.Query, *lexicon.Procedure, *lexicon.Subscription:
+		return nil, fmt.Errorf("invalid ref: %s; %s is not a data type", ref, d.Type())
+	}
+
+	// the aliases keep the kinds of the aliased types
+	typ, err := f.aliasType(def)
+	if err != nil {
+		return nil, err
+	}
+	typ.name = name
+	return typ, nil
+}
+
+// aliasType returns the Go type of the definition without generating the inline types
+// The name of the returned type is meaningless.
+func (f *file) aliasType(def lexicon.Def) (*goType, error) {
+	switch d := def.(type) {
+	case *lexicon.Array:
+		switch d.Items.(type) {
+		case *lexicon.Object, *lexicon.Union:
+			return &goType{kind: kindNilable}, nil
+		}
+		item, err := f.aliasType(d.Items)
+		if err != nil {
+			return nil, err
+		}
+		return &goType{kind: kindNilable, encode: item.encode}, nil
+	case *lexicon.Object, *lexicon.Union:
+		return &goType{kind: kindStruct}, nil
+	}
+	return f.goType("", def)
+}
+
+// qualified returns the Go type name of the NSID qualified with the package alias if it is in another package
+func (f *file) qualified(ref *nsid.NSID) string {
+	pkg := PackagePath(ref)
+	if pkg == f.pkg {
+		return TypeName(ref)
+	}
+	alias := strings.ReplaceAll(pkg, "/", "")
+	return f.use(f.g.ImportPrefix+"/"+pkg, alias) + "." + TypeName(ref)
+}
+
+func description(def lexicon.Def) string {
+	switch d := def.(type) {
+	case *lexicon.Boolean:
+		return d.Description
+	case *lexicon.Integer:
+		return d.Description
+	case *lexicon.String:
+		return d.Description
+	case *lexicon.Bytes:
+		return d.Description
+	case *lexicon.CIDLink:
+		return d.Description
+	case *lexicon.Blob:
+		return d.Description
+	case *lexicon.Array:
+		return d.Description
+	case *lexicon.Object:
+		return d.Description
+	case *lexicon.Ref:
+		return d.Description
+	case *lexicon.Union:
+		return d.Description
+	case *lexicon.Unknown:
+		return d.Description
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// field returns the struct field of the property
+func (f *file) field(parent string, prop string, def lexicon.Def, required bool, nullable bool) (string, error) {
+	typ, err := f.goType(parent+"_"+exported(prop), def)
+	if err != nil {
+		return "", err
+	}
+
+	t := typ.name
+	switch typ.kind {
+	case kindStruct:
+		t = "*" + t
+	case kindScalar:
+		if !required || nullable {
+			t = "*" + t
+		}
+	}
+
+	tag := prop
+	if !required {
+		tag += ",omitempty"
+	}
+
+	var b strings.Builder
+	if desc := description(def); desc != "" {
+		for _, line := range strings.Split(strings.TrimSpace(desc), "\n") {
+			b.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+		}
+	}
+	fmt.Fprintf(&b, "%s %s `json:%q`\n", exported(prop), t, tag)
+	return b.String(), nil
+}
+
+// genStruct generates the struct of the object properties with the $type field
+func (f *file) genStruct(b *strings.Builder, name string, obj *lexicon.Object) error {
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	b.WriteString("LexiconTypeID string `json:\"$type,omitempty\"`\n")
+	for _, prop := range sortedKeys(obj.Properties) {
+		field, err := f.field(name, prop, obj.Properties[prop], contains(obj.Required, prop), contains(obj.Nullable, prop))
+		if err != nil {
+			return err
+		}
+		b.WriteString(field)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+// genCBOR generates the DAG-CBOR marshaling methods of the type
+func (f *file) genCBOR(b *strings.Builder, name string) {
+	lexutil := f.lexutil()
+	fmt.Fprintf(b, "func (t *%s) MarshalCBOR() ([]byte, error) {\nreturn %s.MarshalCBOR(t)\n}\n\n", name, lexutil)
+	fmt.Fprintf(b, "func (t *%s) UnmarshalCBOR(b []byte) error {\nreturn %s.UnmarshalCBOR(b, t)\n}\n", name, lexutil)
+}
+
+func (f *file) genObject(name string, what string, obj *lexicon.Object) error {
+	set := f.decl()
+
+	var b strings.Builder
+	b.WriteString(comment(name, what, obj.Description))
+	if err := f.genStruct(&b, name, obj); err != nil {
+		return err
+	}
+	f.genCBOR(&b, name)
+	set(b.String())
+	return nil
+}
+
+func (f *file) genRecord(name string, ref *nsid.NSID, rec *lexicon.Record) error {
+	set := f.decl()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %sNSID is the collection of the %s record\nconst %sNSID = %q\n\n", name, name, name, ref.String())
+	b.WriteString(comment(name, "the record of "+ref.String(), rec.Description))
+	if err := f.genStruct(&b, name, rec.Record); err != nil {
+		return err
+	}
+
+	// records always have $type
+	json := f.use("encoding/json", "")
+	fmt.Fprintf(&b, "func (t %s) MarshalJSON() ([]byte, error) {\ntype raw %s\nv := raw(t)\nv.LexiconTypeID = %sNSID\nreturn %s.Marshal(&v)\n}\n\n", name, name, name, json)
+	f.genCBOR(&b, name)
+	set(b.String())
+	return nil
+}
+
+// unionMember returns the Go field name of the union member, e.g. "EmbedImages" for "app.bsky.embed.images"
+func unionMember(ref *nsid.NSID) string {
+	dsegments := ref.DSegments()
+	return exported(dsegments[len(dsegments)-1]) + TypeName(ref)
+}
+
+func (f *file) genUnion(name string, what string, u *lexicon.Union) error {
+	set := f.decl()
+	json := f.use("encoding/json", "")
+
+	type member struct {
+		field string
+		typ   string
+		ref   string
+	}
+	members := make([]member, 0, len(u.Refs))
+	for _, ref := range u.Refs {
+		typ, err := f.refType(ref)
+		if err != nil {
+			return err
+		}
+		if typ.kind != kindStruct {
+			return fmt.Errorf("invalid union: %s; %s is not an object", name, ref)
+		}
+		members = append(members, member{field: unionMember(ref), typ: typ.name, ref: ref.String()})
+	}
+
+	var b strings.Builder
+	b.WriteString(comment(name, what, u.Description))
+	b.WriteString("// Exactly one of the fields is set.\n")
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	for _, m := range members {
+		fmt.Fprintf(&b, "%s *%s\n", m.field, m.typ)
+	}
+	if !u.Closed {
+		b.WriteString("// Unknown is the object of a type not in the union\n")
+		fmt.Fprintf(&b, "Unknown %s.RawMessage\n", json)
+	}
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(&b, "func (t *%s) MarshalJSON() ([]byte, error) {\n", name)
+	for _, m := range members {
+		fmt.Fprintf(&b, "if t.%s != nil {\nv := *t.%s\nv.LexiconTypeID = %q\nreturn %s.Marshal(&v)\n}\n", m.field, m.field, m.ref, json)
+	}
+	if !u.Closed {
+		b.WriteString("if t.Unknown != nil {\nreturn t.Unknown, nil\n}\n")
+	}
+	fmt.Fprintf(&b, "return nil, %s.Errorf(\"failed to marshal %s; union is empty\")\n}\n\n", f.use("fmt", ""), name)
+
+	fmt.Fprintf(&b, "func (t *%s) UnmarshalJSON(b []byte) error {\n", name)
+	fmt.Fprintf(&b, "typ, err := %s.TypeOf(b)\nif err != nil {\nreturn fmt.Errorf(\"invalid %s; %%w\", err)\n}\n\n", f.lexutil(), name)
+	b.WriteString("switch typ {\n")
+	for _, m := range members {
+		fmt.Fprintf(&b, "case %q:\nt.%s = new(%s)\nreturn %s.Unmarshal(b, t.%s)\n", m.ref, m.field, m.typ, json, m.field)
+	}
+	b.WriteString("}\n")
+	if u.Closed {
+		fmt.Fprintf(&b, "return fmt.Errorf(\"invalid %s; unknown type: %%s\", typ)\n}\n\n", name)
+	} else {
+		fmt.Fprintf(&b, "t.Unknown = append(%s.RawMessage(nil), b...)\nreturn nil\n}\n\n", json)
+	}
+	f.genCBOR(&b, name)
+	set(b.String())
+	return nil
+}
+
+// method is the XRPC method under generation
+type method struct {
+	name   string
+	ref    *nsid.NSID
+	kind   string // "QUERY" or "PROCEDURE"
+	desc   string
+	params *lexicon.Params
+	input  *lexicon.Body
+	output *lexicon.Body
+}
+
+func (f *file) genQuery(name string, ref *nsid.NSID, q *lexicon.Query) error {
+	return f.genMethod(&method{name: name, ref: ref, kind: "QUERY", desc: q.Description, params: q.Parameters, output: q.Output})
+}
+
+func (f *file) genProcedure(name string, ref *nsid.NSID, p *lexicon.Procedure) error {
+	return f.genMethod(&method{name: name, ref: ref, kind: "PROCEDURE", desc: p.Description, params: p.Parameters, input: p.Input, output: p.Output})
+}
+
+// bodyType returns the Go type of the JSON body; nil if the body is not JSON
+func (f *file) bodyType(name string, body *lexicon.Body) (*goType, error) {
+	if body == nil || body.Schema == nil {
+		return nil, nil
+	}
+	switch d := body.Schema.(type) {
+	case *lexicon.Object:
+		if err := f.genObject(name, "the "+strings.ToLower(name[strings.LastIndex(name, "_")+1:])+" of "+f.lex.ID.String(), d); err != nil {
+			return nil, err
+		}
+		return &goType{name: name, kind: kindStruct}, nil
+	}
+	return f.goType(name, body.Schema)
+}
+
+func (f *file) genMethod(m *method) error {
+	set := f.decl()
+	ctx := f.use("context", "")
+	lexutil := f.lexutil()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %sNSID is the XRPC method of %s\nconst %sNSID = %q\n\n", m.name, m.name, m.name, m.ref.String())
+
+	args := []string{"ctx " + ctx + ".Context", "c " + lexutil + ".Client"}
+	params := "nil"
+	if m.params != nil {
+		if err := f.genParams(&b, m.name+"_Params", m.params); err != nil {
+			return err
+		}
+		args = append(args, "params *"+m.name+"_Params")
+		params = "params.Values()"
+	}
+
+	input, encoding := "nil", `""`
+	if m.input != nil {
+		encoding = strconv.Quote(m.input.Encoding)
+		typ, err := f.bodyType(m.name+"_Input", m.input)
+		if err != nil {
+			return err
+		}
+		if typ == nil {
+			args = append(args, "input "+f.use("io", "")+".Reader")
+		} else if typ.kind == kindStruct {
+			args = append(args, "input *"+typ.name)
+		} else {
+			args = append(args, "input "+typ.name)
+		}
+		input = "input"
+	}
+
+	var result, output, ret, outputType string
+	zero := "nil, "
+	if m.output == nil {
+		result, output, ret, zero = "error", "nil", "return nil", ""
+	} else {
+		typ, err := f.bodyType(m.name+"_Output", m.output)
+		if err != nil {
+			return err
+		}
+		switch {
+		case typ == nil:
+			result = "([]byte, error)"
+			output = "buf"
+			ret = "return buf.Bytes(), nil"
+		case typ.kind == kindStruct:
+			result = "(*" + typ.name + ", error)"
+			output = "&out"
+			ret = "return &out, nil"
+		default:
+			result = "(" + typ.name + ", error)"
+			output = "&out"
+			ret = "return out, nil"
+		}
+		if typ != nil {
+			outputType = typ.name
+		}
+	}
+
+	b.WriteString(comment(m.name, "the XRPC "+strings.ToLower(m.kind)+" "+m.ref.String(), m.desc))
+	fmt.Fprintf(&b, "func %s(%s) %s {\n", m.name, strings.Join(args, ", "), result)
+	switch output {
+	case "buf":
+		fmt.Fprintf(&b, "buf := new(%s.Buffer)\n", f.use("bytes", ""))
+	case "&out":
+		fmt.Fprintf(&b, "var out %s\n", outputType)
+	}
+	fmt.Fprintf(&b, "if err := c.Do(ctx, %s.%s, %s, %sNSID, %s, %s, %s); err != nil {\nreturn %serr\n}\n%s\n}\n",
+		lexutil, m.kind, encoding, m.name, params, input, output, zero, ret)
+	set(b.String())
+	return nil
+}
+
+// genParams generates the struct of the parameters with the encoder into the query
+func (f *file) genParams(b *strings.Builder, name string, params *lexicon.Params) error {
+	var fields, values strings.Builder
+	for _, prop := range sortedKeys(params.Properties) {
+		def := params.Properties[prop]
+		required := contains(params.Required, prop)
+		field, err := f.field(name, prop, def, required, false)
+		if err != nil {
+			return err
+		}
+		fields.WriteString(field)
+
+		typ, err := f.goType(name+"_"+exported(prop), def)
+		if err != nil {
+			return err
+		}
+		if typ.encode == nil && def.Type() != lexicon.TYPE_UNKNOWN {
+			return fmt.Errorf("unsupported parameter: %s; %s", prop, def.Type())
+		}
+
+		v := "p." + exported(prop)
+		switch {
+		case def.Type() == lexicon.TYPE_UNKNOWN:
+			fmt.Fprintf(&values, "if len(%s) > 0 {\nv.Set(%q, string(%s))\n}\n", v, prop, v)
+		case typ.kind == kindNilable:
+			fmt.Fprintf(&values, "for _, item := range %s {\nv.Add(%q, %s)\n}\n", v, prop, typ.encode("item"))
+		case required:
+			fmt.Fprintf(&values, "v.Set(%q, %s)\n", prop, typ.encode(v))
+		default:
+			fmt.Fprintf(&values, "if %s != nil {\nv.Set(%q, %s)\n}\n", v, prop, typ.encode("*"+v))
+		}
+	}
+
+	url := f.use("net/url", "")
+	b.WriteString(comment(name, "the parameters of "+f.lex.ID.String(), params.Description))
+	fmt.Fprintf(b, "type %s struct {\n%s}\n\n", name, fields.String())
+	fmt.Fprintf(b, "// Values returns the parameters in the query\nfunc (p *%s) Values() %s.Values {\nv := %s.Values{}\nif p == nil {\nreturn v\n}\n%sreturn v\n}\n\n",
+		name, url, url, values.String())
+	return nil
+}
+
+func sortedKeys(m map[string]lexicon.Def) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,134 @@
+package gen_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+	"go.yumnet.cloud/orangesea/repo/lexicon/gen"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+var update = flag.Bool("update", false, "update the generated example")
+
+const (
+	EXAMPLE_DIR    = "internal/example"
+	EXAMPLE_PREFIX = "go.yumnet.cloud/orangesea/repo/lexicon/gen/internal/example"
+)
+
+func testCatalog(t *testing.T) *lexicon.Catalog {
+	t.Helper()
+
+	catalog := lexicon.NewCatalog()
+	if err := catalog.LoadFS(os.DirFS("testdata/lexicons")); err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	files, err := gen.NewGenerator(testCatalog(t), EXAMPLE_PREFIX).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := os.RemoveAll(EXAMPLE_DIR); err != nil {
+			t.Fatal(err)
+		}
+		for p, src := range files {
+			p = filepath.Join(EXAMPLE_DIR, filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, src, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, ok := files["com/example/feed/subscribe.go"]; ok {
+		t.Errorf("subscription must not be generated")
+	}
+	delete(files, "com/example/feed/subscribe.go")
+
+	var generated []string
+	err = filepath.Walk(EXAMPLE_DIR, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(EXAMPLE_DIR, p)
+		if err != nil {
+			return err
+		}
+		generated = append(generated, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generated) != len(files) {
+		t.Errorf("Generate() files = %d, want %d; run go test -update", len(files), len(generated))
+	}
+
+	for _, p := range generated {
+		want, err := os.ReadFile(filepath.Join(EXAMPLE_DIR, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(files[p], want) {
+			t.Errorf("Generate() %s is outdated; run go test -update", p)
+		}
+	}
+}
+
+func TestGenerator_GenerateDanglingRef(t *testing.T) {
+	catalog := lexicon.NewCatalog()
+	_, err := catalog.AddJSON([]byte(`{
+		"lexicon": 1,
+		"id": "com.example.test.dangling",
+		"defs": {"main": {"type": "object", "properties": {"x": {"type": "ref", "ref": "com.example.test.missing"}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gen.NewGenerator(catalog, EXAMPLE_PREFIX).Generate(); err == nil {
+		t.Errorf("Generate() error = nil, want dangling ref")
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantPkg string
+		want2   string
+	}{
+		{"main", "app.bsky.feed.post", "Post", "app/bsky/feed", "app/bsky/feed/post.go"},
+		{"fragment", "app.bsky.feed.post#replyRef", "Post_ReplyRef", "app/bsky/feed", "app/bsky/feed/post.go"},
+		{"camel case", "app.bsky.feed.getTimeline", "GetTimeline", "app/bsky/feed", "app/bsky/feed/getTimeline.go"},
+		{"hyphen and keyword", "com.my-example.go.getThing", "GetThing", "com/myexample/go_", "com/myexample/go_/getThing.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := nsid.NewNSID(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gen.TypeName(ref); got != tt.want {
+				t.Errorf("TypeName() = %v, want %v", got, tt.want)
+			}
+			if got := gen.PackagePath(ref); got != tt.wantPkg {
+				t.Errorf("PackagePath() = %v, want %v", got, tt.wantPkg)
+			}
+			if got := gen.FilePath(ref); got != tt.want2 {
+				t.Errorf("FilePath() = %v, want %v", got, tt.want2)
+			}
+		})
+	}
+}
@@ -0,0 +1,684 @@
+// the package lexicon parses Lexicon schema documents (version 1)
+// https://atproto.com/specs/lexicon
+
+package lexicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.yumnet.cloud/orangesea/repo/format"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const (
+	VERSION = 1
+
+	MAIN = "main"
+
+	// primary types; allowed only as the main definition
+	TYPE_RECORD       = "record"
+	TYPE_QUERY        = "query"
+	TYPE_PROCEDURE    = "procedure"
+	TYPE_SUBSCRIPTION = "subscription"
+
+	// field types
+	TYPE_NULL     = "null"
+	TYPE_BOOLEAN  = "boolean"
+	TYPE_INTEGER  = "integer"
+	TYPE_STRING   = "string"
+	TYPE_BYTES    = "bytes"
+	TYPE_CID_LINK = "cid-link"
+	TYPE_BLOB     = "blob"
+	TYPE_ARRAY    = "array"
+	TYPE_OBJECT   = "object"
+	TYPE_PARAMS   = "params"
+	TYPE_TOKEN    = "token"
+	TYPE_REF      = "ref"
+	TYPE_UNION    = "union"
+	TYPE_UNKNOWN  = "unknown"
+)
+
+// string formats; validated by the package format
+const (
+	FORMAT_AT_IDENTIFIER = format.AT_IDENTIFIER
+	FORMAT_AT_URI        = format.AT_URI
+	FORMAT_CID           = format.CID
+	FORMAT_DATETIME      = format.DATETIME
+	FORMAT_DID           = format.DID
+	FORMAT_HANDLE        = format.HANDLE
+	FORMAT_NSID          = format.NSID
+	FORMAT_TID           = format.TID
+	FORMAT_RECORD_KEY    = format.RECORD_KEY
+	FORMAT_URI           = format.URI
+	FORMAT_LANGUAGE      = format.LANGUAGE
+)
+
+// Lexicon is a Lexicon schema document
+type Lexicon struct {
+	Lexicon     int
+	ID          *nsid.NSID
+	Revision    int
+	Description string
+	Defs        map[string]Def
+}
+
+// Def is a type definition of Lexicon
+type Def interface {
+	// Type returns the type name of the definition, e.g. "record"
+	Type() string
+}
+
+// Record is a record type definition
+type Record struct {
+	Description string
+	Key         string // record key type, e.g. "tid", "nsid", "any" or "literal:self"
+	Record      *Object
+}
+
+// Query is a query (HTTP GET) type definition
+type Query struct {
+	Description string
+	Parameters  *Params // nil if there are no parameters
+	Output      *Body   // nil if there is no output
+	Errors      []Error
+}
+
+// Procedure is a procedure (HTTP POST) type definition
+type Procedure struct {
+	Description string
+	Parameters  *Params // nil if there are no parameters
+	Input       *Body   // nil if there is no input
+	Output      *Body   // nil if there is no output
+	Errors      []Error
+}
+
+// Subscription is a subscription (WebSocket) type definition
+type Subscription struct {
+	Description string
+	Parameters  *Params // nil if there are no parameters
+	Message     *Body   // the schema of the messages; Encoding is empty
+	Errors      []Error
+}
+
+// Body is the input or the output of an XRPC method
+type Body struct {
+	Description string
+	Encoding    string // MIME type, e.g. "application/json"
+	Schema      Def    // *Object, *Ref or *Union; nil if the body is not JSON
+}
+
+// Error is an error of an XRPC method
+type Error struct {
+	Name        string
+	Description string
+}
+
+// Params is the parameters of an XRPC method
+// The properties are limited to boolean, integer, string, unknown, and arrays of them.
+type Params struct {
+	Description string
+	Required    []string
+	Properties  map[string]Def
+}
+
+// Object is an object type definition
+type Object struct {
+	Description string
+	Required    []string
+	Nullable    []string
+	Properties  map[string]Def
+}
+
+// Null is a null type definition
+type Null struct {
+	Description string
+}
+
+// Boolean is a boolean type definition
+type Boolean struct {
+	Description string
+	Default     *bool
+	Const       *bool
+}
+
+// Integer is an integer type definition
+type Integer struct {
+	Description string
+	Minimum     *int64
+	Maximum     *int64
+	Enum        []int64
+	Default     *int64
+	Const       *int64
+}
+
+// String is a string type definition
+type String struct {
+	Description  string
+	Format       string // empty if the string has no format
+	MinLength    *int   // in UTF-8 bytes
+	MaxLength    *int   // in UTF-8 bytes
+	MinGraphemes *int
+	MaxGraphemes *int
+	KnownValues  []string
+	Enum         []string
+	Default      *string
+	Const        *string
+}
+
+// Bytes is a bytes type definition
+type Bytes struct {
+	Description string
+	MinLength   *int
+	MaxLength   *int
+}
+
+// CIDLink is a cid-link type definition
+type CIDLink struct {
+	Description string
+}
+
+// Blob is a blob type definition
+type Blob struct {
+	Description string
+	Accept      []string // MIME types with glob, e.g. "image/*"
+	MaxSize     *int64   // in bytes
+}
+
+// Array is an array type definition
+type Array struct {
+	Description string
+	Items       Def
+	MinLength   *int
+	MaxLength   *int
+}
+
+// Token is a token type definition
+// A token has no data representation; its NSID is used as a string value.
+type Token struct {
+	Description string
+}
+
+// Ref is a reference to another type definition
+// Ref is always the absolute NSID of the definition; the local and the main references
+// (e.g. "#replyRef" and "app.bsky.feed.post") are resolved against the Lexicon ID on parsing.
+type Ref struct {
+	Description string
+	Ref         *nsid.NSID
+}
+
+// Union is a union of references to object or record types
+type Union struct {
+	Description string
+	Refs        []*nsid.NSID
+	Closed      bool
+}
+
+// Unknown is an arbitrary object type definition
+type Unknown struct {
+	Description string
+}
+
+func (d *Record) Type() string       { return TYPE_RECORD }
+func (d *Query) Type() string        { return TYPE_QUERY }
+func (d *Procedure) Type() string    { return TYPE_PROCEDURE }
+func (d *Subscription) Type() string { return TYPE_SUBSCRIPTION }
+func (d *Params) Type() string       { return TYPE_PARAMS }
+func (d *Object) Type() string       { return TYPE_OBJECT }
+func (d *Null) Type() string         { return TYPE_NULL }
+func (d *Boolean) Type() string      { return TYPE_BOOLEAN }
+func (d *Integer) Type() string      { return TYPE_INTEGER }
+func (d *String) Type() string       { return TYPE_STRING }
+func (d *Bytes) Type() string        { return TYPE_BYTES }
+func (d *CIDLink) Type() string      { return TYPE_CID_LINK }
+func (d *Blob) Type() string         { return TYPE_BLOB }
+func (d *Array) Type() string        { return TYPE_ARRAY }
+func (d *Token) Type() string        { return TYPE_TOKEN }
+func (d *Ref) Type() string          { return TYPE_REF }
+func (d *Union) Type() string        { return TYPE_UNION }
+func (d *Unknown) Type() string      { return TYPE_UNKNOWN }
+
+// Main returns the main definition of the Lexicon, or nil if there is no main definition
+func (lex *Lexicon) Main() Def {
+	return lex.Defs[MAIN]
+}
+
+// DefNames returns the names of the definitions in sorted order
+func (lex *Lexicon) DefNames() []string {
+	names := make([]string, 0, len(lex.Defs))
+	for name := range lex.Defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RefNSID returns the NSID which references the definition of the name, e.g. "app.bsky.feed.post#replyRef"
+// The main definition is referenced by the NSID without fragment.
+func (lex *Lexicon) RefNSID(name string) (*nsid.NSID, error) {
+	if name == MAIN {
+		return nsid.NewNSID(lex.ID.String())
+	}
+	return nsid.NewNSID(lex.ID.String() + "#" + name)
+}
+
+// parser parses the definitions of a Lexicon
+type parser struct {
+	id *nsid.NSID
+}
+
+// Parse parses the Lexicon JSON document
+func Parse(b []byte) (*Lexicon, error) {
+	var raw struct {
+		Lexicon     int                        `json:"lexicon"`
+		ID          string                     `json:"id"`
+		Revision    int                        `json:"revision"`
+		Description string                     `json:"description"`
+		Defs        map[string]json.RawMessage `json:"defs"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse Lexicon; %w", err)
+	}
+
+	if raw.Lexicon != VERSION {
+		return nil, fmt.Errorf("invalid Lexicon: %s; unsupported version: %d", raw.ID, raw.Lexicon)
+	}
+
+	id, err := nsid.NewNSID(raw.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Lexicon: %s; %w", raw.ID, err)
+	}
+	if id.Glob() || id.Fragment() != "" {
+		return nil, fmt.Errorf("invalid Lexicon: %s; id must not have glob or fragment", raw.ID)
+	}
+	if len(raw.Defs) == 0 {
+		return nil, fmt.Errorf("invalid Lexicon: %s; defs are empty", raw.ID)
+	}
+
+	p := &parser{id: id}
+	lex := &Lexicon{
+		Lexicon:     raw.Lexicon,
+		ID:          id,
+		Revision:    raw.Revision,
+		Description: raw.Description,
+		Defs:        make(map[string]Def, len(raw.Defs)),
+	}
+	for name, b := range raw.Defs {
+		if name != MAIN {
+			if _, err := lex.RefNSID(name); err != nil {
+				return nil, fmt.Errorf("invalid Lexicon: %s; invalid def name: %s", raw.ID, name)
+			}
+		}
+
+		def, err := p.parseDef(b, "#"+name, name == MAIN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Lexicon: %s; %w", raw.ID, err)
+		}
+		lex.Defs[name] = def
+	}
+
+	return lex, nil
+}
+
+// parseRef parses the reference into the absolute NSID
+func (p *parser) parseRef(ref string, path string) (*nsid.NSID, error) {
+	s := ref
+	if strings.HasPrefix(ref, "#") {
+		s = p.id.String() + ref
+	}
+
+	id, err := nsid.NewNSID(s)
+	if err != nil || id.Glob() {
+		return nil, fmt.Errorf("%s: invalid ref: %s", path, ref)
+	}
+	if id.Fragment() == MAIN {
+		// "nsid#main" is the same as "nsid"
+		return nsid.NewNSID(strings.TrimSuffix(s, "#"+MAIN))
+	}
+	return id, nil
+}
+
+// parseDef parses the definition at the path
+// The primary types are allowed only if primary is true.
+func (p *parser) parseDef(b json.RawMessage, path string, primary bool) (Def, error) {
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &typed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch typed.Type {
+	case TYPE_RECORD, TYPE_QUERY, TYPE_PROCEDURE, TYPE_SUBSCRIPTION:
+		if !primary {
+			return nil, fmt.Errorf("%s: %s type is allowed only as the main definition", path, typed.Type)
+		}
+	}
+
+	switch typed.Type {
+	case TYPE_RECORD:
+		return p.parseRecord(b, path)
+	case TYPE_QUERY:
+		var raw struct {
+			Description string          `json:"description"`
+			Parameters  json.RawMessage `json:"parameters"`
+			Output      json.RawMessage `json:"output"`
+			Errors      []Error         `json:"errors"`
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		def := &Query{Description: raw.Description, Errors: raw.Errors}
+		var err error
+		if def.Parameters, err = p.parseParams(raw.Parameters, path+"/parameters"); err != nil {
+			return nil, err
+		}
+		if def.Output, err = p.parseBody(raw.Output, path+"/output", true); err != nil {
+			return nil, err
+		}
+		return def, nil
+	case TYPE_PROCEDURE:
+		var raw struct {
+			Description string          `json:"description"`
+			Parameters  json.RawMessage `json:"parameters"`
+			Input       json.RawMessage `json:"input"`
+			Output      json.RawMessage `json:"output"`
+			Errors      []Error         `json:"errors"`
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		def := &Procedure{Description: raw.Description, Errors: raw.Errors}
+		var err error
+		if def.Parameters, err = p.parseParams(raw.Parameters, path+"/parameters"); err != nil {
+			return nil, err
+		}
+		if def.Input, err = p.parseBody(raw.Input, path+"/input", true); err != nil {
+			return nil, err
+		}
+		if def.Output, err = p.parseBody(raw.Output, path+"/output", true); err != nil {
+			return nil, err
+		}
+		return def, nil
+	case TYPE_SUBSCRIPTION:
+		var raw struct {
+			Description string          `json:"description"`
+			Parameters  json.RawMessage `json:"parameters"`
+			Message     json.RawMessage `json:"message"`
+			Errors      []Error         `json:"errors"`
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		def := &Subscription{Description: raw.Description, Errors: raw.Errors}
+		var err error
+		if def.Parameters, err = p.parseParams(raw.Parameters, path+"/parameters"); err != nil {
+			return nil, err
+		}
+		if def.Message, err = p.parseBody(raw.Message, path+"/message", false); err != nil {
+			return nil, err
+		}
+		return def, nil
+	case TYPE_PARAMS:
+		return p.parseParams(b, path)
+	case TYPE_OBJECT:
+		return p.parseObject(b, path)
+	case TYPE_ARRAY:
+		var raw struct {
+			Description string          `json:"description"`
+			Items       json.RawMessage `json:"items"`
+			MinLength   *int            `json:"minLength"`
+			MaxLength   *int            `json:"maxLength"`
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if raw.Items == nil {
+			return nil, fmt.Errorf("%s: items are missing", path)
+		}
+
+		items, err := p.parseDef(raw.Items, path+"/items", false)
+		if err != nil {
+			return nil, err
+		}
+		return &Array{Description: raw.Description, Items: items, MinLength: raw.MinLength, MaxLength: raw.MaxLength}, nil
+	case TYPE_REF:
+		var raw struct {
+			Description string `json:"description"`
+			Ref         string `json:"ref"`
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		ref, err := p.parseRef(raw.Ref, path)
+		if err != nil {
+			return nil, err
+		}
+		return &Ref{Description: raw.Description, Ref: ref}, nil
+	case TYPE_UNION:
+		var raw struct {
+			Description string   `json:"description"`
+			Refs        []string `json:"refs"`
+			Closed      bool     `json:"closed"`
+		}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if raw.Refs == nil {
+			return nil, fmt.Errorf("%s: refs are missing", path)
+		}
+
+		def := &Union{Description: raw.Description, Refs: make([]*nsid.NSID, 0, len(raw.Refs)), Closed: raw.Closed}
+		for _, r := range raw.Refs {
+			ref, err := p.parseRef(r, path)
+			if err != nil {
+				return nil, err
+			}
+			def.Refs = append(def.Refs, ref)
+		}
+		return def, nil
+	case TYPE_STRING:
+		def := &String{}
+		if err := unmarshalLeaf(b, def, path); err != nil {
+			return nil, err
+		}
+		if def.Format != "" && !format.Known(def.Format) {
+			return nil, fmt.Errorf("%s: unknown string format: %s", path, def.Format)
+		}
+		return def, nil
+	case TYPE_NULL:
+		def := &Null{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_BOOLEAN:
+		def := &Boolean{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_INTEGER:
+		def := &Integer{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_BYTES:
+		def := &Bytes{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_CID_LINK:
+		def := &CIDLink{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_BLOB:
+		def := &Blob{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_TOKEN:
+		def := &Token{}
+		return def, unmarshalLeaf(b, def, path)
+	case TYPE_UNKNOWN:
+		def := &Unknown{}
+		return def, unmarshalLeaf(b, def, path)
+	case "":
+		return nil, fmt.Errorf("%s: type is missing", path)
+	}
+
+	return nil, fmt.Errorf("%s: unknown type: %s", path, typed.Type)
+}
+
+// unmarshalLeaf unmarshals the definition without nested definitions
+// The JSON field names are the Go field names in lower camel case,
+// which encoding/json matches case-insensitively.
+func unmarshalLeaf(b json.RawMessage, def Def, path string) error {
+	if err := json.Unmarshal(b, def); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (p *parser) parseRecord(b json.RawMessage, path string) (*Record, error) {
+	var raw struct {
+		Description string          `json:"description"`
+		Key         string          `json:"key"`
+		Record      json.RawMessage `json:"record"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch {
+	case raw.Key == "tid", raw.Key == "nsid", raw.Key == "any":
+	case strings.HasPrefix(raw.Key, "literal:") && len(raw.Key) > len("literal:"):
+	default:
+		return nil, fmt.Errorf("%s: invalid record key type: %s", path, raw.Key)
+	}
+	if raw.Record == nil {
+		return nil, fmt.Errorf("%s: record is missing", path)
+	}
+
+	record, err := p.parseObject(raw.Record, path+"/record")
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Description: raw.Description, Key: raw.Key, Record: record}, nil
+}
+
+// parseProperties parses the properties and checks the required and nullable names
+func (p *parser) parseProperties(raw map[string]json.RawMessage, required []string, nullable []string, path string) (map[string]Def, error) {
+	properties := make(map[string]Def, len(raw))
+	for name, b := range raw {
+		def, err := p.parseDef(b, path+"/properties/"+name, false)
+		if err != nil {
+			return nil, err
+		}
+		properties[name] = def
+	}
+
+	for _, name := range required {
+		if _, ok := properties[name]; !ok {
+			return nil, fmt.Errorf("%s: required property is not defined: %s", path, name)
+		}
+	}
+	for _, name := range nullable {
+		if _, ok := properties[name]; !ok {
+			return nil, fmt.Errorf("%s: nullable property is not defined: %s", path, name)
+		}
+	}
+
+	return properties, nil
+}
+
+func (p *parser) parseObject(b json.RawMessage, path string) (*Object, error) {
+	var raw struct {
+		Type        string                     `json:"type"`
+		Description string                     `json:"description"`
+		Required    []string                   `json:"required"`
+		Nullable    []string                   `json:"nullable"`
+		Properties  map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if raw.Type != TYPE_OBJECT {
+		return nil, fmt.Errorf("%s: type must be object, got %s", path, raw.Type)
+	}
+
+	properties, err := p.parseProperties(raw.Properties, raw.Required, raw.Nullable, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Description: raw.Description, Required: raw.Required, Nullable: raw.Nullable, Properties: properties}, nil
+}
+
+// parseParams parses the parameters, or returns nil if b is empty
+func (p *parser) parseParams(b json.RawMessage, path string) (*Params, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	var raw struct {
+		Type        string                     `json:"type"`
+		Description string                     `json:"description"`
+		Required    []string                   `json:"required"`
+		Properties  map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if raw.Type != TYPE_PARAMS {
+		return nil, fmt.Errorf("%s: type must be params, got %s", path, raw.Type)
+	}
+
+	properties, err := p.parseProperties(raw.Properties, raw.Required, nil, path)
+	if err != nil {
+		return nil, err
+	}
+	for name, def := range properties {
+		items := def
+		if array, ok := def.(*Array); ok {
+			items = array.Items
+		}
+		switch items.Type() {
+		case TYPE_BOOLEAN, TYPE_INTEGER, TYPE_STRING, TYPE_UNKNOWN:
+		default:
+			return nil, fmt.Errorf("%s/properties/%s: %s type is not allowed in params", path, name, def.Type())
+		}
+	}
+
+	return &Params{Description: raw.Description, Required: raw.Required, Properties: properties}, nil
+}
+
+// parseBody parses the body of an XRPC method, or returns nil if b is empty
+// If encoding is true, the encoding of the body is required.
+func (p *parser) parseBody(b json.RawMessage, path string, encoding bool) (*Body, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	var raw struct {
+		Description string          `json:"description"`
+		Encoding    string          `json:"encoding"`
+		Schema      json.RawMessage `json:"schema"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if encoding && raw.Encoding == "" {
+		return nil, fmt.Errorf("%s: encoding is missing", path)
+	}
+
+	body := &Body{Description: raw.Description, Encoding: raw.Encoding}
+	if raw.Schema == nil {
+		return body, nil
+	}
+
+	schema, err := p.parseDef(raw.Schema, path+"/schema", false)
+	if err != nil {
+		return nil, err
+	}
+	switch schema.Type() {
+	case TYPE_OBJECT, TYPE_REF, TYPE_UNION:
+	default:
+		return nil, fmt.Errorf("%s/schema: type must be object, ref or union, got %s", path, schema.Type())
+	}
+	body.Schema = schema
+
+	return body, nil
+}
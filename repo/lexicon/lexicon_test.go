@@ -0,0 +1,410 @@
+package lexicon_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const testPost = `{
+	"lexicon": 1,
+	"id": "app.bsky.feed.post",
+	"defs": {
+		"main": {
+			"type": "record",
+			"description": "Record containing a Bluesky post.",
+			"key": "tid",
+			"record": {
+				"type": "object",
+				"required": ["text", "createdAt"],
+				"properties": {
+					"text": {"type": "string", "maxLength": 3000, "maxGraphemes": 300},
+					"reply": {"type": "ref", "ref": "#replyRef"},
+					"embed": {"type": "union", "refs": ["app.bsky.embed.images", "app.bsky.embed.external#main"]},
+					"langs": {"type": "array", "maxLength": 3, "items": {"type": "string", "format": "language"}},
+					"tags": {"type": "array", "items": {"type": "string", "maxGraphemes": 64}},
+					"createdAt": {"type": "string", "format": "datetime"}
+				}
+			}
+		},
+		"replyRef": {
+			"type": "object",
+			"required": ["root", "parent"],
+			"properties": {
+				"root": {"type": "ref", "ref": "com.atproto.repo.strongRef"},
+				"parent": {"type": "ref", "ref": "com.atproto.repo.strongRef"}
+			}
+		}
+	}
+}`
+
+const testImages = `{
+	"lexicon": 1,
+	"id": "app.bsky.embed.images",
+	"defs": {
+		"main": {
+			"type": "object",
+			"required": ["images"],
+			"properties": {
+				"images": {"type": "array", "items": {"type": "ref", "ref": "#image"}, "maxLength": 4}
+			}
+		},
+		"image": {
+			"type": "object",
+			"required": ["image", "alt"],
+			"properties": {
+				"image": {"type": "blob", "accept": ["image/*"], "maxSize": 1000000},
+				"alt": {"type": "string"}
+			}
+		}
+	}
+}`
+
+const testExternal = `{
+	"lexicon": 1,
+	"id": "app.bsky.embed.external",
+	"defs": {
+		"main": {
+			"type": "object",
+			"required": ["uri"],
+			"properties": {"uri": {"type": "string", "format": "uri"}}
+		}
+	}
+}`
+
+const testStrongRef = `{
+	"lexicon": 1,
+	"id": "com.atproto.repo.strongRef",
+	"defs": {
+		"main": {
+			"type": "object",
+			"required": ["uri", "cid"],
+			"properties": {
+				"uri": {"type": "string", "format": "at-uri"},
+				"cid": {"type": "string", "format": "cid"}
+			}
+		}
+	}
+}`
+
+const testGetRecord = `{
+	"lexicon": 1,
+	"id": "com.atproto.repo.getRecord",
+	"defs": {
+		"main": {
+			"type": "query",
+			"parameters": {
+				"type": "params",
+				"required": ["repo", "collection", "rkey"],
+				"properties": {
+					"repo": {"type": "string", "format": "at-identifier"},
+					"collection": {"type": "string", "format": "nsid"},
+					"rkey": {"type": "string", "format": "record-key"},
+					"cid": {"type": "string", "format": "cid"}
+				}
+			},
+			"output": {
+				"encoding": "application/json",
+				"schema": {
+					"type": "object",
+					"required": ["uri", "value"],
+					"properties": {
+						"uri": {"type": "string", "format": "at-uri"},
+						"cid": {"type": "string", "format": "cid"},
+						"value": {"type": "unknown"}
+					}
+				}
+			},
+			"errors": [{"name": "RecordNotFound"}]
+		}
+	}
+}`
+
+const testUploadBlob = `{
+	"lexicon": 1,
+	"id": "com.atproto.repo.uploadBlob",
+	"defs": {
+		"main": {
+			"type": "procedure",
+			"input": {"encoding": "*/*"},
+			"output": {
+				"encoding": "application/json",
+				"schema": {"type": "object", "required": ["blob"], "properties": {"blob": {"type": "blob"}}}
+			}
+		}
+	}
+}`
+
+const testSubscribeRepos = `{
+	"lexicon": 1,
+	"id": "com.atproto.sync.subscribeRepos",
+	"defs": {
+		"main": {
+			"type": "subscription",
+			"parameters": {"type": "params", "properties": {"cursor": {"type": "integer"}}},
+			"message": {"schema": {"type": "union", "refs": ["#info"]}},
+			"errors": [{"name": "FutureCursor"}, {"name": "ConsumerTooSlow"}]
+		},
+		"info": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {"name": {"type": "string", "knownValues": ["OutdatedCursor"]}}
+		},
+		"token": {"type": "token", "description": "a token"}
+	}
+}`
+
+func mustNSID(t *testing.T, s string) *nsid.NSID {
+	t.Helper()
+
+	id, err := nsid.NewNSID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestParse(t *testing.T) {
+	lex, err := lexicon.Parse([]byte(testPost))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if lex.ID.String() != "app.bsky.feed.post" || len(lex.Defs) != 2 {
+		t.Fatalf("Parse() = %+v", lex)
+	}
+
+	record, ok := lex.Main().(*lexicon.Record)
+	if !ok || record.Key != "tid" {
+		t.Fatalf("Parse() main = %#v, want tid record", lex.Main())
+	}
+
+	text := record.Record.Properties["text"].(*lexicon.String)
+	if *text.MaxLength != 3000 || *text.MaxGraphemes != 300 || text.MinLength != nil {
+		t.Errorf("Parse() text = %+v", text)
+	}
+
+	reply := record.Record.Properties["reply"].(*lexicon.Ref)
+	if reply.Ref.String() != "app.bsky.feed.post#replyRef" {
+		t.Errorf("Parse() reply ref = %v, want app.bsky.feed.post#replyRef", reply.Ref)
+	}
+
+	embed := record.Record.Properties["embed"].(*lexicon.Union)
+	if len(embed.Refs) != 2 || embed.Refs[1].String() != "app.bsky.embed.external" {
+		t.Errorf("Parse() embed refs = %v", embed.Refs)
+	}
+
+	langs := record.Record.Properties["langs"].(*lexicon.Array)
+	if langs.Items.(*lexicon.String).Format != lexicon.FORMAT_LANGUAGE {
+		t.Errorf("Parse() langs = %+v", langs.Items)
+	}
+
+	query, err := lexicon.Parse([]byte(testGetRecord))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	q := query.Main().(*lexicon.Query)
+	if len(q.Parameters.Required) != 3 || q.Output.Encoding != "application/json" || q.Errors[0].Name != "RecordNotFound" {
+		t.Errorf("Parse() query = %+v", q)
+	}
+
+	sub, err := lexicon.Parse([]byte(testSubscribeRepos))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	s := sub.Main().(*lexicon.Subscription)
+	if s.Message.Schema.Type() != lexicon.TYPE_UNION || len(s.Errors) != 2 {
+		t.Errorf("Parse() subscription = %+v", s)
+	}
+	if sub.Defs["token"].Type() != lexicon.TYPE_TOKEN {
+		t.Errorf("Parse() token = %+v", sub.Defs["token"])
+	}
+}
+
+func TestParse_Failure(t *testing.T) {
+	tests := []struct {
+		name string
+		b    string
+	}{
+		{
+			name: "failure case: unsupported version",
+			b:    `{"lexicon": 2, "id": "com.example.test", "defs": {"main": {"type": "token"}}}`,
+		},
+		{
+			name: "failure case: invalid id",
+			b:    `{"lexicon": 1, "id": "example", "defs": {"main": {"type": "token"}}}`,
+		},
+		{
+			name: "failure case: empty defs",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {}}`,
+		},
+		{
+			name: "failure case: record not as main",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"other": {"type": "record", "key": "tid", "record": {"type": "object"}}}}`,
+		},
+		{
+			name: "failure case: invalid record key",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "record", "key": "literal:", "record": {"type": "object"}}}}`,
+		},
+		{
+			name: "failure case: unknown type",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "float"}}}`,
+		},
+		{
+			name: "failure case: unknown format",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "string", "format": "email"}}}`,
+		},
+		{
+			name: "failure case: required property is not defined",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "object", "required": ["a"], "properties": {}}}}`,
+		},
+		{
+			name: "failure case: invalid ref",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "ref", "ref": "#a-b"}}}`,
+		},
+		{
+			name: "failure case: object in params",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "query", "parameters": {"type": "params", "properties": {"a": {"type": "object"}}}}}}`,
+		},
+		{
+			name: "failure case: missing output encoding",
+			b:    `{"lexicon": 1, "id": "com.example.test", "defs": {"main": {"type": "query", "output": {"schema": {"type": "object"}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lexicon.Parse([]byte(tt.b)); err == nil {
+				t.Errorf("Parse() error = nil, wantErr true")
+			}
+		})
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	catalog := lexicon.NewCatalog()
+	err := catalog.LoadFS(fstest.MapFS{
+		"app/bsky/feed/post.json":              {Data: []byte(testPost)},
+		"app/bsky/embed/images.json":           {Data: []byte(testImages)},
+		"app/bsky/embed/external.json":         {Data: []byte(testExternal)},
+		"com/atproto/repo/strongRef.json":      {Data: []byte(testStrongRef)},
+		"com/atproto/repo/getRecord.json":      {Data: []byte(testGetRecord)},
+		"com/atproto/repo/uploadBlob.json":     {Data: []byte(testUploadBlob)},
+		"com/atproto/sync/subscribeRepos.json": {Data: []byte(testSubscribeRepos)},
+		"README.md":                            {Data: []byte("not a lexicon")},
+	})
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+
+	if got := len(catalog.IDs()); got != 7 {
+		t.Errorf("IDs() = %d lexicons, want 7", got)
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		wantType string
+		wantErr  error
+	}{
+		{
+			name:     "successfull case: main",
+			ref:      "app.bsky.feed.post",
+			wantType: lexicon.TYPE_RECORD,
+		},
+		{
+			name:     "successfull case: fragment",
+			ref:      "app.bsky.feed.post#replyRef",
+			wantType: lexicon.TYPE_OBJECT,
+		},
+		{
+			name:     "successfull case: case-insensitive authority",
+			ref:      "App.Bsky.Embed.images#image",
+			wantType: lexicon.TYPE_OBJECT,
+		},
+		{
+			name:    "failure case: unknown lexicon",
+			ref:     "app.bsky.feed.like",
+			wantErr: lexicon.ErrDanglingRef,
+		},
+		{
+			name:    "failure case: unknown definition",
+			ref:     "app.bsky.feed.post#unknown",
+			wantErr: lexicon.ErrDanglingRef,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := catalog.Resolve(mustNSID(t, tt.ref))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && def.Type() != tt.wantType {
+				t.Errorf("Resolve() = %v, want %v", def.Type(), tt.wantType)
+			}
+		})
+	}
+
+	if _, err := catalog.AddJSON([]byte(testPost)); !errors.Is(err, lexicon.ErrExists) {
+		t.Errorf("AddJSON() error = %v, want ErrExists", err)
+	}
+}
+
+func TestCatalog_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		docs    []string
+		wantErr error
+	}{
+		{
+			name: "successfull case: recursive object",
+			docs: []string{`{"lexicon": 1, "id": "com.example.thread", "defs": {
+				"main": {"type": "object", "properties": {"replies": {"type": "array", "items": {"type": "union", "refs": ["#main"]}}}}
+			}}`},
+		},
+		{
+			name:    "failure case: dangling ref",
+			docs:    []string{testPost},
+			wantErr: lexicon.ErrDanglingRef,
+		},
+		{
+			name: "failure case: dangling ref in union",
+			docs: []string{`{"lexicon": 1, "id": "com.example.test", "defs": {
+				"main": {"type": "union", "refs": ["#a"]}
+			}}`},
+			wantErr: lexicon.ErrDanglingRef,
+		},
+		{
+			name: "failure case: ref cycle",
+			docs: []string{
+				`{"lexicon": 1, "id": "com.example.a", "defs": {"main": {"type": "ref", "ref": "com.example.b"}}}`,
+				`{"lexicon": 1, "id": "com.example.b", "defs": {"main": {"type": "ref", "ref": "com.example.a#main"}}}`,
+			},
+			wantErr: lexicon.ErrRefCycle,
+		},
+		{
+			name: "failure case: self ref",
+			docs: []string{`{"lexicon": 1, "id": "com.example.test", "defs": {
+				"main": {"type": "object", "properties": {"a": {"type": "ref", "ref": "#a"}}},
+				"a": {"type": "ref", "ref": "#a"}
+			}}`},
+			wantErr: lexicon.ErrRefCycle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := lexicon.NewCatalog()
+			for _, doc := range tt.docs {
+				if _, err := catalog.AddJSON([]byte(doc)); err != nil {
+					t.Fatalf("AddJSON() error = %v", err)
+				}
+			}
+
+			err := catalog.Check()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
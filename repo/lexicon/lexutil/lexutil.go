@@ -0,0 +1,129 @@
+// the package lexutil is the runtime of the Go code generated from Lexicon schemas;
+// atproto data model types in JSON, DAG-CBOR marshaling through the package data,
+// and the XRPC client interface
+
+package lexutil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/data"
+)
+
+// RequestKind is the kind of XRPC request
+type RequestKind int
+
+const (
+	QUERY     RequestKind = iota // HTTP GET
+	PROCEDURE                    // HTTP POST
+)
+
+// Client calls XRPC methods
+// The input is nil, an io.Reader of the raw body, or a value encoded in JSON.
+// The output is nil, a *bytes.Buffer for the raw body, or a pointer decoded from JSON.
+type Client interface {
+	Do(ctx context.Context, kind RequestKind, encoding string, method string, params url.Values, input interface{}, output interface{}) error
+}
+
+// Link is a CID link, `{"$link": "<cid>"}` in JSON
+type Link cid.Cid
+
+func (l Link) String() string {
+	return cid.Cid(l).String()
+}
+
+func (l Link) MarshalJSON() ([]byte, error) {
+	if !cid.Cid(l).Defined() {
+		return nil, fmt.Errorf("failed to marshal link; CID is undefined")
+	}
+	return json.Marshal(map[string]string{"$link": cid.Cid(l).String()})
+}
+
+func (l *Link) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Link string `json:"$link"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("invalid link; %w", err)
+	}
+	c, err := cid.Decode(v.Link)
+	if err != nil {
+		return fmt.Errorf("invalid link: %s; %w", v.Link, err)
+	}
+	*l = Link(c)
+	return nil
+}
+
+// Bytes is bytes, `{"$bytes": "<base64>"}` in JSON
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"$bytes": base64.RawStdEncoding.EncodeToString(b)})
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Bytes string `json:"$bytes"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid bytes; %w", err)
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(v.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid bytes; %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// Blob is a reference to a blob
+type Blob struct {
+	LexiconTypeID string `json:"$type"` // always data.TYPE_BLOB
+	Ref           Link   `json:"ref"`
+	MimeType      string `json:"mimeType"`
+	Size          int64  `json:"size"`
+}
+
+func (b Blob) MarshalJSON() ([]byte, error) {
+	type blob Blob
+	v := blob(b)
+	v.LexiconTypeID = data.TYPE_BLOB
+	return json.Marshal(&v)
+}
+
+// TypeOf returns the $type of the JSON object
+func TypeOf(b []byte) (string, error) {
+	var v struct {
+		Type string `json:"$type"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", err
+	}
+	if v.Type == "" {
+		return "", fmt.Errorf("$type is missing")
+	}
+	return v.Type, nil
+}
+
+// MarshalCBOR encodes the value into DAG-CBOR through its JSON representation
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return data.JSONToCBOR(b)
+}
+
+// UnmarshalCBOR decodes the DAG-CBOR into the value through its JSON representation
+func UnmarshalCBOR(b []byte, v interface{}) error {
+	j, err := data.CBORToJSON(b)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
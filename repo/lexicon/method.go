@@ -0,0 +1,184 @@
+package lexicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+// MatchEncoding returns true if the encoding matches the encoding of a body, e.g. "*/*" or "image/*"
+func MatchEncoding(pattern string, encoding string) bool {
+	if pattern == "*/*" {
+		return true
+	}
+	if mediaType, _, err := mime.ParseMediaType(encoding); err == nil {
+		encoding = mediaType
+	}
+	ok, _ := path.Match(pattern, encoding)
+	return ok
+}
+
+// method returns the query, procedure or subscription definition of the XRPC method
+func (v *Validator) method(method *nsid.NSID) (Def, error) {
+	def, err := v.Catalog.Resolve(method)
+	if err != nil {
+		return nil, err
+	}
+	switch def.(type) {
+	case *Query, *Procedure, *Subscription:
+		return def, nil
+	}
+	return nil, fmt.Errorf("invalid method: %s; %s is not an XRPC method", method, def.Type())
+}
+
+// ValidateParams validates the query parameters of the XRPC method
+// The values are converted to the types of the properties; the parameters not in the schema are allowed.
+func (v *Validator) ValidateParams(method *nsid.NSID, params url.Values) error {
+	def, err := v.method(method)
+	if err != nil {
+		return err
+	}
+
+	var d *Params
+	switch m := def.(type) {
+	case *Query:
+		d = m.Parameters
+	case *Procedure:
+		d = m.Parameters
+	case *Subscription:
+		d = m.Parameters
+	}
+	if d == nil {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(params))
+	for _, name := range sortedKeys(d.Properties) {
+		ss, ok := params[name]
+		if !ok {
+			continue
+		}
+
+		prop := d.Properties[name]
+		if array, ok := prop.(*Array); ok {
+			items := make([]interface{}, 0, len(ss))
+			for i, s := range ss {
+				item, ok, err := paramValue(array.Items, s, "/"+name+"/"+strconv.Itoa(i))
+				if err != nil {
+					return err
+				}
+				if ok {
+					items = append(items, item)
+				}
+			}
+			values[name] = items
+			continue
+		}
+
+		if len(ss) > 1 {
+			return invalid("/"+name, "must not be repeated")
+		}
+		value, ok, err := paramValue(prop, ss[0], "/"+name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			values[name] = value
+		}
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	n, err := data.DecodeJSON(b)
+	if err != nil {
+		return err
+	}
+	return v.validate(d, n, "")
+}
+
+// paramValue converts the parameter to the type of the definition
+// It returns false if the parameter is not validated, i.e. of the unknown type.
+func paramValue(def Def, s string, p string) (interface{}, bool, error) {
+	switch def.(type) {
+	case *Integer:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, false, invalid(p, "expected integer")
+		}
+		return n, true, nil
+	case *Boolean:
+		switch s {
+		case "true":
+			return true, true, nil
+		case "false":
+			return false, true, nil
+		}
+		return nil, false, invalid(p, "expected boolean")
+	case *Unknown:
+		return nil, false, nil
+	}
+	return s, true, nil
+}
+
+// ValidateInput validates the input of the procedure
+// The encoding is empty if there is no input, and the value is nil if the input is not JSON.
+func (v *Validator) ValidateInput(method *nsid.NSID, encoding string, value datamodel.Node) error {
+	def, err := v.method(method)
+	if err != nil {
+		return err
+	}
+	d, ok := def.(*Procedure)
+	if !ok {
+		return fmt.Errorf("invalid method: %s; %s has no input", method, def.Type())
+	}
+	return v.validateBody(d.Input, encoding, value)
+}
+
+// ValidateOutput validates the output of the query or the procedure
+// The encoding is empty if there is no output, and the value is nil if the output is not JSON.
+func (v *Validator) ValidateOutput(method *nsid.NSID, encoding string, value datamodel.Node) error {
+	def, err := v.method(method)
+	if err != nil {
+		return err
+	}
+	switch d := def.(type) {
+	case *Query:
+		return v.validateBody(d.Output, encoding, value)
+	case *Procedure:
+		return v.validateBody(d.Output, encoding, value)
+	}
+	return fmt.Errorf("invalid method: %s; %s has no output", method, def.Type())
+}
+
+// validateBody validates the body against the input or the output of a method
+func (v *Validator) validateBody(d *Body, encoding string, value datamodel.Node) error {
+	if d == nil {
+		if encoding != "" {
+			return invalid("", "must have no body")
+		}
+		return nil
+	}
+
+	if encoding == "" {
+		return invalid("", "body is missing")
+	}
+	if !MatchEncoding(d.Encoding, encoding) {
+		return invalid("", "encoding must be %s, got %s", d.Encoding, encoding)
+	}
+	if d.Schema == nil {
+		return nil
+	}
+	if value == nil {
+		return invalid("", "expected JSON body")
+	}
+	return v.validate(d.Schema, value, "")
+}
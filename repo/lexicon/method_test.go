@@ -0,0 +1,165 @@
+package lexicon_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+)
+
+const testQuery = `{
+	"lexicon": 1,
+	"id": "com.example.getItems",
+	"defs": {
+		"main": {
+			"type": "query",
+			"parameters": {
+				"type": "params",
+				"required": ["actor"],
+				"properties": {
+					"actor": {"type": "string", "format": "at-identifier"},
+					"limit": {"type": "integer", "minimum": 1, "maximum": 100},
+					"reverse": {"type": "boolean"},
+					"tags": {"type": "array", "maxLength": 2, "items": {"type": "string"}}
+				}
+			},
+			"output": {
+				"encoding": "application/json",
+				"schema": {"type": "object", "required": ["items"], "properties": {"items": {"type": "array", "items": {"type": "integer"}}}}
+			}
+		}
+	}
+}`
+
+const testProcedure = `{
+	"lexicon": 1,
+	"id": "com.example.uploadItem",
+	"defs": {
+		"main": {
+			"type": "procedure",
+			"input": {"encoding": "image/*"},
+			"output": {
+				"encoding": "application/json",
+				"schema": {"type": "object", "required": ["size"], "properties": {"size": {"type": "integer"}}}
+			}
+		}
+	}
+}`
+
+func testMethodValidator(t *testing.T) *lexicon.Validator {
+	t.Helper()
+
+	catalog := lexicon.NewCatalog()
+	for _, doc := range []string{testQuery, testProcedure, testRecord, testOther} {
+		if _, err := catalog.AddJSON([]byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return lexicon.NewValidator(catalog)
+}
+
+func TestValidator_ValidateParams(t *testing.T) {
+	v := testMethodValidator(t)
+	method := mustNSID(t, "com.example.getItems")
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"successfull case", "actor=alice.test&limit=10&reverse=true&tags=a&tags=b", false},
+		{"successfull case; unknown params", "actor=did:plc:alice&other=1", false},
+		{"failure case; missing required", "limit=10", true},
+		{"failure case; not integer", "actor=alice.test&limit=ten", true},
+		{"failure case; out of range", "actor=alice.test&limit=1000", true},
+		{"failure case; not boolean", "actor=alice.test&reverse=yes", true},
+		{"failure case; repeated", "actor=alice.test&actor=bob.test", true},
+		{"failure case; too many items", "actor=alice.test&tags=a&tags=b&tags=c", true},
+		{"failure case; invalid format", "actor=not%20a%20handle", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.ValidateParams(method, params); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := v.ValidateParams(mustNSID(t, "com.example.record"), nil); err == nil {
+		t.Errorf("ValidateParams() error = nil, want not a method")
+	}
+}
+
+func TestValidator_ValidateBody(t *testing.T) {
+	v := testMethodValidator(t)
+	query := mustNSID(t, "com.example.getItems")
+	procedure := mustNSID(t, "com.example.uploadItem")
+
+	node := func(s string) datamodel.Node {
+		n, err := data.DecodeJSON([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	tests := []struct {
+		name     string
+		validate func() error
+		wantErr  bool
+	}{
+		{"successfull case; output", func() error {
+			return v.ValidateOutput(query, "application/json; charset=utf-8", node(`{"items": [1, 2]}`))
+		}, false},
+		{"successfull case; blob input", func() error {
+			return v.ValidateInput(procedure, "image/png", nil)
+		}, false},
+		{"failure case; invalid output", func() error {
+			return v.ValidateOutput(query, "application/json", node(`{"items": ["a"]}`))
+		}, true},
+		{"failure case; missing output", func() error {
+			return v.ValidateOutput(query, "", nil)
+		}, true},
+		{"failure case; output is not JSON", func() error {
+			return v.ValidateOutput(query, "application/json", nil)
+		}, true},
+		{"failure case; encoding mismatch", func() error {
+			return v.ValidateInput(procedure, "text/plain", nil)
+		}, true},
+		{"failure case; query has no input", func() error {
+			return v.ValidateInput(query, "application/json", nil)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchEncoding(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		encoding string
+		want     bool
+	}{
+		{"*/*", "application/vnd.ipld.car", true},
+		{"image/*", "image/png", true},
+		{"application/json", "application/json; charset=utf-8", true},
+		{"image/*", "video/mp4", false},
+		{"application/json", "text/plain", false},
+	}
+	for _, tt := range tests {
+		if got := lexicon.MatchEncoding(tt.pattern, tt.encoding); got != tt.want {
+			t.Errorf("MatchEncoding(%q, %q) = %v, want %v", tt.pattern, tt.encoding, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// the package resolver resolves NSIDs into Lexicon schemas
+// with the Lexicon DNS resolution flow:
+//
+//  1. look up the `_lexicon.<authority>` TXT record to find the authority DID
+//  2. resolve the DID to find the PDS of the authority
+//  3. fetch the `com.atproto.lexicon.schema` record of the NSID from the PDS
+
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	didresolver "go.yumnet.cloud/orangesea/did/resolver"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const (
+	SCHEMA_COLLECTION = "com.atproto.lexicon.schema"
+	DEFAULT_CACHE_TTL = time.Hour
+)
+
+// TXTResolver looks up DNS TXT records
+// *net.Resolver satisfies this interface.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Schema is a resolved Lexicon schema record
+type Schema struct {
+	NSID   *nsid.NSID
+	DID    string          // DID of the authority
+	URI    string          // at-uri of the schema record
+	CID    string          // CID of the schema record
+	Schema json.RawMessage // the Lexicon schema document
+}
+
+type cacheEntry struct {
+	schema  *Schema
+	expires time.Time
+}
+
+// Resolver resolves NSIDs into Lexicon schemas
+// Resolved schemas are cached for TTL.
+// Resolver is safe for concurrent use.
+type Resolver struct {
+	DNS    TXTResolver
+	DIDs   didresolver.DIDResolver
+	Client *http.Client
+	TTL    time.Duration
+	Now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewResolver returns a new Resolver with the system DNS resolver,
+// the default DID resolver and the default HTTP client.
+func NewResolver() *Resolver {
+	return &Resolver{
+		DNS:    net.DefaultResolver,
+		DIDs:   didresolver.NewResolver(),
+		Client: http.DefaultClient,
+		TTL:    DEFAULT_CACHE_TTL,
+		Now:    time.Now,
+	}
+}
+
+func (r *Resolver) now() time.Time {
+	if r.Now == nil {
+		return time.Now()
+	}
+	return r.Now()
+}
+
+// schemaID returns the NSID without the fragment,
+// which is the rkey of the schema record
+func schemaID(n *nsid.NSID) string {
+	return strings.Join(n.DSegments(), ".") + "." + n.Name()
+}
+
+// ResolveAuthority looks up the DID of the authority of the NSID
+func (r *Resolver) ResolveAuthority(ctx context.Context, n *nsid.NSID) (string, error) {
+	if n.Glob() {
+		return "", fmt.Errorf("failed to resolve NSID: %s; NSID must not have glob", n)
+	}
+
+	name := "_lexicon." + n.Authority()
+	records, err := r.DNS.LookupTXT(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve NSID: %s; failed to look up %s: %w", n, name, err)
+	}
+
+	var did string
+	for _, record := range records {
+		value, ok := strings.CutPrefix(strings.TrimSpace(record), "did=")
+		if !ok {
+			continue
+		}
+		if did != "" && did != value {
+			return "", fmt.Errorf("failed to resolve NSID: %s; multiple DIDs found in %s", n, name)
+		}
+		did = value
+	}
+
+	if !strings.HasPrefix(did, "did:") {
+		return "", fmt.Errorf("failed to resolve NSID: %s; no DID found in %s", n, name)
+	}
+
+	return did, nil
+}
+
+// Resolve resolves the NSID into the Lexicon schema
+// The fragment of the NSID is ignored since a schema record covers all definitions.
+func (r *Resolver) Resolve(ctx context.Context, n *nsid.NSID) (*Schema, error) {
+	id := schemaID(n)
+
+	r.mu.Lock()
+	entry, ok := r.cache[id]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expires) {
+		return entry.schema, nil
+	}
+
+	did, err := r.ResolveAuthority(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := r.DIDs.Resolve(ctx, did)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve NSID: %s; %w", n, err)
+	}
+
+	endpoint, err := doc.PDSEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve NSID: %s; %w", n, err)
+	}
+
+	schema, err := r.fetchSchema(ctx, endpoint, did, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve NSID: %s; %w", n, err)
+	}
+	schema.NSID = n
+
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]cacheEntry)
+	}
+	r.cache[id] = cacheEntry{
+		schema:  schema,
+		expires: r.now().Add(r.TTL),
+	}
+	r.mu.Unlock()
+
+	return schema, nil
+}
+
+// Invalidate removes the cached schema of the NSID
+func (r *Resolver) Invalidate(n *nsid.NSID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, schemaID(n))
+}
+
+func (r *Resolver) fetchSchema(ctx context.Context, endpoint string, did string, id string) (*Schema, error) {
+	query := url.Values{}
+	query.Set("repo", did)
+	query.Set("collection", SCHEMA_COLLECTION)
+	query.Set("rkey", id)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("%s/xrpc/com.atproto.repo.getRecord?%s", endpoint, query.Encode()),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema record; %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"failed to fetch schema record; status code: %d", resp.StatusCode,
+		)
+	}
+
+	var record struct {
+		URI   string          `json:"uri"`
+		CID   string          `json:"cid"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode schema record; %w", err)
+	}
+
+	var header struct {
+		Type    string `json:"$type"`
+		Lexicon int    `json:"lexicon"`
+		ID      string `json:"id"`
+	}
+	if err := json.Unmarshal(record.Value, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode schema record; %w", err)
+	}
+	if header.Type != SCHEMA_COLLECTION {
+		return nil, fmt.Errorf("invalid schema record; $type must be %s", SCHEMA_COLLECTION)
+	}
+	if header.ID != id {
+		return nil, fmt.Errorf("invalid schema record; id mismatch: %s", header.ID)
+	}
+
+	return &Schema{
+		DID:    did,
+		URI:    record.URI,
+		CID:    record.CID,
+		Schema: record.Value,
+	}, nil
+}
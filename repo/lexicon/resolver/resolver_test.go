@@ -0,0 +1,154 @@
+package resolver_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	didresolver "go.yumnet.cloud/orangesea/did/resolver"
+	"go.yumnet.cloud/orangesea/repo/lexicon/resolver"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const testDID = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+type fakeDNS map[string][]string
+
+func (d fakeDNS) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := d[name]
+	if !ok {
+		return nil, fmt.Errorf("no such host: %s", name)
+	}
+	return records, nil
+}
+
+type fakeDIDs map[string]*didresolver.Document
+
+func (d fakeDIDs) Resolve(ctx context.Context, did string) (*didresolver.Document, error) {
+	doc, ok := d[did]
+	if !ok {
+		return nil, fmt.Errorf("DID not found: %s", did)
+	}
+	return doc, nil
+}
+
+func newTestResolver(t *testing.T) (*resolver.Resolver, *int) {
+	t.Helper()
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/xrpc/com.atproto.repo.getRecord" ||
+			q.Get("repo") != testDID ||
+			q.Get("collection") != resolver.SCHEMA_COLLECTION {
+			http.NotFound(w, r)
+			return
+		}
+
+		fetches++
+		rkey := q.Get("rkey")
+		id := rkey
+		if rkey == "com.example.mismatch" {
+			id = "com.example.other"
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"uri": fmt.Sprintf("at://%s/%s/%s", testDID, resolver.SCHEMA_COLLECTION, rkey),
+			"cid": "bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454",
+			"value": map[string]interface{}{
+				"$type":   resolver.SCHEMA_COLLECTION,
+				"lexicon": 1,
+				"id":      id,
+				"defs":    map[string]interface{}{},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return &resolver.Resolver{
+		DNS: fakeDNS{
+			"_lexicon.example.com": {"did=" + testDID},
+			"_lexicon.multi.com":   {"did=did:plc:aaa", "did=did:plc:bbb"},
+			"_lexicon.none.com":    {"v=spf1 -all"},
+		},
+		DIDs: fakeDIDs{
+			testDID: {
+				ID: testDID,
+				Service: []didresolver.Service{
+					{
+						ID:              "#atproto_pds",
+						Type:            "AtprotoPersonalDataServer",
+						ServiceEndpoint: srv.URL,
+					},
+				},
+			},
+		},
+		Client: srv.Client(),
+		TTL:    time.Minute,
+	}, &fetches
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	r, fetches := newTestResolver(t)
+
+	n, err := nsid.NewNSID("com.example.fooBar#main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := r.Resolve(context.Background(), n)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if schema.DID != testDID {
+		t.Errorf("Resolve().DID = %v, want %v", schema.DID, testDID)
+	}
+	wantURI := fmt.Sprintf("at://%s/%s/com.example.fooBar", testDID, resolver.SCHEMA_COLLECTION)
+	if schema.URI != wantURI {
+		t.Errorf("Resolve().URI = %v, want %v", schema.URI, wantURI)
+	}
+
+	// the second resolution must be served from the cache
+	if _, err := r.Resolve(context.Background(), n); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if *fetches != 1 {
+		t.Errorf("schema fetched %d times, want %d", *fetches, 1)
+	}
+
+	r.Invalidate(n)
+	if _, err := r.Resolve(context.Background(), n); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if *fetches != 2 {
+		t.Errorf("schema fetched %d times, want %d", *fetches, 2)
+	}
+}
+
+func TestResolver_Resolve_Failure(t *testing.T) {
+	r, _ := newTestResolver(t)
+
+	tests := []string{
+		"com.example.*",        // glob
+		"com.example.mismatch", // schema id mismatch
+		"com.unknown.fooBar",   // no TXT record
+		"com.multi.fooBar",     // multiple DIDs
+		"com.none.fooBar",      // no DID in TXT records
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			n, err := nsid.NewNSID(tt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Resolve(context.Background(), n); err == nil {
+				t.Errorf("Resolve() error = nil, wantErr true")
+			}
+		})
+	}
+}
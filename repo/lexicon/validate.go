@@ -0,0 +1,453 @@
+package lexicon
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/rivo/uniseg"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/format"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+	"go.yumnet.cloud/orangesea/repo/rkey"
+)
+
+// ValidationError is an error of data not matching the schema
+// Path is a JSON-pointer-like path to the invalid value, e.g. "/embed/images/0/alt",
+// and is empty for the root.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	p := e.Path
+	if p == "" {
+		p = "/"
+	}
+	return fmt.Sprintf("invalid data at %s: %s", p, e.Message)
+}
+
+func invalid(p string, format string, args ...interface{}) error {
+	return &ValidationError{Path: p, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validator validates data against the Lexicons in the catalog
+type Validator struct {
+	Catalog *Catalog
+}
+
+// NewValidator returns a new Validator of the catalog
+func NewValidator(catalog *Catalog) *Validator {
+	return &Validator{
+		Catalog: catalog,
+	}
+}
+
+// recordDef returns the record definition of the collection
+func (v *Validator) recordDef(collection string) (*Record, error) {
+	id, err := nsid.NewNSID(collection)
+	if err != nil {
+		return nil, err
+	}
+	if id.Glob() || id.Fragment() != "" {
+		return nil, fmt.Errorf("invalid collection: %s; must not have glob or fragment", collection)
+	}
+
+	def, err := v.Catalog.Def(id)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := def.(*Record)
+	if !ok {
+		return nil, fmt.Errorf("invalid collection: %s; %s is not a record type", collection, def.Type())
+	}
+	return record, nil
+}
+
+// ValidateRecord validates the record data against the record schema of the collection
+// The record must be a map with $type of the collection.
+// It returns *ValidationError if the data does not match the schema.
+func (v *Validator) ValidateRecord(collection string, value datamodel.Node) error {
+	record, err := v.recordDef(collection)
+	if err != nil {
+		return err
+	}
+
+	if value.Kind() != datamodel.Kind_Map {
+		return invalid("", "record must be an object")
+	}
+	typ, err := lookupString(value, "$type")
+	if err != nil {
+		return invalid("/$type", "$type must be a string")
+	}
+	if typ != collection {
+		return invalid("/$type", "$type %s does not match the collection %s", typ, collection)
+	}
+
+	return v.validateObject(record.Record, value, "")
+}
+
+// ValidateRecordJSON validates the record JSON against the record schema of the collection
+// The JSON is interpreted in the atproto data model; `{"$link": ...}` is a CID link,
+// and `{"$bytes": ...}` is bytes.
+func (v *Validator) ValidateRecordJSON(collection string, b []byte) error {
+	value, err := data.DecodeJSON(b)
+	if err != nil {
+		return err
+	}
+	return v.ValidateRecord(collection, value)
+}
+
+// ValidateRecordKey validates the record key against the record key type of the collection
+func (v *Validator) ValidateRecordKey(collection string, rk string) error {
+	record, err := v.recordDef(collection)
+	if err != nil {
+		return err
+	}
+
+	if _, err := rkey.ParseRKey(record.Key, rk); err != nil {
+		return fmt.Errorf("invalid record key for %s; %w", collection, err)
+	}
+	return nil
+}
+
+// Validate validates the data against the definition referenced by the NSID
+// If the definition is a record, the data is validated against the record object.
+func (v *Validator) Validate(ref *nsid.NSID, value datamodel.Node) error {
+	def, err := v.Catalog.Resolve(ref)
+	if err != nil {
+		return err
+	}
+	if record, ok := def.(*Record); ok {
+		def = record.Record
+	}
+	return v.validate(def, value, "")
+}
+
+// validate validates the value against the definition at the path
+func (v *Validator) validate(def Def, value datamodel.Node, p string) error {
+	if value.Kind() == datamodel.Kind_Float {
+		return invalid(p, "floats are not allowed")
+	}
+
+	switch d := def.(type) {
+	case *Null:
+		if !value.IsNull() {
+			return invalid(p, "expected null")
+		}
+	case *Boolean:
+		b, err := value.AsBool()
+		if err != nil {
+			return invalid(p, "expected boolean")
+		}
+		if d.Const != nil && b != *d.Const {
+			return invalid(p, "must be %v", *d.Const)
+		}
+	case *Integer:
+		return validateInteger(d, value, p)
+	case *String:
+		return validateString(d, value, p)
+	case *Bytes:
+		b, err := value.AsBytes()
+		if err != nil {
+			return invalid(p, "expected bytes")
+		}
+		if d.MinLength != nil && len(b) < *d.MinLength {
+			return invalid(p, "must be at least %d bytes", *d.MinLength)
+		}
+		if d.MaxLength != nil && len(b) > *d.MaxLength {
+			return invalid(p, "must be at most %d bytes", *d.MaxLength)
+		}
+	case *CIDLink:
+		if _, err := value.AsLink(); err != nil {
+			return invalid(p, "expected cid-link")
+		}
+	case *Blob:
+		return validateBlob(d, value, p)
+	case *Array:
+		if value.Kind() != datamodel.Kind_List {
+			return invalid(p, "expected array")
+		}
+		n := int(value.Length())
+		if d.MinLength != nil && n < *d.MinLength {
+			return invalid(p, "must have at least %d items", *d.MinLength)
+		}
+		if d.MaxLength != nil && n > *d.MaxLength {
+			return invalid(p, "must have at most %d items", *d.MaxLength)
+		}
+
+		it := value.ListIterator()
+		for !it.Done() {
+			i, item, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if err := v.validate(d.Items, item, p+"/"+strconv.FormatInt(i, 10)); err != nil {
+				return err
+			}
+		}
+	case *Object:
+		return v.validateObject(d, value, p)
+	case *Params:
+		return v.validateObject(&Object{Required: d.Required, Properties: d.Properties}, value, p)
+	case *Ref:
+		target, err := v.Catalog.Resolve(d.Ref)
+		if err != nil {
+			return err
+		}
+		if _, ok := target.(*Token); ok {
+			s, err := value.AsString()
+			if err != nil || s != d.Ref.String() {
+				return invalid(p, "must be the token %s", d.Ref)
+			}
+			return nil
+		}
+		if record, ok := target.(*Record); ok {
+			target = record.Record
+		}
+		return v.validate(target, value, p)
+	case *Union:
+		return v.validateUnion(d, value, p)
+	case *Unknown:
+		if value.Kind() != datamodel.Kind_Map {
+			return invalid(p, "expected object")
+		}
+	case *Token:
+		return invalid(p, "token cannot be used as a value type")
+	default:
+		return fmt.Errorf("%s: %s type cannot be validated as data", p, def.Type())
+	}
+	return nil
+}
+
+func validateInteger(d *Integer, value datamodel.Node, p string) error {
+	n, err := value.AsInt()
+	if err != nil {
+		return invalid(p, "expected integer")
+	}
+	if d.Const != nil && n != *d.Const {
+		return invalid(p, "must be %d", *d.Const)
+	}
+	if d.Minimum != nil && n < *d.Minimum {
+		return invalid(p, "must be at least %d", *d.Minimum)
+	}
+	if d.Maximum != nil && n > *d.Maximum {
+		return invalid(p, "must be at most %d", *d.Maximum)
+	}
+	if len(d.Enum) > 0 {
+		for _, e := range d.Enum {
+			if n == e {
+				return nil
+			}
+		}
+		return invalid(p, "must be one of %v", d.Enum)
+	}
+	return nil
+}
+
+func validateString(d *String, value datamodel.Node, p string) error {
+	s, err := value.AsString()
+	if err != nil {
+		return invalid(p, "expected string")
+	}
+	if !utf8.ValidString(s) {
+		return invalid(p, "must be valid UTF-8")
+	}
+
+	if d.Const != nil && s != *d.Const {
+		return invalid(p, "must be %q", *d.Const)
+	}
+	if len(d.Enum) > 0 {
+		found := false
+		for _, e := range d.Enum {
+			if s == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalid(p, "must be one of %v", d.Enum)
+		}
+	}
+
+	if d.MinLength != nil && len(s) < *d.MinLength {
+		return invalid(p, "must be at least %d bytes", *d.MinLength)
+	}
+	if d.MaxLength != nil && len(s) > *d.MaxLength {
+		return invalid(p, "must be at most %d bytes", *d.MaxLength)
+	}
+	if d.MinGraphemes != nil || d.MaxGraphemes != nil {
+		n := uniseg.GraphemeClusterCount(s)
+		if d.MinGraphemes != nil && n < *d.MinGraphemes {
+			return invalid(p, "must be at least %d graphemes", *d.MinGraphemes)
+		}
+		if d.MaxGraphemes != nil && n > *d.MaxGraphemes {
+			return invalid(p, "must be at most %d graphemes", *d.MaxGraphemes)
+		}
+	}
+
+	if d.Format != "" {
+		if err := format.Validate(d.Format, s); err != nil {
+			return invalid(p, "%v", err)
+		}
+	}
+	return nil
+}
+
+// validateBlob validates the blob reference
+// The legacy format `{"cid": ..., "mimeType": ...}` is also accepted, without the size constraint.
+func validateBlob(d *Blob, value datamodel.Node, p string) error {
+	if value.Kind() != datamodel.Kind_Map {
+		return invalid(p, "expected blob")
+	}
+
+	mimeType, err := lookupString(value, "mimeType")
+	if err != nil {
+		return invalid(p+"/mimeType", "mimeType must be a string")
+	}
+
+	if typ, err := lookupString(value, "$type"); err == nil {
+		if typ != TYPE_BLOB {
+			return invalid(p+"/$type", "$type must be blob")
+		}
+
+		ref, err := value.LookupByString("ref")
+		if err != nil {
+			return invalid(p+"/ref", "ref is missing")
+		}
+		if _, err := ref.AsLink(); err != nil {
+			return invalid(p+"/ref", "ref must be a cid-link")
+		}
+
+		sizeNode, err := value.LookupByString("size")
+		if err != nil {
+			return invalid(p+"/size", "size is missing")
+		}
+		size, err := sizeNode.AsInt()
+		if err != nil || size < 0 {
+			return invalid(p+"/size", "size must be a non-negative integer")
+		}
+		if d.MaxSize != nil && size > *d.MaxSize {
+			return invalid(p, "must be at most %d bytes", *d.MaxSize)
+		}
+	} else {
+		c, err := lookupString(value, "cid")
+		if err != nil {
+			return invalid(p, "expected blob")
+		}
+		if _, err := cid.Decode(c); err != nil {
+			return invalid(p+"/cid", "invalid cid: %s", c)
+		}
+	}
+
+	if len(d.Accept) > 0 {
+		accepted := false
+		for _, pattern := range d.Accept {
+			if ok, _ := path.Match(pattern, mimeType); ok || pattern == "*/*" {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return invalid(p+"/mimeType", "%s is not accepted; must be one of %v", mimeType, d.Accept)
+		}
+	}
+	return nil
+}
+
+// validateObject validates the object; the properties not in the schema are allowed
+func (v *Validator) validateObject(d *Object, value datamodel.Node, p string) error {
+	if value.Kind() != datamodel.Kind_Map {
+		return invalid(p, "expected object")
+	}
+
+	nullable := make(map[string]bool, len(d.Nullable))
+	for _, name := range d.Nullable {
+		nullable[name] = true
+	}
+
+	for _, name := range d.Required {
+		n, err := value.LookupByString(name)
+		if err != nil || (n.IsNull() && !nullable[name]) {
+			return invalid(p+"/"+name, "required property is missing")
+		}
+	}
+
+	for _, name := range sortedKeys(d.Properties) {
+		n, err := value.LookupByString(name)
+		if err != nil {
+			continue
+		}
+		if n.IsNull() {
+			if nullable[name] {
+				continue
+			}
+			return invalid(p+"/"+name, "must not be null")
+		}
+
+		if err := v.validate(d.Properties[name], n, p+"/"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateUnion validates the value against the union by its $type
+// An open union accepts the values of unknown types without validation.
+func (v *Validator) validateUnion(d *Union, value datamodel.Node, p string) error {
+	if value.Kind() != datamodel.Kind_Map {
+		return invalid(p, "expected object with $type")
+	}
+	typ, err := lookupString(value, "$type")
+	if err != nil {
+		return invalid(p+"/$type", "$type is missing")
+	}
+
+	id, err := nsid.NewNSID(strings.TrimSuffix(typ, "#"+MAIN))
+	if err != nil {
+		return invalid(p+"/$type", "invalid $type: %s", typ)
+	}
+
+	for _, ref := range d.Refs {
+		if !ref.Equal(id) {
+			continue
+		}
+
+		def, err := v.Catalog.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		if record, ok := def.(*Record); ok {
+			def = record.Record
+		}
+		return v.validate(def, value, p)
+	}
+
+	if d.Closed {
+		return invalid(p+"/$type", "%s is not one of the closed union", typ)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]Def) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func lookupString(n datamodel.Node, key string) (string, error) {
+	v, err := n.LookupByString(key)
+	if err != nil {
+		return "", err
+	}
+	return v.AsString()
+}
@@ -0,0 +1,350 @@
+package lexicon_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+)
+
+const testRecord = `{
+	"lexicon": 1,
+	"id": "com.example.record",
+	"defs": {
+		"main": {
+			"type": "record",
+			"key": "literal:self",
+			"record": {
+				"type": "object",
+				"required": ["name"],
+				"nullable": ["note"],
+				"properties": {
+					"name": {"type": "string", "minLength": 1, "maxGraphemes": 5},
+					"note": {"type": "string"},
+					"kind": {"type": "string", "knownValues": ["a", "b"]},
+					"mode": {"type": "string", "enum": ["on", "off"]},
+					"count": {"type": "integer", "minimum": 0, "maximum": 10},
+					"level": {"type": "integer", "enum": [1, 2, 3]},
+					"flag": {"type": "boolean", "const": true},
+					"data": {"type": "bytes", "maxLength": 4},
+					"link": {"type": "cid-link"},
+					"avatar": {"type": "blob", "accept": ["image/png", "image/jpeg"], "maxSize": 1000},
+					"banner": {"type": "blob", "accept": ["image/*"]},
+					"tags": {"type": "array", "maxLength": 2, "items": {"type": "string", "maxLength": 4}},
+					"item": {"type": "ref", "ref": "#item"},
+					"open": {"type": "union", "refs": ["#item", "com.example.other"]},
+					"closed": {"type": "union", "refs": ["#item"], "closed": true},
+					"extra": {"type": "unknown"},
+					"status": {"type": "ref", "ref": "#active"},
+					"createdAt": {"type": "string", "format": "datetime"},
+					"did": {"type": "string", "format": "did"},
+					"handle": {"type": "string", "format": "handle"},
+					"actor": {"type": "string", "format": "at-identifier"},
+					"uri": {"type": "string", "format": "at-uri"},
+					"web": {"type": "string", "format": "uri"},
+					"cid": {"type": "string", "format": "cid"},
+					"nsid": {"type": "string", "format": "nsid"},
+					"tid": {"type": "string", "format": "tid"},
+					"rkey": {"type": "string", "format": "record-key"},
+					"lang": {"type": "string", "format": "language"}
+				}
+			}
+		},
+		"item": {
+			"type": "object",
+			"required": ["value"],
+			"properties": {"value": {"type": "integer"}, "child": {"type": "ref", "ref": "#item"}}
+		},
+		"active": {"type": "token"}
+	}
+}`
+
+const testOther = `{
+	"lexicon": 1,
+	"id": "com.example.other",
+	"defs": {
+		"main": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string"}}}
+	}
+}`
+
+func testValidator(t *testing.T) *lexicon.Validator {
+	t.Helper()
+
+	catalog := lexicon.NewCatalog()
+	for _, doc := range []string{testRecord, testOther} {
+		if _, err := catalog.AddJSON([]byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := catalog.Check(); err != nil {
+		t.Fatal(err)
+	}
+	return lexicon.NewValidator(catalog)
+}
+
+func TestValidator_ValidateRecordJSON(t *testing.T) {
+	v := testValidator(t)
+
+	tests := []struct {
+		name     string
+		json     string
+		wantPath string // empty if valid
+	}{
+		{
+			name: "successfull case: minimal",
+			json: `{"$type": "com.example.record", "name": "a"}`,
+		},
+		{
+			name: "successfull case: all fields",
+			json: `{
+				"$type": "com.example.record",
+				"name": "👩‍👩‍👧‍👦abcd",
+				"note": null,
+				"kind": "unknown-value",
+				"mode": "on",
+				"count": 10,
+				"level": 2,
+				"flag": true,
+				"data": {"$bytes": "AQID"},
+				"link": {"$link": "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"},
+				"avatar": {"$type": "blob", "ref": {"$link": "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}, "mimeType": "image/png", "size": 1000},
+				"banner": {"cid": "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm", "mimeType": "image/webp"},
+				"tags": ["a", "bcde"],
+				"item": {"value": 1, "child": {"value": 2}},
+				"open": {"$type": "com.example.unknown", "anything": 1},
+				"closed": {"$type": "com.example.record#item", "value": 3},
+				"extra": {"anything": [1, "a"]},
+				"status": "com.example.record#active",
+				"createdAt": "2024-01-02T03:04:05.678Z",
+				"did": "did:plc:ewvi7nxzyoun6zhxrhs64oiz",
+				"handle": "alice.bsky.social",
+				"actor": "did:web:example.com",
+				"uri": "at://did:plc:ewvi7nxzyoun6zhxrhs64oiz/app.bsky.feed.post/3jzfcijpj2z2a",
+				"web": "https://example.com/path?q=1",
+				"cid": "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm",
+				"nsid": "app.bsky.feed.post",
+				"tid": "3jzfcijpj2z2a",
+				"rkey": "self",
+				"lang": "ja-JP",
+				"unspecified": "properties not in the schema are allowed"
+			}`,
+		},
+		{
+			name:     "failure case: not an object",
+			json:     `[]`,
+			wantPath: "/",
+		},
+		{
+			name:     "failure case: $type mismatch",
+			json:     `{"$type": "com.example.other", "name": "a"}`,
+			wantPath: "/$type",
+		},
+		{
+			name:     "failure case: missing required",
+			json:     `{"$type": "com.example.record"}`,
+			wantPath: "/name",
+		},
+		{
+			name:     "failure case: null of non-nullable",
+			json:     `{"$type": "com.example.record", "name": "a", "count": null}`,
+			wantPath: "/count",
+		},
+		{
+			name:     "failure case: minLength",
+			json:     `{"$type": "com.example.record", "name": ""}`,
+			wantPath: "/name",
+		},
+		{
+			name:     "failure case: maxGraphemes",
+			json:     `{"$type": "com.example.record", "name": "abcdef"}`,
+			wantPath: "/name",
+		},
+		{
+			name:     "failure case: enum",
+			json:     `{"$type": "com.example.record", "name": "a", "mode": "auto"}`,
+			wantPath: "/mode",
+		},
+		{
+			name:     "failure case: integer maximum",
+			json:     `{"$type": "com.example.record", "name": "a", "count": 11}`,
+			wantPath: "/count",
+		},
+		{
+			name:     "failure case: integer enum",
+			json:     `{"$type": "com.example.record", "name": "a", "level": 4}`,
+			wantPath: "/level",
+		},
+		{
+			name:     "failure case: const",
+			json:     `{"$type": "com.example.record", "name": "a", "flag": false}`,
+			wantPath: "/flag",
+		},
+		{
+			name:     "failure case: bytes maxLength",
+			json:     `{"$type": "com.example.record", "name": "a", "data": {"$bytes": "AQIDBAU"}}`,
+			wantPath: "/data",
+		},
+		{
+			name:     "failure case: not a link",
+			json:     `{"$type": "com.example.record", "name": "a", "link": "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}`,
+			wantPath: "/link",
+		},
+		{
+			name:     "failure case: blob mimeType",
+			json:     `{"$type": "com.example.record", "name": "a", "avatar": {"$type": "blob", "ref": {"$link": "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}, "mimeType": "image/gif", "size": 10}}`,
+			wantPath: "/avatar/mimeType",
+		},
+		{
+			name:     "failure case: blob maxSize",
+			json:     `{"$type": "com.example.record", "name": "a", "avatar": {"$type": "blob", "ref": {"$link": "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}, "mimeType": "image/png", "size": 1001}}`,
+			wantPath: "/avatar",
+		},
+		{
+			name:     "failure case: array item",
+			json:     `{"$type": "com.example.record", "name": "a", "tags": ["a", "bcdef"]}`,
+			wantPath: "/tags/1",
+		},
+		{
+			name:     "failure case: array maxLength",
+			json:     `{"$type": "com.example.record", "name": "a", "tags": ["a", "b", "c"]}`,
+			wantPath: "/tags",
+		},
+		{
+			name:     "failure case: nested ref",
+			json:     `{"$type": "com.example.record", "name": "a", "item": {"value": 1, "child": {"value": "2"}}}`,
+			wantPath: "/item/child/value",
+		},
+		{
+			name:     "failure case: union member",
+			json:     `{"$type": "com.example.record", "name": "a", "open": {"$type": "com.example.other"}}`,
+			wantPath: "/open/text",
+		},
+		{
+			name:     "failure case: union without $type",
+			json:     `{"$type": "com.example.record", "name": "a", "open": {"text": "a"}}`,
+			wantPath: "/open/$type",
+		},
+		{
+			name:     "failure case: closed union",
+			json:     `{"$type": "com.example.record", "name": "a", "closed": {"$type": "com.example.other", "text": "a"}}`,
+			wantPath: "/closed/$type",
+		},
+		{
+			name:     "failure case: unknown must be an object",
+			json:     `{"$type": "com.example.record", "name": "a", "extra": "a"}`,
+			wantPath: "/extra",
+		},
+		{
+			name:     "failure case: token",
+			json:     `{"$type": "com.example.record", "name": "a", "status": "com.example.record#inactive"}`,
+			wantPath: "/status",
+		},
+		{
+			name:     "failure case: datetime without timezone",
+			json:     `{"$type": "com.example.record", "name": "a", "createdAt": "2024-01-02T03:04:05"}`,
+			wantPath: "/createdAt",
+		},
+		{
+			name:     "failure case: did",
+			json:     `{"$type": "com.example.record", "name": "a", "did": "did:PLC:xyz"}`,
+			wantPath: "/did",
+		},
+		{
+			name:     "failure case: handle",
+			json:     `{"$type": "com.example.record", "name": "a", "handle": "alice"}`,
+			wantPath: "/handle",
+		},
+		{
+			name:     "failure case: at-uri",
+			json:     `{"$type": "com.example.record", "name": "a", "uri": "https://example.com"}`,
+			wantPath: "/uri",
+		},
+		{
+			name:     "failure case: uri",
+			json:     `{"$type": "com.example.record", "name": "a", "web": "example.com"}`,
+			wantPath: "/web",
+		},
+		{
+			name:     "failure case: cid",
+			json:     `{"$type": "com.example.record", "name": "a", "cid": "abc"}`,
+			wantPath: "/cid",
+		},
+		{
+			name:     "failure case: tid",
+			json:     `{"$type": "com.example.record", "name": "a", "tid": "self"}`,
+			wantPath: "/tid",
+		},
+		{
+			name:     "failure case: language",
+			json:     `{"$type": "com.example.record", "name": "a", "lang": "japanese"}`,
+			wantPath: "/lang",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.ValidateRecordJSON("com.example.record", []byte(tt.json))
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Errorf("ValidateRecordJSON() error = %v", err)
+				}
+				return
+			}
+
+			var verr *lexicon.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("ValidateRecordJSON() error = %v, want ValidationError", err)
+			}
+			path := verr.Path
+			if path == "" {
+				path = "/"
+			}
+			if path != tt.wantPath {
+				t.Errorf("ValidateRecordJSON() error = %v, want path %v", err, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateRecordJSON_Failure(t *testing.T) {
+	v := testValidator(t)
+
+	tests := []struct {
+		name       string
+		collection string
+		json       string
+	}{
+		{
+			name:       "failure case: unknown collection",
+			collection: "com.example.unknown",
+			json:       `{"$type": "com.example.unknown"}`,
+		},
+		{
+			name:       "failure case: not a record type",
+			collection: "com.example.other",
+			json:       `{"$type": "com.example.other", "text": "a"}`,
+		},
+		{
+			name:       "failure case: float",
+			collection: "com.example.record",
+			json:       `{"$type": "com.example.record", "name": "a", "count": 1.5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.ValidateRecordJSON(tt.collection, []byte(tt.json)); err == nil {
+				t.Errorf("ValidateRecordJSON() error = nil, wantErr true")
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateRecordKey(t *testing.T) {
+	v := testValidator(t)
+
+	if err := v.ValidateRecordKey("com.example.record", "self"); err != nil {
+		t.Errorf("ValidateRecordKey() error = %v", err)
+	}
+	if err := v.ValidateRecordKey("com.example.record", "other"); err == nil {
+		t.Errorf("ValidateRecordKey() error = nil, wantErr true")
+	}
+}
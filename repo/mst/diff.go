@@ -0,0 +1,218 @@
+package mst
+
+import (
+	cid "github.com/ipfs/go-cid"
+)
+
+type DiffAction int
+
+const (
+	// diff actions
+	DIFF_CREATE DiffAction = iota
+	DIFF_UPDATE
+	DIFF_DELETE
+)
+
+func (a DiffAction) String() string {
+	switch a {
+	case DIFF_CREATE:
+		return "create"
+	case DIFF_UPDATE:
+		return "update"
+	case DIFF_DELETE:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// DiffOp is a change of a key between two trees
+type DiffOp struct {
+	Action DiffAction
+	Key    string
+	Old    cid.Cid // undefined on create
+	New    cid.Cid // undefined on delete
+}
+
+// TreeDiff is the difference between two trees
+type TreeDiff struct {
+	// Ops are the changes ordered by key
+	Ops []DiffOp
+
+	// NewBlocks are the CIDs of the MST nodes which are only in the new tree,
+	// and the CIDs of the records which are created or updated
+	NewBlocks []cid.Cid
+
+	// RemovedNodes are the CIDs of the MST nodes which are only in the old tree
+	RemovedNodes []cid.Cid
+}
+
+// diffWalker walks the entries of a tree in key order
+// subtrees are expanded only when requested.
+type diffWalker struct {
+	stack    []entry // the top of the stack is the next entry
+	expanded []cid.Cid
+}
+
+func newDiffWalker(root *node) *diffWalker {
+	return &diffWalker{stack: []entry{{tree: root}}}
+}
+
+func (w *diffWalker) peek() *entry {
+	if len(w.stack) == 0 {
+		return nil
+	}
+	return &w.stack[len(w.stack)-1]
+}
+
+func (w *diffWalker) pop() {
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+// expand replaces the subtree on the top of the stack with its entries
+func (w *diffWalker) expand() error {
+	n := w.peek().tree
+	w.pop()
+
+	if err := n.load(); err != nil {
+		return err
+	}
+	w.expanded = append(w.expanded, n.pointer)
+
+	for i := len(n.entries) - 1; i >= 0; i-- {
+		w.stack = append(w.stack, n.entries[i])
+	}
+	return nil
+}
+
+// Diff returns the difference from the tree to the other tree
+// Only the subtrees which differ between the trees are walked;
+// subtrees with the same CID in the same position are skipped.
+// If from is nil, it is treated as an empty tree, and all the nodes of to are new.
+// The modified nodes of both trees are written into their stores to compute their CIDs,
+// as Root does.
+func Diff(from *Tree, to *Tree) (*TreeDiff, error) {
+	// compute the CIDs of the modified nodes
+	if _, err := to.Root(); err != nil {
+		return nil, err
+	}
+	ow := &diffWalker{} // an empty tree has no entries
+	if from != nil {
+		if _, err := from.Root(); err != nil {
+			return nil, err
+		}
+		ow = newDiffWalker(from.root)
+	}
+
+	diff := &TreeDiff{}
+	nw := newDiffWalker(to.root)
+
+	for {
+		o, n := ow.peek(), nw.peek()
+		if o == nil && n == nil {
+			break
+		}
+
+		oTree := o != nil && !o.isLeaf()
+		nTree := n != nil && !n.isLeaf()
+
+		if oTree && nTree {
+			if o.tree.pointer.Equals(n.tree.pointer) {
+				ow.pop()
+				nw.pop()
+				continue
+			}
+
+			oLayer, err := o.tree.getLayer()
+			if err != nil {
+				return nil, err
+			}
+			nLayer, err := n.tree.getLayer()
+			if err != nil {
+				return nil, err
+			}
+
+			if oLayer >= nLayer {
+				if err := ow.expand(); err != nil {
+					return nil, err
+				}
+			}
+			if nLayer >= oLayer {
+				if err := nw.expand(); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if oTree {
+			if err := ow.expand(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if nTree {
+			if err := nw.expand(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// both are leaves, or one of the walkers is done
+		switch {
+		case n == nil || (o != nil && o.key < n.key):
+			diff.Ops = append(diff.Ops, DiffOp{Action: DIFF_DELETE, Key: o.key, Old: o.val})
+			ow.pop()
+		case o == nil || n.key < o.key:
+			diff.Ops = append(diff.Ops, DiffOp{Action: DIFF_CREATE, Key: n.key, New: n.val})
+			diff.NewBlocks = append(diff.NewBlocks, n.val)
+			nw.pop()
+		default:
+			if !o.val.Equals(n.val) {
+				diff.Ops = append(diff.Ops, DiffOp{Action: DIFF_UPDATE, Key: n.key, Old: o.val, New: n.val})
+				diff.NewBlocks = append(diff.NewBlocks, n.val)
+			}
+			ow.pop()
+			nw.pop()
+		}
+	}
+
+	// a node may be expanded in both trees when it is not aligned
+	oldNodes := make(map[cid.Cid]bool, len(ow.expanded))
+	for _, c := range ow.expanded {
+		oldNodes[c] = true
+	}
+	newNodes := make(map[cid.Cid]bool, len(nw.expanded))
+	for _, c := range nw.expanded {
+		newNodes[c] = true
+		if !oldNodes[c] {
+			diff.NewBlocks = append(diff.NewBlocks, c)
+		}
+	}
+	for _, c := range ow.expanded {
+		if !newNodes[c] {
+			diff.RemovedNodes = append(diff.RemovedNodes, c)
+		}
+	}
+
+	return diff, nil
+}
+
+// DiffRoots returns the difference between the trees with the root CIDs in the store
+// If from is undefined, it is treated as an empty tree.
+func DiffRoots(store Store, from cid.Cid, to cid.Cid) (*TreeDiff, error) {
+	var fromTree *Tree
+	if from.Defined() {
+		loaded, err := LoadTree(store, from)
+		if err != nil {
+			return nil, err
+		}
+		fromTree = loaded
+	}
+
+	toTree, err := LoadTree(store, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(fromTree, toTree)
+}
@@ -0,0 +1,241 @@
+package mst_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/mst"
+)
+
+type countingStore struct {
+	mstStore
+	gets int
+}
+
+func (s *countingStore) Get(c cid.Cid) ([]byte, error) {
+	s.gets++
+	return s.mstStore.Get(c)
+}
+
+// nodesOf returns the CIDs of all MST nodes of the tree
+func nodesOf(t *testing.T, tree *mst.Tree) map[cid.Cid]bool {
+	t.Helper()
+
+	diff, err := mst.Diff(nil, tree)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	values := make(map[cid.Cid]bool)
+	for _, op := range diff.Ops {
+		values[op.New] = true
+	}
+
+	nodes := make(map[cid.Cid]bool)
+	for _, c := range diff.NewBlocks {
+		if !values[c] {
+			nodes[c] = true
+		}
+	}
+	return nodes
+}
+
+func TestDiff(t *testing.T) {
+	keys := testKeys(400)
+	r := rand.New(rand.NewSource(3))
+
+	store := mstStore{}
+	from := mst.NewTree(store)
+	to := mst.NewTree(store)
+	want := map[string]mst.DiffAction{}
+
+	for i, key := range keys {
+		switch i % 4 {
+		case 0: // unchanged
+			_ = from.Insert(key, testValues(key))
+			_ = to.Insert(key, testValues(key))
+		case 1: // deleted
+			_ = from.Insert(key, testValues(key))
+			want[key] = mst.DIFF_DELETE
+		case 2: // created
+			_ = to.Insert(key, testValues(key))
+			want[key] = mst.DIFF_CREATE
+		case 3: // updated
+			_ = from.Insert(key, testValues(key))
+			_ = to.Insert(key, testValues(fmt.Sprint(r.Int())))
+			want[key] = mst.DIFF_UPDATE
+		}
+	}
+
+	diff, err := mst.Diff(from, to)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	got := map[string]mst.DiffAction{}
+	var gotKeys []string
+	for _, op := range diff.Ops {
+		got[op.Key] = op.Action
+		gotKeys = append(gotKeys, op.Key)
+
+		switch op.Action {
+		case mst.DIFF_CREATE:
+			if op.Old.Defined() || !op.New.Defined() {
+				t.Errorf("Diff() create op = %v", op)
+			}
+		case mst.DIFF_DELETE:
+			if !op.Old.Defined() || op.New.Defined() {
+				t.Errorf("Diff() delete op = %v", op)
+			}
+		case mst.DIFF_UPDATE:
+			if op.Old.Equals(op.New) {
+				t.Errorf("Diff() update op = %v", op)
+			}
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+	if !sort.StringsAreSorted(gotKeys) {
+		t.Errorf("Diff() ops are not ordered by key")
+	}
+
+	// the new blocks must be exactly the nodes only in the new tree and the new values
+	fromNodes, toNodes := nodesOf(t, from), nodesOf(t, to)
+	wantBlocks := map[cid.Cid]bool{}
+	for c := range toNodes {
+		if !fromNodes[c] {
+			wantBlocks[c] = true
+		}
+	}
+	for _, op := range diff.Ops {
+		if op.Action != mst.DIFF_DELETE {
+			wantBlocks[op.New] = true
+		}
+	}
+	gotBlocks := map[cid.Cid]bool{}
+	for _, c := range diff.NewBlocks {
+		gotBlocks[c] = true
+	}
+	if fmt.Sprint(gotBlocks) != fmt.Sprint(wantBlocks) {
+		t.Errorf("Diff() new blocks = %v, want %v", gotBlocks, wantBlocks)
+	}
+
+	for _, c := range diff.RemovedNodes {
+		if !fromNodes[c] || toNodes[c] {
+			t.Errorf("Diff() removed node %v is not only in the old tree", c)
+		}
+	}
+}
+
+func TestDiff_Same(t *testing.T) {
+	tree := mst.NewTree(nil)
+	for _, key := range testKeys(50) {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff, err := mst.Diff(tree, tree)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(diff.Ops) != 0 || len(diff.NewBlocks) != 0 || len(diff.RemovedNodes) != 0 {
+		t.Errorf("Diff() = %+v, want empty", diff)
+	}
+}
+
+func TestDiff_WritesModifiedNodes(t *testing.T) {
+	store := mstStore{}
+	tree := mst.NewTree(store)
+	for _, key := range testKeys(50) {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(store) != 0 {
+		t.Fatalf("Insert() wrote %d blocks, want 0", len(store))
+	}
+
+	if _, err := mst.Diff(nil, tree); err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	written := len(store)
+
+	// the nodes are already written, so Root writes nothing more
+	root, err := tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	if _, ok := store[root]; !ok || len(store) != written {
+		t.Errorf("Diff() wrote %d blocks, want all %d nodes including the root", written, len(store))
+	}
+}
+
+func TestDiff_NilFrom(t *testing.T) {
+	store := mstStore{}
+	tree := mst.NewTree(store)
+	for _, key := range testKeys(50) {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tree.Root(); err != nil {
+		t.Fatal(err)
+	}
+	written := len(store)
+
+	diff, err := mst.Diff(nil, tree)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(diff.Ops) != 50 || len(diff.RemovedNodes) != 0 {
+		t.Errorf("Diff() = %d ops, removed %v, want 50 ops and no removed nodes", len(diff.Ops), diff.RemovedNodes)
+	}
+	if len(store) != written {
+		t.Errorf("Diff() wrote %d blocks into the store of to, want 0", len(store)-written)
+	}
+}
+
+func TestDiffRoots_WalksOnlyDifferingSubtrees(t *testing.T) {
+	keys := testKeys(2000)
+
+	store := &countingStore{mstStore: mstStore{}}
+	tree := mst.NewTree(store)
+	for _, key := range keys {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	from, err := tree.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added := "com.example.record/added"
+	if err := tree.Insert(added, testValues(added)); err != nil {
+		t.Fatal(err)
+	}
+	to, err := tree.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.gets = 0
+	diff, err := mst.DiffRoots(store, from, to)
+	if err != nil {
+		t.Fatalf("DiffRoots() error = %v", err)
+	}
+
+	if len(diff.Ops) != 1 || diff.Ops[0].Action != mst.DIFF_CREATE || diff.Ops[0].Key != added {
+		t.Errorf("DiffRoots() = %v, want a create of %v", diff.Ops, added)
+	}
+
+	// the tree has hundreds of nodes, but only the paths to the added key differ
+	if store.gets > 20 {
+		t.Errorf("DiffRoots() loaded %d nodes, want only the differing paths", store.gets)
+	}
+}
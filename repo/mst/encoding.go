@@ -0,0 +1,150 @@
+package mst
+
+import (
+	"bytes"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+var NodeSchema schema.Type
+
+func init() {
+	schema, err := ipld.LoadSchemaBytes([]byte(`
+		type Node struct {
+			l nullable Link
+			e [Entry]
+		} representation map
+
+		type Entry struct {
+			p Int
+			k Bytes
+			v Link
+			t nullable Link
+		} representation map
+	`))
+	if err != nil {
+		panic(err)
+	}
+
+	NodeSchema = schema.TypeByName("Node")
+}
+
+// NodeData is the DAG-CBOR representation of a MST node
+type NodeData struct {
+	L *cid.Cid    // left-most subtree
+	E []EntryData // entries
+}
+
+// EntryData is the DAG-CBOR representation of a MST entry
+type EntryData struct {
+	P int64    // prefix length shared with the previous key in the node
+	K []byte   // remainder of the key
+	V cid.Cid  // value
+	T *cid.Cid // subtree on the right of the entry
+}
+
+// EncodeNodeData encodes NodeData into DAG-CBOR bytes
+func EncodeNodeData(data *NodeData) ([]byte, error) {
+	if data.E == nil {
+		data.E = []EntryData{}
+	}
+
+	buf := new(bytes.Buffer)
+	node := bindnode.Wrap(data, NodeSchema).Representation()
+	if err := dagcbor.Encode(node, buf); err != nil {
+		return nil, fmt.Errorf("failed to encode MST node; %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeNodeData decodes DAG-CBOR bytes into NodeData
+func DecodeNodeData(b []byte) (*NodeData, error) {
+	builder := bindnode.Prototype((*NodeData)(nil), NodeSchema).Representation().NewBuilder()
+	if err := dagcbor.Decode(builder, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("failed to decode MST node; %w", err)
+	}
+
+	data := bindnode.Unwrap(builder.Build()).(*NodeData)
+	return data, nil
+}
+
+// encode serializes the node into NodeData with prefix compression of keys
+// subtrees must have been encoded before calling this.
+func (n *node) encode() *NodeData {
+	data := &NodeData{
+		E: make([]EntryData, 0, len(n.entries)),
+	}
+
+	var prev string
+	for i, e := range n.entries {
+		if !e.isLeaf() {
+			if i == 0 {
+				c := e.tree.pointer
+				data.L = &c
+			}
+			continue
+		}
+
+		p := commonPrefixLen(prev, e.key)
+		ed := EntryData{
+			P: int64(p),
+			K: []byte(e.key[p:]),
+			V: e.val,
+		}
+		if i+1 < len(n.entries) && !n.entries[i+1].isLeaf() {
+			c := n.entries[i+1].tree.pointer
+			ed.T = &c
+		}
+
+		data.E = append(data.E, ed)
+		prev = e.key
+	}
+
+	return data
+}
+
+// decodeEntries deserializes NodeData into the entries of a node
+// the subtrees are not loaded until they are needed.
+func decodeEntries(store Store, data *NodeData) ([]entry, error) {
+	entries := make([]entry, 0, len(data.E)*2+1)
+
+	if data.L != nil {
+		entries = append(entries, entry{tree: unloadedNode(store, *data.L)})
+	}
+
+	var prev string
+	for _, ed := range data.E {
+		if ed.P < 0 || int(ed.P) > len(prev) {
+			return nil, fmt.Errorf("invalid MST node; invalid prefix length: %d", ed.P)
+		}
+
+		key := prev[:ed.P] + string(ed.K)
+		if err := ValidateKey(key); err != nil {
+			return nil, fmt.Errorf("invalid MST node; %w", err)
+		}
+		if prev != "" && key <= prev {
+			return nil, fmt.Errorf("invalid MST node; keys are not sorted: %s", key)
+		}
+
+		entries = append(entries, entry{key: key, val: ed.V})
+		if ed.T != nil {
+			entries = append(entries, entry{tree: unloadedNode(store, *ed.T)})
+		}
+		prev = key
+	}
+
+	return entries, nil
+}
+
+func commonPrefixLen(a string, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,682 @@
+// the package mst implements the Merkle Search Tree (MST) of atproto repositories
+//
+// The keys of the tree are the repository paths in `<collection>/<rkey>` format,
+// and the values are the CIDs of the records.
+// Trees are persistent; every mutation returns without modifying the nodes
+// shared with the previous version of the tree.
+
+package mst
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+	"go.yumnet.cloud/orangesea/repo/rkey"
+)
+
+const (
+	MAX_KEY_LENGTH = 1024
+)
+
+var (
+	ErrNotFound = errors.New("key not found")
+	ErrExists   = errors.New("key already exists")
+
+	// ErrStopWalk can be returned by the walk function to stop walking without error
+	ErrStopWalk = errors.New("stop walk")
+)
+
+// Store is a content-addressed block storage for MST nodes
+type Store interface {
+	Get(c cid.Cid) ([]byte, error)
+	Put(c cid.Cid, data []byte) error
+}
+
+type memStore map[cid.Cid][]byte
+
+func (s memStore) Get(c cid.Cid) ([]byte, error) {
+	b, ok := s[c]
+	if !ok {
+		return nil, fmt.Errorf("block not found: %s", c)
+	}
+	return b, nil
+}
+
+func (s memStore) Put(c cid.Cid, data []byte) error {
+	s[c] = data
+	return nil
+}
+
+// KeyHeight returns the height (layer) of the key in the tree
+// The height is the number of leading zero bits of the SHA-256 hash of the key,
+// counted in 2-bit steps (i.e. the tree has fanout of 4).
+func KeyHeight(key string) int {
+	hash := sha256.Sum256([]byte(key))
+
+	zeros := 0
+	for _, b := range hash {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+
+	return zeros / 2
+}
+
+// ValidateKey validates the key is a repository path in `<collection>/<rkey>` format
+func ValidateKey(key string) error {
+	if len(key) > MAX_KEY_LENGTH {
+		return fmt.Errorf("invalid MST key: %s; too long", key)
+	}
+
+	collection, rk, ok := strings.Cut(key, "/")
+	if !ok || strings.Contains(rk, "/") {
+		return fmt.Errorf("invalid MST key: %s; must be <collection>/<rkey>", key)
+	}
+
+	n, err := nsid.NewNSID(collection)
+	if err != nil {
+		return fmt.Errorf("invalid MST key: %s; %w", key, err)
+	}
+	if n.Glob() || n.Fragment() != "" {
+		return fmt.Errorf("invalid MST key: %s; collection must not have glob or fragment", key)
+	}
+
+	if _, err := rkey.NewAny(rk); err != nil {
+		return fmt.Errorf("invalid MST key: %s; %w", key, err)
+	}
+
+	return nil
+}
+
+// entry is either a leaf (key and value) or a subtree
+type entry struct {
+	key  string
+	val  cid.Cid
+	tree *node
+}
+
+func (e entry) isLeaf() bool {
+	return e.tree == nil
+}
+
+type node struct {
+	store   Store
+	layer   int // -1 if not known yet
+	entries []entry
+	loaded  bool
+	pointer cid.Cid // undefined until the node is encoded
+}
+
+func newNode(store Store, layer int, entries []entry) *node {
+	return &node{
+		store:   store,
+		layer:   layer,
+		entries: entries,
+		loaded:  true,
+	}
+}
+
+func unloadedNode(store Store, pointer cid.Cid) *node {
+	return &node{
+		store:   store,
+		layer:   -1,
+		pointer: pointer,
+	}
+}
+
+// load reads the node from the store if it is not loaded yet
+func (n *node) load() error {
+	if n.loaded {
+		return nil
+	}
+
+	b, err := n.store.Get(n.pointer)
+	if err != nil {
+		return fmt.Errorf("failed to load MST node: %s; %w", n.pointer, err)
+	}
+
+	data, err := DecodeNodeData(b)
+	if err != nil {
+		return err
+	}
+
+	entries, err := decodeEntries(n.store, data)
+	if err != nil {
+		return err
+	}
+
+	n.entries = entries
+	n.loaded = true
+
+	return nil
+}
+
+// getLayer returns the layer of the node, loading the node and its subtrees if needed
+func (n *node) getLayer() (int, error) {
+	if n.layer >= 0 {
+		return n.layer, nil
+	}
+	if err := n.load(); err != nil {
+		return 0, err
+	}
+
+	layer := -1
+	for _, e := range n.entries {
+		if !e.isLeaf() {
+			continue
+		}
+		h := KeyHeight(e.key)
+		if layer >= 0 && h != layer {
+			return 0, fmt.Errorf("invalid MST node: %s; keys have different heights", n.pointer)
+		}
+		layer = h
+	}
+
+	if layer < 0 {
+		// the node has no leaves
+		if len(n.entries) == 0 {
+			layer = 0
+		} else {
+			childLayer, err := n.entries[0].tree.getLayer()
+			if err != nil {
+				return 0, err
+			}
+			layer = childLayer + 1
+		}
+	}
+
+	n.layer = layer
+	return layer, nil
+}
+
+// findLeafIndex returns the index of the first leaf whose key is greater than or equal to the key
+func (n *node) findLeafIndex(key string) int {
+	for i, e := range n.entries {
+		if e.isLeaf() && e.key >= key {
+			return i
+		}
+	}
+	return len(n.entries)
+}
+
+// replaceEntries returns a copy of the entries with entries[from:to] replaced
+func replaceEntries(entries []entry, from int, to int, replaced ...entry) []entry {
+	result := make([]entry, 0, len(entries)-(to-from)+len(replaced))
+	result = append(result, entries[:from]...)
+	result = append(result, replaced...)
+	result = append(result, entries[to:]...)
+	return result
+}
+
+// treeEntries returns the subtree entry of the node, or nothing if the node is nil
+func treeEntries(n *node) []entry {
+	if n == nil {
+		return nil
+	}
+	return []entry{{tree: n}}
+}
+
+func (n *node) get(key string) (cid.Cid, error) {
+	if err := n.load(); err != nil {
+		return cid.Undef, err
+	}
+
+	i := n.findLeafIndex(key)
+	if i < len(n.entries) && n.entries[i].key == key {
+		return n.entries[i].val, nil
+	}
+	if i > 0 && !n.entries[i-1].isLeaf() {
+		return n.entries[i-1].tree.get(key)
+	}
+
+	return cid.Undef, ErrNotFound
+}
+
+func (n *node) add(key string, val cid.Cid, keyLayer int) (*node, error) {
+	layer, err := n.getLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	if keyLayer > layer {
+		// the key belongs to a higher layer;
+		// split this node and push both halves down under the new key
+		left, right, err := n.split(key)
+		if err != nil {
+			return nil, err
+		}
+		for l := layer + 1; l < keyLayer; l++ {
+			if left != nil {
+				left = newNode(n.store, l, treeEntries(left))
+			}
+			if right != nil {
+				right = newNode(n.store, l, treeEntries(right))
+			}
+		}
+
+		entries := treeEntries(left)
+		entries = append(entries, entry{key: key, val: val})
+		entries = append(entries, treeEntries(right)...)
+		return newNode(n.store, keyLayer, entries), nil
+	}
+
+	i := n.findLeafIndex(key)
+	if i < len(n.entries) && n.entries[i].key == key {
+		return nil, ErrExists
+	}
+
+	var prev *node
+	if i > 0 && !n.entries[i-1].isLeaf() {
+		prev = n.entries[i-1].tree
+	}
+
+	if keyLayer == layer {
+		if prev == nil {
+			return newNode(n.store, layer, replaceEntries(n.entries, i, i, entry{key: key, val: val})), nil
+		}
+
+		// the key splits the subtree on its left
+		left, right, err := prev.split(key)
+		if err != nil {
+			return nil, err
+		}
+		replaced := treeEntries(left)
+		replaced = append(replaced, entry{key: key, val: val})
+		replaced = append(replaced, treeEntries(right)...)
+		return newNode(n.store, layer, replaceEntries(n.entries, i-1, i, replaced...)), nil
+	}
+
+	// the key belongs to a lower layer
+	if prev == nil {
+		child, err := newNode(n.store, layer-1, nil).add(key, val, keyLayer)
+		if err != nil {
+			return nil, err
+		}
+		return newNode(n.store, layer, replaceEntries(n.entries, i, i, entry{tree: child})), nil
+	}
+
+	child, err := prev.add(key, val, keyLayer)
+	if err != nil {
+		return nil, err
+	}
+	return newNode(n.store, layer, replaceEntries(n.entries, i-1, i, entry{tree: child})), nil
+}
+
+func (n *node) update(key string, val cid.Cid) (*node, error) {
+	if err := n.load(); err != nil {
+		return nil, err
+	}
+
+	i := n.findLeafIndex(key)
+	if i < len(n.entries) && n.entries[i].key == key {
+		return newNode(n.store, n.layer, replaceEntries(n.entries, i, i+1, entry{key: key, val: val})), nil
+	}
+	if i > 0 && !n.entries[i-1].isLeaf() {
+		child, err := n.entries[i-1].tree.update(key, val)
+		if err != nil {
+			return nil, err
+		}
+		return newNode(n.store, n.layer, replaceEntries(n.entries, i-1, i, entry{tree: child})), nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (n *node) delete(key string) (*node, error) {
+	layer, err := n.getLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	i := n.findLeafIndex(key)
+	if i < len(n.entries) && n.entries[i].key == key {
+		hasPrev := i > 0 && !n.entries[i-1].isLeaf()
+		hasNext := i+1 < len(n.entries) && !n.entries[i+1].isLeaf()
+		if hasPrev && hasNext {
+			// the subtrees on both sides of the removed key are merged
+			merged, err := merge(n.entries[i-1].tree, n.entries[i+1].tree)
+			if err != nil {
+				return nil, err
+			}
+			return newNode(n.store, layer, replaceEntries(n.entries, i-1, i+2, entry{tree: merged})), nil
+		}
+		return newNode(n.store, layer, replaceEntries(n.entries, i, i+1)), nil
+	}
+
+	if i > 0 && !n.entries[i-1].isLeaf() {
+		child, err := n.entries[i-1].tree.delete(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(child.entries) == 0 {
+			return newNode(n.store, layer, replaceEntries(n.entries, i-1, i)), nil
+		}
+		return newNode(n.store, layer, replaceEntries(n.entries, i-1, i, entry{tree: child})), nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// split splits the node into the nodes with keys less than and greater than the key
+// the results are nil if they have no entries.
+func (n *node) split(key string) (*node, *node, error) {
+	layer, err := n.getLayer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i := n.findLeafIndex(key)
+	left := append([]entry{}, n.entries[:i]...)
+	right := append([]entry{}, n.entries[i:]...)
+
+	if i > 0 && !n.entries[i-1].isLeaf() {
+		subLeft, subRight, err := n.entries[i-1].tree.split(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		left = append(left[:i-1], treeEntries(subLeft)...)
+		right = append(treeEntries(subRight), right...)
+	}
+
+	var leftNode, rightNode *node
+	if len(left) > 0 {
+		leftNode = newNode(n.store, layer, left)
+	}
+	if len(right) > 0 {
+		rightNode = newNode(n.store, layer, right)
+	}
+
+	return leftNode, rightNode, nil
+}
+
+// merge concatenates two adjacent nodes in the same layer
+func merge(left *node, right *node) (*node, error) {
+	layer, err := left.getLayer()
+	if err != nil {
+		return nil, err
+	}
+	if err := right.load(); err != nil {
+		return nil, err
+	}
+
+	lastLeft := len(left.entries) - 1
+	if lastLeft >= 0 && len(right.entries) > 0 &&
+		!left.entries[lastLeft].isLeaf() && !right.entries[0].isLeaf() {
+		merged, err := merge(left.entries[lastLeft].tree, right.entries[0].tree)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := append([]entry{}, left.entries[:lastLeft]...)
+		entries = append(entries, entry{tree: merged})
+		entries = append(entries, right.entries[1:]...)
+		return newNode(left.store, layer, entries), nil
+	}
+
+	entries := append([]entry{}, left.entries...)
+	entries = append(entries, right.entries...)
+	return newNode(left.store, layer, entries), nil
+}
+
+// walk calls fn for each leaf with key greater than or equal to from in key order
+func (n *node) walk(from string, fn func(key string, val cid.Cid) error) error {
+	if err := n.load(); err != nil {
+		return err
+	}
+
+	for i, e := range n.entries {
+		if e.isLeaf() {
+			if e.key < from {
+				continue
+			}
+			if err := fn(e.key, e.val); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// all keys in the subtree are less than the next leaf
+		if i+1 < len(n.entries) && n.entries[i+1].key <= from {
+			continue
+		}
+		if err := e.tree.walk(from, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkReverse calls fn for each leaf with key less than or equal to to in reverse key order
+func (n *node) walkReverse(to string, fn func(key string, val cid.Cid) error) error {
+	if err := n.load(); err != nil {
+		return err
+	}
+
+	for i := len(n.entries) - 1; i >= 0; i-- {
+		e := n.entries[i]
+		if e.isLeaf() {
+			if e.key > to {
+				continue
+			}
+			if err := fn(e.key, e.val); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// all keys in the subtree are greater than the previous leaf
+		if i > 0 && n.entries[i-1].key >= to {
+			continue
+		}
+		if err := e.tree.walkReverse(to, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeBlocks encodes the node and its modified subtrees, and puts them into the store
+func (n *node) writeBlocks() (cid.Cid, error) {
+	if n.pointer.Defined() {
+		return n.pointer, nil
+	}
+
+	for _, e := range n.entries {
+		if e.isLeaf() {
+			continue
+		}
+		if _, err := e.tree.writeBlocks(); err != nil {
+			return cid.Undef, err
+		}
+	}
+
+	b, err := EncodeNodeData(n.encode())
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	c, err := data.CIDPrefix.Sum(b)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to calculate CID; %w", err)
+	}
+
+	if err := n.store.Put(c, b); err != nil {
+		return cid.Undef, err
+	}
+
+	n.pointer = c
+	return c, nil
+}
+
+// Tree is a Merkle Search Tree
+type Tree struct {
+	store Store
+	root  *node
+}
+
+// NewTree returns a new empty Tree
+// If store is nil, the nodes are stored in memory.
+func NewTree(store Store) *Tree {
+	if store == nil {
+		store = memStore{}
+	}
+
+	return &Tree{
+		store: store,
+		root:  newNode(store, 0, nil),
+	}
+}
+
+// LoadTree returns the Tree with the root CID
+// The nodes are loaded from the store lazily when they are needed.
+func LoadTree(store Store, root cid.Cid) (*Tree, error) {
+	if store == nil {
+		return nil, fmt.Errorf("failed to load MST; store is nil")
+	}
+
+	n := unloadedNode(store, root)
+	if err := n.load(); err != nil {
+		return nil, err
+	}
+
+	return &Tree{
+		store: store,
+		root:  n,
+	}, nil
+}
+
+// Store returns the store of the tree
+func (t *Tree) Store() Store {
+	return t.store
+}
+
+// Get returns the value of the key
+// If the key is not found, it returns ErrNotFound
+func (t *Tree) Get(key string) (cid.Cid, error) {
+	return t.root.get(key)
+}
+
+// Insert adds the key with the value to the tree
+// If the key already exists, it returns ErrExists
+func (t *Tree) Insert(key string, val cid.Cid) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	root, err := t.root.add(key, val, KeyHeight(key))
+	if err != nil {
+		return err
+	}
+
+	t.root = root
+	return nil
+}
+
+// Update replaces the value of the key
+// If the key is not found, it returns ErrNotFound
+func (t *Tree) Update(key string, val cid.Cid) error {
+	root, err := t.root.update(key, val)
+	if err != nil {
+		return err
+	}
+
+	t.root = root
+	return nil
+}
+
+// Put inserts the key or updates the value of the key if it already exists
+func (t *Tree) Put(key string, val cid.Cid) error {
+	if err := t.Update(key, val); !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return t.Insert(key, val)
+}
+
+// Delete removes the key from the tree
+// If the key is not found, it returns ErrNotFound
+func (t *Tree) Delete(key string) error {
+	root, err := t.root.delete(key)
+	if err != nil {
+		return err
+	}
+
+	// trim the top of the tree while the root has only a subtree
+	for len(root.entries) == 1 && !root.entries[0].isLeaf() {
+		root = root.entries[0].tree
+		if err := root.load(); err != nil {
+			return err
+		}
+	}
+	if len(root.entries) == 0 {
+		root = newNode(t.store, 0, nil)
+	}
+
+	t.root = root
+	return nil
+}
+
+// Walk calls fn for each key and value in the tree in key order
+// If fn returns ErrStopWalk, Walk stops and returns nil.
+func (t *Tree) Walk(fn func(key string, val cid.Cid) error) error {
+	return t.WalkFrom("", fn)
+}
+
+// WalkFrom calls fn for each key greater than or equal to from in key order
+// If fn returns ErrStopWalk, WalkFrom stops and returns nil.
+func (t *Tree) WalkFrom(from string, fn func(key string, val cid.Cid) error) error {
+	err := t.root.walk(from, fn)
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+// WalkReverseFrom calls fn for each key less than or equal to from in reverse key order
+// If fn returns ErrStopWalk, WalkReverseFrom stops and returns nil.
+func (t *Tree) WalkReverseFrom(from string, fn func(key string, val cid.Cid) error) error {
+	err := t.root.walkReverse(from, fn)
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+// Entry is a key and value in the tree
+type Entry struct {
+	Key   string
+	Value cid.Cid
+}
+
+// List returns the entries whose keys have the prefix in key order
+// e.g. List("app.bsky.feed.post/") returns all records in the collection.
+func (t *Tree) List(prefix string) ([]Entry, error) {
+	var entries []Entry
+
+	err := t.WalkFrom(prefix, func(key string, val cid.Cid) error {
+		if !strings.HasPrefix(key, prefix) {
+			return ErrStopWalk
+		}
+		entries = append(entries, Entry{Key: key, Value: val})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Root writes the modified nodes into the store, and returns the root CID of the tree
+func (t *Tree) Root() (cid.Cid, error) {
+	return t.root.writeBlocks()
+}
@@ -0,0 +1,419 @@
+package mst_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/mst"
+)
+
+// These fixtures are taken from the reference implementation and the interop test files:
+// https://github.com/bluesky-social/atproto/blob/main/packages/repo/tests/mst.test.ts
+// https://github.com/bluesky-social/atproto-interop-tests/tree/main/mst
+
+var testValue = cid.MustParse("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+
+func TestKeyHeight(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "", want: 0},
+		{key: "asdf", want: 0},
+		{key: "blue", want: 1},
+		{key: "2653ae71", want: 0},
+		{key: "88bfafc7", want: 2},
+		{key: "2a92d355", want: 4},
+		{key: "884976f5", want: 6},
+		{key: "app.bsky.feed.post/454397e440ec", want: 4},
+		{key: "app.bsky.feed.post/9adeb165882c", want: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := mst.KeyHeight(tt.key); got != tt.want {
+				t.Errorf("KeyHeight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "com.example.record/3jqfcqzm3fo2j", wantErr: false},
+		{key: "app.bsky.actor.profile/self", wantErr: false},
+		{key: "", wantErr: true},
+		{key: "com.example.record", wantErr: true},
+		{key: "com.example.record/", wantErr: true},
+		{key: "/3jqfcqzm3fo2j", wantErr: true},
+		{key: "com.example.record/a/b", wantErr: true},
+		{key: "com.example.*/3jqfcqzm3fo2j", wantErr: true},
+		{key: "com.example.record#main/3jqfcqzm3fo2j", wantErr: true},
+		{key: "com.example.record/..", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if err := mst.ValidateKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTree_Root(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{
+			name: "empty",
+			keys: nil,
+			want: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm",
+		},
+		{
+			name: "trivial",
+			keys: []string{
+				"com.example.record/3jqfcqzm3fo2j", // level 0
+			},
+			want: "bafyreibj4lsc3aqnrvphp5xmrnfoorvru4wynt6lwidqbm2623a6tatzdu",
+		},
+		{
+			name: "singlelayer2",
+			keys: []string{
+				"com.example.record/3jqfcqzm3fx2j", // level 2
+			},
+			want: "bafyreih7wfei65pxzhauoibu3ls7jgmkju4bspy4t2ha2qdjnzqvoy33ai",
+		},
+		{
+			name: "simple",
+			keys: []string{
+				"com.example.record/3jqfcqzm3fp2j", // level 0
+				"com.example.record/3jqfcqzm3fr2j", // level 0
+				"com.example.record/3jqfcqzm3fs2j", // level 1
+				"com.example.record/3jqfcqzm3ft2j", // level 0
+				"com.example.record/3jqfcqzm4fc2j", // level 0
+			},
+			want: "bafyreicmahysq4n6wfuxo522m6dpiy7z7qzym3dzs756t5n7nfdgccwq7m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := mst.NewTree(nil)
+			for _, key := range tt.keys {
+				if err := tree.Insert(key, testValue); err != nil {
+					t.Fatalf("Insert() error = %v", err)
+				}
+			}
+
+			got, err := tree.Root()
+			if err != nil {
+				t.Fatalf("Root() error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Root() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("com.example.record/%x", sha256.Sum256([]byte(fmt.Sprint(i))))[:40]
+	}
+	return keys
+}
+
+func testValues(key string) cid.Cid {
+	c, err := data.CIDPrefix.Sum([]byte(key))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func rootOf(t *testing.T, keys []string) cid.Cid {
+	t.Helper()
+
+	tree := mst.NewTree(nil)
+	for _, key := range keys {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	root, err := tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	return root
+}
+
+func TestTree_Deterministic(t *testing.T) {
+	keys := testKeys(500)
+	want := rootOf(t, keys)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5; i++ {
+		shuffled := append([]string{}, keys...)
+		r.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		if got := rootOf(t, shuffled); !got.Equals(want) {
+			t.Errorf("Root() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTree_Delete(t *testing.T) {
+	keys := testKeys(300)
+
+	tree := mst.NewTree(nil)
+	for _, key := range keys {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(2))
+	r.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+
+	// deleting the half of the keys must result in the same tree
+	// as inserting only the other half
+	for _, key := range keys[150:] {
+		if err := tree.Delete(key); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	got, err := tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	if want := rootOf(t, keys[:150]); !got.Equals(want) {
+		t.Errorf("Root() = %v, want %v", got, want)
+	}
+
+	if err := tree.Delete(keys[200]); !errors.Is(err, mst.ErrNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, mst.ErrNotFound)
+	}
+
+	for _, key := range keys[:150] {
+		if err := tree.Delete(key); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	got, err = tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	if want := rootOf(t, nil); !got.Equals(want) {
+		t.Errorf("Root() = %v, want %v", got, want)
+	}
+}
+
+func TestTree_GetUpdate(t *testing.T) {
+	keys := testKeys(100)
+
+	tree := mst.NewTree(nil)
+	for _, key := range keys {
+		if err := tree.Insert(key, testValue); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	if err := tree.Insert(keys[0], testValue); !errors.Is(err, mst.ErrExists) {
+		t.Errorf("Insert() error = %v, want %v", err, mst.ErrExists)
+	}
+	if err := tree.Update("com.example.record/missing", testValue); !errors.Is(err, mst.ErrNotFound) {
+		t.Errorf("Update() error = %v, want %v", err, mst.ErrNotFound)
+	}
+
+	for _, key := range keys {
+		if err := tree.Update(key, testValues(key)); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+
+	for _, key := range keys {
+		got, err := tree.Get(key)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if !got.Equals(testValues(key)) {
+			t.Errorf("Get() = %v, want %v", got, testValues(key))
+		}
+	}
+
+	if _, err := tree.Get("com.example.record/missing"); !errors.Is(err, mst.ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, mst.ErrNotFound)
+	}
+
+	got, err := tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	if want := rootOf(t, keys); !got.Equals(want) {
+		t.Errorf("Root() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadTree(t *testing.T) {
+	keys := append(testKeys(200), "com.example.other/self", "com.example.other/a")
+
+	store := mstStore{}
+	tree := mst.NewTree(store)
+	for _, key := range keys {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	root, err := tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+
+	loaded, err := mst.LoadTree(store, root)
+	if err != nil {
+		t.Fatalf("LoadTree() error = %v", err)
+	}
+
+	var walked []string
+	err = loaded.Walk(func(key string, val cid.Cid) error {
+		if !val.Equals(testValues(key)) {
+			t.Errorf("Walk() value of %v = %v, want %v", key, val, testValues(key))
+		}
+		walked = append(walked, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	if fmt.Sprint(walked) != fmt.Sprint(sorted) {
+		t.Errorf("Walk() = %v, want %v", walked, sorted)
+	}
+
+	listed, err := loaded.List("com.example.other/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 2 || listed[0].Key != "com.example.other/a" || listed[1].Key != "com.example.other/self" {
+		t.Errorf("List() = %v, want %v", listed, []string{"com.example.other/a", "com.example.other/self"})
+	}
+
+	// mutating the loaded tree must give the same root as building from scratch
+	if err := loaded.Delete("com.example.other/a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	got, err := loaded.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	if want := rootOf(t, keys[:len(keys)-1]); !got.Equals(want) {
+		t.Errorf("Root() = %v, want %v", got, want)
+	}
+}
+
+func TestTree_WalkReverseFrom(t *testing.T) {
+	keys := testKeys(300)
+
+	store := mstStore{}
+	tree := mst.NewTree(store)
+	for _, key := range keys {
+		if err := tree.Insert(key, testValues(key)); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	root, err := tree.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	loaded, err := mst.LoadTree(store, root)
+	if err != nil {
+		t.Fatalf("LoadTree() error = %v", err)
+	}
+
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+
+	tests := []struct {
+		name string
+		from string
+		want []string
+	}{
+		{"successfull case; all keys", "com.example.record/\x7f", sorted},
+		{"successfull case; existing key", sorted[150], sorted[:151]},
+		{"successfull case; between keys", sorted[150] + "\x00", sorted[:151]},
+		{"successfull case; before the first key", "a", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var walked []string
+			err := loaded.WalkReverseFrom(tt.from, func(key string, val cid.Cid) error {
+				walked = append(walked, key)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WalkReverseFrom() error = %v", err)
+			}
+
+			var want []string
+			for i := len(tt.want) - 1; i >= 0; i-- {
+				want = append(want, tt.want[i])
+			}
+			if fmt.Sprint(walked) != fmt.Sprint(want) {
+				t.Errorf("WalkReverseFrom() = %v, want %v", walked, want)
+			}
+		})
+	}
+
+	// stops without error
+	var walked []string
+	err = loaded.WalkReverseFrom(sorted[100], func(key string, val cid.Cid) error {
+		if len(walked) == 3 {
+			return mst.ErrStopWalk
+		}
+		walked = append(walked, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkReverseFrom() error = %v", err)
+	}
+	if want := []string{sorted[100], sorted[99], sorted[98]}; fmt.Sprint(walked) != fmt.Sprint(want) {
+		t.Errorf("WalkReverseFrom() = %v, want %v", walked, want)
+	}
+}
+
+type mstStore map[cid.Cid][]byte
+
+func (s mstStore) Get(c cid.Cid) ([]byte, error) {
+	b, ok := s[c]
+	if !ok {
+		return nil, fmt.Errorf("block not found: %s", c)
+	}
+	return b, nil
+}
+
+func (s mstStore) Put(c cid.Cid, data []byte) error {
+	s[c] = data
+	return nil
+}
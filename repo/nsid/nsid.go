@@ -9,9 +9,13 @@ import (
 )
 
 const (
-	rpattern = `^[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+((\.\*)|(\.([a-zA-Z]{1,63}))((\.\*)|(#[a-zA-Z]{1,63}))?)$`
+	// the first domain segment starts with a letter, and the others may start with a digit
+	// the name and the fragment start with a letter, followed by letters and digits
+	rpattern = `^[a-zA-Z]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+((\.\*)|(\.([a-zA-Z][a-zA-Z0-9]{0,62}))((\.\*)|(#[a-zA-Z][a-zA-Z0-9]{0,62}))?)$`
 )
 
+var rregexp = regexp.MustCompile(rpattern)
+
 // NSID is a struct for NSID
 type NSID struct {
 	dsegments []string // domain segments
@@ -28,8 +32,7 @@ func NewNSID(nsidStr string) (*NSID, error) {
 		return nil, fmt.Errorf("invalid NSID: %s; too long", nsidStr)
 	}
 
-	r := regexp.MustCompile(rpattern)
-	if !r.MatchString(nsidStr) {
+	if !rregexp.MatchString(nsidStr) {
 		return nil, fmt.Errorf("invalid NSID: %s; wrong pattern", nsidStr)
 	}
 
@@ -65,9 +68,6 @@ func NewNSID(nsidStr string) (*NSID, error) {
 		nsid.glob = true
 	}
 
-	if len(strings.Join(nsid.dsegments, ".")) > 253 {
-		return nil, fmt.Errorf("invalid NSID: %s; domain segments are too long", nsidStr)
-	}
 	if len(nsid.name) > 63 {
 		return nil, fmt.Errorf("invalid NSID: %s; name is too long", nsidStr)
 	}
@@ -104,3 +104,71 @@ func (nsid *NSID) Glob() bool {
 func (nsid *NSID) DSegments() []string {
 	return nsid.dsegments
 }
+
+// Authority returns the domain authority of NSID
+// The authority is the reversed domain segments (e.g. "feed.bsky.app" for "app.bsky.feed.post"),
+// which is used for Lexicon DNS lookup.
+func (nsid *NSID) Authority() string {
+	reversed := make([]string, len(nsid.dsegments))
+	for i, dsegment := range nsid.dsegments {
+		reversed[len(nsid.dsegments)-1-i] = strings.ToLower(dsegment)
+	}
+	return strings.Join(reversed, ".")
+}
+
+// Canonical returns the canonical form of NSID
+// The domain segments are case-insensitive and normalized to lower case,
+// while the name segment and the fragment are case-sensitive and kept as is.
+func (nsid *NSID) Canonical() string {
+	dsegments := make([]string, len(nsid.dsegments))
+	for i, dsegment := range nsid.dsegments {
+		dsegments[i] = strings.ToLower(dsegment)
+	}
+
+	if nsid.fragment == "" {
+		return strings.Join(dsegments, ".") + "." + nsid.name
+	}
+	return strings.Join(dsegments, ".") + "." + nsid.name + "#" + nsid.fragment
+}
+
+// Equal returns true if the canonical forms of both NSIDs are the same
+func (nsid *NSID) Equal(other *NSID) bool {
+	return nsid.Canonical() == other.Canonical()
+}
+
+// Compare returns an integer comparing the canonical forms of two NSIDs lexicographically.
+// The result will be 0 if nsid == other, -1 if nsid < other, and +1 if nsid > other.
+func (nsid *NSID) Compare(other *NSID) int {
+	return strings.Compare(nsid.Canonical(), other.Canonical())
+}
+
+// Less returns true if nsid sorts before other
+func (nsid *NSID) Less(other *NSID) bool {
+	return nsid.Compare(other) < 0
+}
+
+// Match returns true if target matches nsid as a pattern
+// If nsid has glob, target matches when its segments start with the domain segments of nsid
+// (e.g. "app.bsky.*" matches "app.bsky.feed.post" and "app.bsky.actor.*").
+// Otherwise, target matches only when both NSIDs are equal.
+func (nsid *NSID) Match(target *NSID) bool {
+	if !nsid.glob {
+		return nsid.Equal(target)
+	}
+
+	segments := target.dsegments
+	if !target.glob {
+		segments = append(append([]string{}, target.dsegments...), target.name)
+	}
+
+	if len(segments) < len(nsid.dsegments) {
+		return false
+	}
+	for i, dsegment := range nsid.dsegments {
+		if !strings.EqualFold(dsegment, segments[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -68,6 +68,19 @@ func TestNewNSID(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "successfull case - digits in domain segments and name",
+			args: args{
+				nsidStr: "org.4chan.lex.getThing2",
+			},
+			want: &NSID{
+				dsegments: []string{"org", "4chan", "lex"},
+				name:      "getThing2",
+				fragment:  "",
+				glob:      false,
+			},
+			wantErr: false,
+		},
 		{
 			name: "successfull case - with fragment 1",
 			args: args{
@@ -236,6 +249,22 @@ func TestNewNSID(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "failure case - first domain segment starts with digit",
+			args: args{
+				nsidStr: "0two.example.foo",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "failure case - name starts with digit",
+			args: args{
+				nsidStr: "com.example.fooBar.2",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "failure case - invalid wildcard",
 			args: args{
@@ -267,3 +296,128 @@ func TestNewNSID(t *testing.T) {
 		})
 	}
 }
+
+func TestNSID_Authority(t *testing.T) {
+	tests := []struct {
+		nsidStr string
+		want    string
+	}{
+		{nsidStr: "app.bsky.feed.post", want: "feed.bsky.app"},
+		{nsidStr: "com.example.fooBar", want: "example.com"},
+		{nsidStr: "COM.Example.fooBar#baz", want: "example.com"},
+		{nsidStr: "app.bsky.*", want: "bsky.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nsidStr, func(t *testing.T) {
+			nsid, err := NewNSID(tt.nsidStr)
+			if err != nil {
+				t.Fatalf("NewNSID() error = %v", err)
+			}
+			if got := nsid.Authority(); got != tt.want {
+				t.Errorf("Authority() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNSID_Canonical(t *testing.T) {
+	tests := []struct {
+		name string
+		nsid *NSID
+		want string
+	}{
+		{
+			name: "lower case",
+			nsid: &NSID{dsegments: []string{"com", "example"}, name: "fooBar"},
+			want: "com.example.fooBar",
+		},
+		{
+			name: "mixed case",
+			nsid: &NSID{dsegments: []string{"COM", "Example"}, name: "fooBar", fragment: "Baz"},
+			want: "com.example.fooBar#Baz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.nsid.Canonical(); got != tt.want {
+				t.Errorf("Canonical() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNSID_Compare(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "com.example.fooBar", b: "com.example.fooBar", want: 0},
+		{a: "COM.EXAMPLE.fooBar", b: "com.example.fooBar", want: 0},
+		{a: "com.example.fooBar", b: "com.example.foobar", want: -1},
+		{a: "com.example.foo", b: "com.example.foo#bar", want: -1},
+		{a: "com.example.b", b: "com.example.a", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := NewNSID(tt.a)
+			if err != nil {
+				t.Fatalf("NewNSID() error = %v", err)
+			}
+			b, err := NewNSID(tt.b)
+			if err != nil {
+				t.Fatalf("NewNSID() error = %v", err)
+			}
+			if got := a.Compare(b); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+			if got := a.Equal(b); got != (tt.want == 0) {
+				t.Errorf("Equal() = %v, want %v", got, tt.want == 0)
+			}
+			if got := a.Less(b); got != (tt.want < 0) {
+				t.Errorf("Less() = %v, want %v", got, tt.want < 0)
+			}
+		})
+	}
+}
+
+func TestNSID_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		target  string
+		want    bool
+	}{
+		{pattern: "app.bsky.*", target: "app.bsky.feed.post", want: true},
+		{pattern: "app.bsky.*", target: "app.bsky.post", want: true},
+		{pattern: "app.bsky.*", target: "APP.bsky.feed.post", want: true},
+		{pattern: "app.bsky.*", target: "app.bsky.feed.post#main", want: true},
+		{pattern: "app.bsky.*", target: "app.bsky.feed.*", want: true},
+		{pattern: "app.bsky.*", target: "app.bsky.*", want: true},
+		{pattern: "app.bsky.feed.*", target: "app.bsky.*", want: false},
+		{pattern: "app.bsky.*", target: "com.atproto.repo.getRecord", want: false},
+		{pattern: "app.bsky.*", target: "app.bskyx.feed.post", want: false},
+		{pattern: "app.bsky.feed.*", target: "app.bsky.actor.profile", want: false},
+		{pattern: "app.bsky.feed.post", target: "app.bsky.feed.post", want: true},
+		{pattern: "app.bsky.feed.post", target: "app.bsky.feed.like", want: false},
+		{pattern: "app.bsky.feed.post", target: "app.bsky.feed.post#main", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.target, func(t *testing.T) {
+			pattern, err := NewNSID(tt.pattern)
+			if err != nil {
+				t.Fatalf("NewNSID() error = %v", err)
+			}
+			target, err := NewNSID(tt.target)
+			if err != nil {
+				t.Fatalf("NewNSID() error = %v", err)
+			}
+			if got := pattern.Match(target); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
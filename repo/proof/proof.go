@@ -0,0 +1,203 @@
+// the package proof implements inclusion and non-existence proofs of records
+// in signed repositories; a proof is the signed commit and the MST nodes
+// on the path to the record, packaged as a small CAR
+
+package proof
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/car"
+	"go.yumnet.cloud/orangesea/repo/commit"
+	"go.yumnet.cloud/orangesea/repo/mst"
+)
+
+var ErrIncompleteProof = errors.New("incomplete proof")
+
+// Proof is a proof of a record in a signed repository
+// Blocks contain the signed commit, the MST nodes on the path to the record,
+// and the record itself if it exists.
+type Proof struct {
+	Commit cid.Cid
+	Blocks *blockstore.MemBlockstore
+}
+
+// recordingStore is a Store which copies the blocks read through it
+type recordingStore struct {
+	backend  mst.Store
+	recorded *blockstore.MemBlockstore
+}
+
+func (s *recordingStore) Get(c cid.Cid) ([]byte, error) {
+	b, err := s.backend.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recorded.Put(c, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *recordingStore) Put(c cid.Cid, data []byte) error {
+	return fmt.Errorf("failed to put block: %s; proof store is read-only", c)
+}
+
+// Generate returns the proof of the record at `<collection>/<rkey>` in the commit
+// If the record does not exist, the proof is a proof of non-existence.
+func Generate(store blockstore.Blockstore, commitCID cid.Cid, collection string, rk string) (*Proof, error) {
+	blocks := blockstore.NewMemBlockstore()
+	rs := &recordingStore{backend: store, recorded: blocks}
+
+	b, err := rs.Get(commitCID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit: %s; %w", commitCID, err)
+	}
+	c, err := commit.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := mst.LoadTree(rs, c.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := tree.Get(collection + "/" + rk)
+	if err != nil && !errors.Is(err, mst.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		if _, err := rs.Get(val); err != nil {
+			return nil, fmt.Errorf("failed to load record: %s; %w", val, err)
+		}
+	}
+
+	return &Proof{
+		Commit: commitCID,
+		Blocks: blocks,
+	}, nil
+}
+
+// WriteCAR writes the proof as a CAR with the commit as the root
+func (p *Proof) WriteCAR(w io.Writer) error {
+	return blockstore.ExportCAR(p.Blocks, w, []cid.Cid{p.Commit})
+}
+
+// ReadCAR reads the proof from the CAR
+// The CAR must have exactly one root, the commit.
+func ReadCAR(r io.Reader) (*Proof, error) {
+	blocks := blockstore.NewMemBlockstore()
+	roots, err := blockstore.ImportCAR(blocks, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("invalid proof; CAR must have exactly one root, got %d", len(roots))
+	}
+
+	return &Proof{
+		Commit: roots[0],
+		Blocks: blocks,
+	}, nil
+}
+
+// Result is the result of a verified proof
+type Result struct {
+	Commit     *commit.Commit
+	CommitCID  cid.Cid
+	Collection string
+	RKey       string
+	CID        cid.Cid // undefined if the record does not exist
+	Record     []byte  // DAG-CBOR bytes of the record, nil if the record does not exist
+}
+
+// Exists returns true if the proof proves the existence of the record
+func (r *Result) Exists() bool {
+	return r.CID.Defined()
+}
+
+// Verifier verifies proofs with the signing keys of the DIDs
+type Verifier struct {
+	Commits *commit.Verifier
+}
+
+// NewVerifier returns a new Verifier with the default DID resolver
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Commits: commit.NewVerifier(),
+	}
+}
+
+// Verify verifies the proof of the record at `<collection>/<rkey>` in the repository of the DID
+// It checks the blocks match their CIDs, the commit is signed by the signing key of the DID,
+// and walks the MST path from the commit to the record.
+// If the path proves the record does not exist, the returned Result has an undefined CID.
+func (v *Verifier) Verify(ctx context.Context, p *Proof, did string, collection string, rk string) (*Result, error) {
+	keys, err := p.Blocks.AllKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		b, err := p.Blocks.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := car.Verify(k, b); err != nil {
+			return nil, fmt.Errorf("invalid proof; %w", err)
+		}
+	}
+
+	b, err := p.Blocks.Get(p.Commit)
+	if err != nil {
+		return nil, fmt.Errorf("%w; commit is missing: %s", ErrIncompleteProof, p.Commit)
+	}
+	c, err := commit.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if c.DID != did {
+		return nil, fmt.Errorf("invalid proof; commit is of another DID: %s", c.DID)
+	}
+	if err := v.Commits.Verify(ctx, c, nil); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Commit:     c,
+		CommitCID:  p.Commit,
+		Collection: collection,
+		RKey:       rk,
+	}
+
+	tree, err := mst.LoadTree(p.Blocks, c.Data)
+	if errors.Is(err, blockstore.ErrNotFound) {
+		return nil, fmt.Errorf("%w; %v", ErrIncompleteProof, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := tree.Get(collection + "/" + rk)
+	if errors.Is(err, mst.ErrNotFound) {
+		return result, nil
+	}
+	if errors.Is(err, blockstore.ErrNotFound) {
+		return nil, fmt.Errorf("%w; %v", ErrIncompleteProof, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.CID = val
+	if record, err := p.Blocks.Get(val); err == nil {
+		result.Record = record
+	}
+
+	return result, nil
+}
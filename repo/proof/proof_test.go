@@ -0,0 +1,176 @@
+package proof_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/repo"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/commit"
+	"go.yumnet.cloud/orangesea/repo/internal/testutil"
+	"go.yumnet.cloud/orangesea/repo/proof"
+)
+
+const (
+	testDID        = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+	testCollection = "app.bsky.feed.post"
+)
+
+func newTestRepo(t *testing.T, key *didkey.DIDKey, n int) (*repo.Repo, *blockstore.MemBlockstore) {
+	t.Helper()
+
+	store := blockstore.NewMemBlockstore()
+	r, _, err := repo.NewRepo(testDID, key, store)
+	if err != nil {
+		t.Fatalf("NewRepo() error = %v", err)
+	}
+
+	writes := make([]repo.Write, 0, n)
+	for i := 0; i < n; i++ {
+		writes = append(writes, repo.Write{
+			Action:     repo.ACTION_CREATE,
+			Collection: testCollection,
+			RKey:       fmt.Sprintf("record%04d", i),
+			Value:      testutil.Record(t, testCollection, fmt.Sprint(i)),
+		})
+	}
+	if _, err := r.ApplyWrites(writes); err != nil {
+		t.Fatalf("ApplyWrites() error = %v", err)
+	}
+
+	return r, store
+}
+
+// roundTrip writes the proof as a CAR and reads it back
+func roundTrip(t *testing.T, p *proof.Proof) *proof.Proof {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	if err := p.WriteCAR(buf); err != nil {
+		t.Fatalf("WriteCAR() error = %v", err)
+	}
+	read, err := proof.ReadCAR(buf)
+	if err != nil {
+		t.Fatalf("ReadCAR() error = %v", err)
+	}
+	return read
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	r, store := newTestRepo(t, key, 300)
+	verifier := &proof.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: key}}}
+
+	type args struct {
+		rkey string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantExists bool
+	}{
+		{
+			name:       "successfull case: inclusion",
+			args:       args{rkey: "record0123"},
+			wantExists: true,
+		},
+		{
+			name:       "successfull case: non-existence",
+			args:       args{rkey: "record9999"},
+			wantExists: false,
+		},
+		{
+			name:       "successfull case: non-existence before all keys",
+			args:       args{rkey: "aaaa"},
+			wantExists: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := r.ProveRecord(testCollection, tt.args.rkey)
+			if err != nil {
+				t.Fatalf("ProveRecord() error = %v", err)
+			}
+
+			all, _ := store.AllKeys()
+			blocks, _ := p.Blocks.AllKeys()
+			if len(blocks) >= len(all)/10 {
+				t.Errorf("ProveRecord() has %d of %d blocks, want a minimal proof", len(blocks), len(all))
+			}
+
+			got, err := verifier.Verify(context.Background(), roundTrip(t, p), testDID, testCollection, tt.args.rkey)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.Exists() != tt.wantExists {
+				t.Errorf("Verify() exists = %v, want %v", got.Exists(), tt.wantExists)
+			}
+
+			record, err := r.GetRecord(testCollection, tt.args.rkey)
+			if tt.wantExists {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.CID.Equals(record.CID) || got.Record == nil {
+					t.Errorf("Verify() = %v, want record %v", got.CID, record.CID)
+				}
+			} else if !errors.Is(err, repo.ErrRecordNotFound) {
+				t.Errorf("GetRecord() error = %v, want ErrRecordNotFound", err)
+			}
+		})
+	}
+}
+
+func TestVerifier_Verify_Failure(t *testing.T) {
+	key := testutil.Key(t, "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA")
+	other := testutil.Key(t, "JkJ5gm2y4HqzrjumUCZ7X4hyqXT1CuhrV5QUZYxeRss")
+	r, _ := newTestRepo(t, key, 300)
+
+	p, err := r.ProveRecord(testCollection, "record0042")
+	if err != nil {
+		t.Fatalf("ProveRecord() error = %v", err)
+	}
+	c, _ := r.Commit()
+
+	t.Run("failure case: signed by another key", func(t *testing.T) {
+		verifier := &proof.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: other}}}
+		if _, err := verifier.Verify(context.Background(), roundTrip(t, p), testDID, testCollection, "record0042"); err == nil {
+			t.Errorf("Verify() error = nil, wantErr true")
+		}
+	})
+
+	verifier := &proof.Verifier{Commits: &commit.Verifier{DIDs: testutil.DIDs{testDID: key}}}
+
+	t.Run("failure case: another DID", func(t *testing.T) {
+		if _, err := verifier.Verify(context.Background(), roundTrip(t, p), "did:plc:aaaaaaaaaaaaaaaaaaaaaaaa", testCollection, "record0042"); err == nil {
+			t.Errorf("Verify() error = nil, wantErr true")
+		}
+	})
+
+	t.Run("failure case: missing MST node", func(t *testing.T) {
+		tampered := roundTrip(t, p)
+		keys, _ := tampered.Blocks.AllKeys()
+		for _, k := range keys {
+			// keep only the commit and the root node
+			if !k.Equals(tampered.Commit) && !k.Equals(c.Data) {
+				_ = tampered.Blocks.Delete(k)
+			}
+		}
+
+		_, err := verifier.Verify(context.Background(), tampered, testDID, testCollection, "record0042")
+		if !errors.Is(err, proof.ErrIncompleteProof) {
+			t.Errorf("Verify() error = %v, want ErrIncompleteProof", err)
+		}
+	})
+
+	t.Run("failure case: proof of another path", func(t *testing.T) {
+		_, err := verifier.Verify(context.Background(), roundTrip(t, p), testDID, testCollection, "record0250")
+		if !errors.Is(err, proof.ErrIncompleteProof) {
+			t.Errorf("Verify() error = %v, want ErrIncompleteProof", err)
+		}
+	})
+}
@@ -0,0 +1,581 @@
+// the package repo implements atproto repositories
+// on top of the MST, records and signed commits
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	didkey "go.yumnet.cloud/orangesea/did/key"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/commit"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/mst"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+	"go.yumnet.cloud/orangesea/repo/proof"
+	"go.yumnet.cloud/orangesea/repo/rkey"
+)
+
+const (
+	DEFAULT_LIST_LIMIT = 50
+	MAX_LIST_LIMIT     = 100
+)
+
+var (
+	ErrRecordNotFound = errors.New("record not found")
+	ErrRecordExists   = errors.New("record already exists")
+)
+
+type WriteAction int
+
+const (
+	// write actions
+	ACTION_CREATE WriteAction = iota
+	ACTION_UPDATE
+	ACTION_DELETE
+	ACTION_PUT // creates the record or updates it if it already exists
+)
+
+func (a WriteAction) String() string {
+	switch a {
+	case ACTION_CREATE:
+		return "create"
+	case ACTION_UPDATE:
+		return "update"
+	case ACTION_DELETE:
+		return "delete"
+	case ACTION_PUT:
+		return "put"
+	default:
+		return "unknown"
+	}
+}
+
+// Write is a write operation of a record
+type Write struct {
+	Action     WriteAction
+	Collection string
+	RKey       string         // if empty on create, a new TID is used
+	Value      datamodel.Node // must be nil on delete
+}
+
+// WriteResult is the result of a write operation
+type WriteResult struct {
+	Action     WriteAction
+	Collection string
+	RKey       string
+	CID        cid.Cid // undefined on delete
+}
+
+// Path returns the repository path of the record in `<collection>/<rkey>` format
+func (w WriteResult) Path() string {
+	return w.Collection + "/" + w.RKey
+}
+
+// CommitResult is the result of a commit
+type CommitResult struct {
+	Commit  *commit.Commit
+	CID     cid.Cid
+	Prev    cid.Cid // undefined if this is the first commit
+	PrevRev string  // empty if this is the first commit
+	Results []WriteResult
+
+	// Blocks are the blocks newly written by the commit;
+	// the records, the MST nodes and the commit itself
+	Blocks *blockstore.MemBlockstore
+}
+
+// Record is a record in the repository
+type Record struct {
+	Collection string
+	RKey       string
+	CID        cid.Cid
+	Value      datamodel.Node
+}
+
+// RecordValidator validates records against their schemas before they are written
+// *lexicon.Validator satisfies this interface.
+type RecordValidator interface {
+	ValidateRecord(collection string, value datamodel.Node) error
+	ValidateRecordKey(collection string, rk string) error
+}
+
+// Repo is an atproto repository
+// Repo is safe for concurrent use.
+type Repo struct {
+	did   string
+	store blockstore.Blockstore
+	key   *didkey.DIDKey
+
+	mu        sync.RWMutex
+	commit    *commit.Commit
+	commitCID cid.Cid
+	validator RecordValidator
+}
+
+// NewRepo creates a new empty repository with the initial commit
+// The key is used for signing commits, and must have the private key.
+func NewRepo(did string, key *didkey.DIDKey, store blockstore.Blockstore) (*Repo, *CommitResult, error) {
+	if key == nil || key.PrivateKey == nil {
+		return nil, nil, fmt.Errorf("failed to create repo; signing key must have the private key")
+	}
+
+	r := &Repo{
+		did:   did,
+		store: store,
+		key:   key,
+	}
+
+	result, err := r.applyWrites(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create repo; %w", err)
+	}
+
+	return r, result, nil
+}
+
+// LoadRepo loads the repository at the commit from the store
+// The signature of the commit is verified with the key, which must not be nil.
+func LoadRepo(store blockstore.Blockstore, commitCID cid.Cid, key *didkey.DIDKey) (*Repo, error) {
+	b, err := store.Get(commitCID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repo; %w", err)
+	}
+
+	c, err := commit.Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repo; %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to load repo; %w", err)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("failed to load repo; key is nil")
+	}
+	if err := c.VerifySignature(key); err != nil {
+		return nil, fmt.Errorf("failed to load repo; %w", err)
+	}
+
+	return &Repo{
+		did:       c.DID,
+		store:     store,
+		key:       key,
+		commit:    c,
+		commitCID: commitCID,
+	}, nil
+}
+
+// DID returns the DID of the repository
+func (r *Repo) DID() string {
+	return r.did
+}
+
+// Commit returns the latest commit and its CID
+func (r *Repo) Commit() (*commit.Commit, cid.Cid) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.commit, r.commitCID
+}
+
+// Tree returns the MST of the latest commit
+func (r *Repo) Tree() (*mst.Tree, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return mst.LoadTree(r.store, r.commit.Data)
+}
+
+// SetValidator sets the validator of the records written to the repository
+// If the validator is nil, the records are only checked to have $type of the collection.
+func (r *Repo) SetValidator(validator RecordValidator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.validator = validator
+}
+
+// ValidateCollection validates the collection is a NSID without glob and fragment
+func ValidateCollection(collection string) error {
+	n, err := nsid.NewNSID(collection)
+	if err != nil {
+		return fmt.Errorf("invalid collection: %w", err)
+	}
+	if n.Glob() {
+		return fmt.Errorf("invalid collection: %s; must not have glob", collection)
+	}
+	if n.Fragment() != "" {
+		return fmt.Errorf("invalid collection: %s; must not have fragment", collection)
+	}
+	return nil
+}
+
+// validateWrite validates the write, and fills the rkey on create if it is empty
+func validateWrite(w *Write) error {
+	if err := ValidateCollection(w.Collection); err != nil {
+		return err
+	}
+
+	if w.Action == ACTION_CREATE && w.RKey == "" {
+		w.RKey = rkey.NewTID().String()
+	}
+	if _, err := rkey.NewAny(w.RKey); err != nil {
+		return err
+	}
+
+	switch w.Action {
+	case ACTION_CREATE, ACTION_UPDATE, ACTION_PUT:
+		if w.Value == nil {
+			return fmt.Errorf("invalid write: %s/%s; value is nil", w.Collection, w.RKey)
+		}
+		return validateRecord(w.Collection, w.Value)
+	case ACTION_DELETE:
+		if w.Value != nil {
+			return fmt.Errorf("invalid write: %s/%s; value must be nil on delete", w.Collection, w.RKey)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid write: %s/%s; unknown action: %d", w.Collection, w.RKey, w.Action)
+	}
+}
+
+// validateRecord validates the record is a map with $type of the collection
+func validateRecord(collection string, value datamodel.Node) error {
+	if value.Kind() != datamodel.Kind_Map {
+		return fmt.Errorf("invalid record; must be a map")
+	}
+
+	t, err := value.LookupByString("$type")
+	if err != nil {
+		return fmt.Errorf("invalid record; $type is missing")
+	}
+	typ, err := t.AsString()
+	if err != nil {
+		return fmt.Errorf("invalid record; $type must be a string")
+	}
+	if typ != collection {
+		return fmt.Errorf("invalid record; $type %s does not match the collection %s", typ, collection)
+	}
+
+	return nil
+}
+
+// ApplyWrites applies the writes to the repository atomically,
+// and creates exactly one signed commit
+// All writes are validated before the repository is modified.
+func (r *Repo) ApplyWrites(writes []Write) (*CommitResult, error) {
+	return r.applyWrites(writes)
+}
+
+func (r *Repo) applyWrites(writes []Write) (*CommitResult, error) {
+	r.mu.RLock()
+	validator := r.validator
+	r.mu.RUnlock()
+
+	validated := make([]Write, len(writes))
+	for i, w := range writes {
+		if err := validateWrite(&w); err != nil {
+			return nil, err
+		}
+		if validator != nil && w.Action != ACTION_DELETE {
+			if err := validator.ValidateRecordKey(w.Collection, w.RKey); err != nil {
+				return nil, err
+			}
+			if err := validator.ValidateRecord(w.Collection, w.Value); err != nil {
+				return nil, fmt.Errorf("invalid record: %s/%s; %w", w.Collection, w.RKey, err)
+			}
+		}
+		validated[i] = w
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tracking := blockstore.NewTrackingBlockstore(r.store)
+
+	var tree *mst.Tree
+	if r.commit == nil {
+		tree = mst.NewTree(tracking)
+	} else {
+		loaded, err := mst.LoadTree(tracking, r.commit.Data)
+		if err != nil {
+			return nil, err
+		}
+		tree = loaded
+	}
+
+	results := make([]WriteResult, 0, len(validated))
+	for _, w := range validated {
+		path := w.Collection + "/" + w.RKey
+
+		// resolve put under the lock, so that it does not race with other writes
+		if w.Action == ACTION_PUT {
+			w.Action = ACTION_UPDATE
+			if _, err := tree.Get(path); errors.Is(err, mst.ErrNotFound) {
+				w.Action = ACTION_CREATE
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		result := WriteResult{
+			Action:     w.Action,
+			Collection: w.Collection,
+			RKey:       w.RKey,
+		}
+
+		if w.Action != ACTION_DELETE {
+			c, err := putRecord(tracking, w.Value)
+			if err != nil {
+				return nil, err
+			}
+			result.CID = c
+		}
+
+		var err error
+		switch w.Action {
+		case ACTION_CREATE:
+			err = tree.Insert(path, result.CID)
+		case ACTION_UPDATE:
+			err = tree.Update(path, result.CID)
+		case ACTION_DELETE:
+			err = tree.Delete(path)
+		}
+		if errors.Is(err, mst.ErrExists) {
+			return nil, fmt.Errorf("%w: %s", ErrRecordExists, path)
+		}
+		if errors.Is(err, mst.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	data, err := tree.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	c := commit.NewCommit(r.did, data, nil)
+	if r.commit != nil && c.Rev <= r.commit.Rev {
+		return nil, fmt.Errorf("failed to commit; rev %s is not greater than the previous rev %s", c.Rev, r.commit.Rev)
+	}
+	if err := c.Sign(r.key); err != nil {
+		return nil, err
+	}
+
+	commitCID, b, err := c.Block()
+	if err != nil {
+		return nil, err
+	}
+	if err := tracking.Put(commitCID, b); err != nil {
+		return nil, err
+	}
+
+	result := &CommitResult{
+		Commit:  c,
+		CID:     commitCID,
+		Results: results,
+		Blocks:  tracking.WrittenBlocks(),
+	}
+	if r.commit != nil {
+		result.Prev = r.commitCID
+		result.PrevRev = r.commit.Rev
+	}
+
+	r.commit = c
+	r.commitCID = commitCID
+
+	return result, nil
+}
+
+// putRecord encodes the record in the atproto data model and puts it into the store
+func putRecord(store blockstore.Blockstore, value datamodel.Node) (cid.Cid, error) {
+	b, err := data.EncodeCBOR(value)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to encode record; %w", err)
+	}
+
+	c, err := data.CID(b)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if err := store.Put(c, b); err != nil {
+		return cid.Undef, err
+	}
+	return c, nil
+}
+
+// CreateRecord creates a new record with a new TID rkey
+func (r *Repo) CreateRecord(collection string, value datamodel.Node) (*WriteResult, error) {
+	result, err := r.ApplyWrites([]Write{
+		{Action: ACTION_CREATE, Collection: collection, Value: value},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result.Results[0], nil
+}
+
+// PutRecord creates the record or updates it if it already exists
+func (r *Repo) PutRecord(collection string, rk string, value datamodel.Node) (*WriteResult, error) {
+	result, err := r.ApplyWrites([]Write{
+		{Action: ACTION_PUT, Collection: collection, RKey: rk, Value: value},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result.Results[0], nil
+}
+
+// DeleteRecord deletes the record
+func (r *Repo) DeleteRecord(collection string, rk string) error {
+	_, err := r.ApplyWrites([]Write{
+		{Action: ACTION_DELETE, Collection: collection, RKey: rk},
+	})
+	return err
+}
+
+// GetRecord returns the record
+// If the record is not found, it returns ErrRecordNotFound
+func (r *Repo) GetRecord(collection string, rk string) (*Record, error) {
+	if err := ValidateCollection(collection); err != nil {
+		return nil, err
+	}
+	if _, err := rkey.NewAny(rk); err != nil {
+		return nil, err
+	}
+
+	tree, err := r.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	path := collection + "/" + rk
+	c, err := tree.Get(path)
+	if errors.Is(err, mst.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := r.loadRecord(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Record{
+		Collection: collection,
+		RKey:       rk,
+		CID:        c,
+		Value:      value,
+	}, nil
+}
+
+// ProveRecord returns the proof of the record in the current commit
+// If the record does not exist, the proof is a proof of non-existence.
+func (r *Repo) ProveRecord(collection string, rk string) (*proof.Proof, error) {
+	if err := ValidateCollection(collection); err != nil {
+		return nil, err
+	}
+	if _, err := rkey.NewAny(rk); err != nil {
+		return nil, err
+	}
+
+	_, commitCID := r.Commit()
+	return proof.Generate(r.store, commitCID, collection, rk)
+}
+
+func (r *Repo) loadRecord(c cid.Cid) (datamodel.Node, error) {
+	b, err := r.store.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := data.DecodeCBOR(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode record: %s; %w", c, err)
+	}
+	return value, nil
+}
+
+// ListRecords returns the records in the collection, and the cursor for the next page
+// The records are ordered by rkey in descending order, or ascending order if reverse is true.
+// The cursor is the rkey of the last record in the previous page (exclusive).
+// If there are no more records, the returned cursor is empty.
+func (r *Repo) ListRecords(collection string, cursor string, limit int, reverse bool) ([]Record, string, error) {
+	if err := ValidateCollection(collection); err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		limit = DEFAULT_LIST_LIMIT
+	}
+	if limit > MAX_LIST_LIMIT {
+		limit = MAX_LIST_LIMIT
+	}
+
+	tree, err := r.Tree()
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix := collection + "/"
+	records := make([]Record, 0, limit)
+	next := ""
+	fn := func(key string, val cid.Cid) error {
+		if !strings.HasPrefix(key, prefix) {
+			return mst.ErrStopWalk
+		}
+		rk := strings.TrimPrefix(key, prefix)
+		if cursor != "" && rk == cursor {
+			return nil
+		}
+		if len(records) == limit {
+			next = records[len(records)-1].RKey
+			return mst.ErrStopWalk
+		}
+
+		value, err := r.loadRecord(val)
+		if err != nil {
+			return err
+		}
+		records = append(records, Record{
+			Collection: collection,
+			RKey:       rk,
+			CID:        val,
+			Value:      value,
+		})
+		return nil
+	}
+
+	// walk from the cursor, and stop after the page is filled
+	if reverse {
+		from := prefix
+		if cursor != "" {
+			from = prefix + cursor + "\x00"
+		}
+		err = tree.WalkFrom(from, fn)
+	} else {
+		// rkeys consist of characters less than 0x7f
+		from := prefix + "\x7f"
+		if cursor != "" {
+			from = prefix + cursor
+		}
+		err = tree.WalkReverseFrom(from, fn)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return records, next, nil
+}
@@ -0,0 +1,302 @@
+package repo_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"go.yumnet.cloud/orangesea/repo"
+	"go.yumnet.cloud/orangesea/repo/blockstore"
+	"go.yumnet.cloud/orangesea/repo/internal/testutil"
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+)
+
+const (
+	testDID        = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+	testCollection = "app.bsky.feed.post"
+	testPrivateKey = "UG5D_errRMRHdipCiZnXcDfcUkVPxokA-DPFbkFvaXA"
+)
+
+func recordText(t *testing.T, record *repo.Record) string {
+	t.Helper()
+
+	n, err := record.Value.LookupByString("text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := n.AsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestRepo(t *testing.T) (*repo.Repo, blockstore.Blockstore) {
+	t.Helper()
+
+	store := blockstore.NewMemBlockstore()
+	r, _, err := repo.NewRepo(testDID, testutil.Key(t, testPrivateKey), store)
+	if err != nil {
+		t.Fatalf("NewRepo() error = %v", err)
+	}
+	return r, store
+}
+
+func TestRepo_CRUD(t *testing.T) {
+	r, store := newTestRepo(t)
+
+	created, err := r.CreateRecord(testCollection, testutil.Record(t, testCollection, "hello"))
+	if err != nil {
+		t.Fatalf("CreateRecord() error = %v", err)
+	}
+
+	got, err := r.GetRecord(testCollection, created.RKey)
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if !got.CID.Equals(created.CID) || recordText(t, got) != "hello" {
+		t.Errorf("GetRecord() = %v, want %v", got, created)
+	}
+
+	if _, err := r.PutRecord(testCollection, created.RKey, testutil.Record(t, testCollection, "updated")); err != nil {
+		t.Fatalf("PutRecord() error = %v", err)
+	}
+	got, err = r.GetRecord(testCollection, created.RKey)
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if recordText(t, got) != "updated" {
+		t.Errorf("GetRecord() text = %v, want %v", recordText(t, got), "updated")
+	}
+
+	if _, err := r.PutRecord("app.bsky.actor.profile", "self", testutil.Record(t, "app.bsky.actor.profile", "me")); err != nil {
+		t.Fatalf("PutRecord() error = %v", err)
+	}
+
+	if err := r.DeleteRecord(testCollection, created.RKey); err != nil {
+		t.Fatalf("DeleteRecord() error = %v", err)
+	}
+	if _, err := r.GetRecord(testCollection, created.RKey); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("GetRecord() error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+	if err := r.DeleteRecord(testCollection, created.RKey); !errors.Is(err, repo.ErrRecordNotFound) {
+		t.Errorf("DeleteRecord() error = %v, want %v", err, repo.ErrRecordNotFound)
+	}
+
+	// the repository can be loaded from the latest commit
+	_, commitCID := r.Commit()
+	loaded, err := repo.LoadRepo(store, commitCID, testutil.Key(t, testPrivateKey))
+	if err != nil {
+		t.Fatalf("LoadRepo() error = %v", err)
+	}
+	if _, err := loaded.GetRecord("app.bsky.actor.profile", "self"); err != nil {
+		t.Errorf("GetRecord() error = %v", err)
+	}
+
+	if _, err := repo.LoadRepo(store, commitCID, nil); err == nil {
+		t.Errorf("LoadRepo() with nil key error = nil, wantErr true")
+	}
+}
+
+func TestRepo_ApplyWrites(t *testing.T) {
+	r, _ := newTestRepo(t)
+	prev, prevCID := r.Commit()
+
+	result, err := r.ApplyWrites([]repo.Write{
+		{Action: repo.ACTION_CREATE, Collection: testCollection, RKey: "3jzfcijpj2z2a", Value: testutil.Record(t, testCollection, "a")},
+		{Action: repo.ACTION_CREATE, Collection: testCollection, Value: testutil.Record(t, testCollection, "b")},
+		{Action: repo.ACTION_UPDATE, Collection: testCollection, RKey: "3jzfcijpj2z2a", Value: testutil.Record(t, testCollection, "c")},
+		{Action: repo.ACTION_PUT, Collection: testCollection, RKey: "3jzfcijpj2z2a", Value: testutil.Record(t, testCollection, "d")},
+		{Action: repo.ACTION_PUT, Collection: testCollection, RKey: "3jzfcijpj2z2b", Value: testutil.Record(t, testCollection, "e")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyWrites() error = %v", err)
+	}
+
+	if len(result.Results) != 5 {
+		t.Errorf("ApplyWrites() results = %v, want 5 results", result.Results)
+	}
+	// put is resolved to update or create
+	if result.Results[3].Action != repo.ACTION_UPDATE || result.Results[4].Action != repo.ACTION_CREATE {
+		t.Errorf("ApplyWrites() put actions = %v %v, want %v %v", result.Results[3].Action, result.Results[4].Action, repo.ACTION_UPDATE, repo.ACTION_CREATE)
+	}
+	if !result.Prev.Equals(prevCID) || result.PrevRev != prev.Rev {
+		t.Errorf("ApplyWrites() prev = %v %v, want %v %v", result.Prev, result.PrevRev, prevCID, prev.Rev)
+	}
+	if result.Commit.Rev <= prev.Rev {
+		t.Errorf("ApplyWrites() rev = %v, want greater than %v", result.Commit.Rev, prev.Rev)
+	}
+	if has, _ := result.Blocks.Has(result.CID); !has {
+		t.Errorf("ApplyWrites() blocks do not have the commit")
+	}
+	if err := result.Commit.VerifySignature(testutil.Key(t, testPrivateKey)); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+
+	got, err := r.GetRecord(testCollection, "3jzfcijpj2z2a")
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v", err)
+	}
+	if recordText(t, got) != "d" {
+		t.Errorf("GetRecord() text = %v, want %v", recordText(t, got), "d")
+	}
+}
+
+func TestRepo_ApplyWrites_Invalid(t *testing.T) {
+	r, _ := newTestRepo(t)
+	_, before := r.Commit()
+
+	tests := []struct {
+		name  string
+		write repo.Write
+	}{
+		{
+			name:  "glob collection",
+			write: repo.Write{Action: repo.ACTION_CREATE, Collection: "app.bsky.*", Value: testutil.Record(t, "app.bsky.*", "a")},
+		},
+		{
+			name:  "collection with fragment",
+			write: repo.Write{Action: repo.ACTION_CREATE, Collection: "app.bsky.feed.post#main", Value: testutil.Record(t, "app.bsky.feed.post#main", "a")},
+		},
+		{
+			name:  "invalid rkey",
+			write: repo.Write{Action: repo.ACTION_CREATE, Collection: testCollection, RKey: "..", Value: testutil.Record(t, testCollection, "a")},
+		},
+		{
+			name:  "$type mismatch",
+			write: repo.Write{Action: repo.ACTION_CREATE, Collection: testCollection, Value: testutil.Record(t, "app.bsky.feed.like", "a")},
+		},
+		{
+			name:  "update of missing record",
+			write: repo.Write{Action: repo.ACTION_UPDATE, Collection: testCollection, RKey: "missing", Value: testutil.Record(t, testCollection, "a")},
+		},
+		{
+			name: "float value",
+			write: repo.Write{Action: repo.ACTION_CREATE, Collection: testCollection, Value: func() datamodel.Node {
+				n, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "$type", qp.String(testCollection))
+					qp.MapEntry(ma, "score", qp.Float(1.5))
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return n
+			}()},
+		},
+		{
+			name:  "delete with value",
+			write: repo.Write{Action: repo.ACTION_DELETE, Collection: testCollection, RKey: "missing", Value: testutil.Record(t, testCollection, "a")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := repo.Write{Action: repo.ACTION_CREATE, Collection: testCollection, Value: testutil.Record(t, testCollection, "ok")}
+			if _, err := r.ApplyWrites([]repo.Write{valid, tt.write}); err == nil {
+				t.Errorf("ApplyWrites() error = nil, wantErr true")
+			}
+
+			if _, after := r.Commit(); !after.Equals(before) {
+				t.Errorf("ApplyWrites() created a commit on error")
+			}
+		})
+	}
+}
+
+func TestRepo_SetValidator(t *testing.T) {
+	r, _ := newTestRepo(t)
+
+	catalog := lexicon.NewCatalog()
+	_, err := catalog.AddJSON([]byte(`{
+		"lexicon": 1,
+		"id": "app.bsky.feed.post",
+		"defs": {
+			"main": {
+				"type": "record",
+				"key": "tid",
+				"record": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string", "maxLength": 5}}}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetValidator(lexicon.NewValidator(catalog))
+
+	if _, err := r.CreateRecord(testCollection, testutil.Record(t, testCollection, "hello")); err != nil {
+		t.Errorf("CreateRecord() error = %v", err)
+	}
+
+	var verr *lexicon.ValidationError
+	if _, err := r.CreateRecord(testCollection, testutil.Record(t, testCollection, "too long")); !errors.As(err, &verr) {
+		t.Errorf("CreateRecord() error = %v, want ValidationError", err)
+	}
+	if _, err := r.PutRecord(testCollection, "self", testutil.Record(t, testCollection, "hello")); err == nil {
+		t.Errorf("PutRecord() with non-TID rkey error = nil, wantErr true")
+	}
+	if _, err := r.CreateRecord("app.bsky.feed.like", testutil.Record(t, "app.bsky.feed.like", "hello")); err == nil {
+		t.Errorf("CreateRecord() of unknown collection error = nil, wantErr true")
+	}
+}
+
+func TestRepo_ListRecords(t *testing.T) {
+	r, _ := newTestRepo(t)
+
+	var writes []repo.Write
+	for i := 0; i < 7; i++ {
+		writes = append(writes, repo.Write{
+			Action:     repo.ACTION_CREATE,
+			Collection: testCollection,
+			RKey:       fmt.Sprintf("rkey%d", i),
+			Value:      testutil.Record(t, testCollection, fmt.Sprint(i)),
+		})
+	}
+	writes = append(writes, repo.Write{
+		Action:     repo.ACTION_CREATE,
+		Collection: "app.bsky.feed.like",
+		RKey:       "rkey0",
+		Value:      testutil.Record(t, "app.bsky.feed.like", "like"),
+	})
+	if _, err := r.ApplyWrites(writes); err != nil {
+		t.Fatalf("ApplyWrites() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		reverse bool
+		want    []string
+	}{
+		{name: "descending", reverse: false, want: []string{"rkey6", "rkey5", "rkey4", "rkey3", "rkey2", "rkey1", "rkey0"}},
+		{name: "ascending", reverse: true, want: []string{"rkey0", "rkey1", "rkey2", "rkey3", "rkey4", "rkey5", "rkey6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				records, next, err := r.ListRecords(testCollection, cursor, 3, tt.reverse)
+				if err != nil {
+					t.Fatalf("ListRecords() error = %v", err)
+				}
+				for _, record := range records {
+					got = append(got, record.RKey)
+				}
+				if next == "" {
+					break
+				}
+				if pages > 3 {
+					t.Fatalf("ListRecords() did not terminate")
+				}
+				cursor = next
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ListRecords() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
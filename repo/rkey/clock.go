@@ -0,0 +1,64 @@
+package rkey
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MAX_CLOCK_ID is the maximum value of the 10-bit clock ID
+const MAX_CLOCK_ID = 1<<10 - 1
+
+var defaultClock *Clock
+
+// Clock generates TIDs which are strictly increasing within the process.
+// If the time source returns the same or an earlier timestamp than
+// the last generated TID (e.g. bursty creation or clock skew),
+// the timestamp is advanced by one microsecond from the last one.
+// Clock is safe for concurrent use.
+type Clock struct {
+	mu      sync.Mutex
+	last    int64 // last timestamp in microseconds
+	clockID uint16
+	now     func() time.Time
+}
+
+// NewClock returns a new Clock with the given clock ID and time source.
+// If now is nil, time.Now is used as the time source.
+// If the clock ID does not fit in 10 bits, it will return nil and error
+func NewClock(clockID uint16, now func() time.Time) (*Clock, error) {
+	if clockID > MAX_CLOCK_ID {
+		return nil, fmt.Errorf("invalid clock ID: %d; must be less than or equal to %d", clockID, MAX_CLOCK_ID)
+	}
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Clock{
+		clockID: clockID,
+		now:     now,
+	}, nil
+}
+
+// ClockID returns the clock ID of the Clock
+func (c *Clock) ClockID() uint16 {
+	return c.clockID
+}
+
+// Next returns a new TID which is greater than any TID
+// previously generated by the Clock.
+func (c *Clock) Next() *TID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ts := c.now().UnixMicro()
+	if ts <= c.last {
+		ts = c.last + 1
+	}
+	c.last = ts
+
+	return &TID{
+		timestamp: time.UnixMicro(ts),
+		clockID:   c.clockID,
+	}
+}
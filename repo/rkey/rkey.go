@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"go.yumnet.cloud/orangesea/repo/nsid"
 )
 
 type RKeyType int
@@ -23,6 +25,11 @@ func init() {
 	}
 
 	CLOCK_ID = uint16(rand.Uint64())
+
+	defaultClock, err = NewClock(CLOCK_ID, nil)
+	if err != nil {
+		panic(err)
+	}
 }
 
 const (
@@ -30,6 +37,7 @@ const (
 	TYPE_TID RKeyType = iota
 	TYPE_LITERAL
 	TYPE_ANY
+	TYPE_NSID
 )
 
 func (t RKeyType) String() string {
@@ -40,6 +48,8 @@ func (t RKeyType) String() string {
 		return "literal"
 	case TYPE_ANY:
 		return "any"
+	case TYPE_NSID:
+		return "nsid"
 	default:
 		return "unknown"
 	}
@@ -47,6 +57,14 @@ func (t RKeyType) String() string {
 
 const (
 	S32_ALPHABET = "234567abcdefghijklmnopqrstuvwxyz"
+
+	// TID_LENGTH is the length of the string representation of TID
+	TID_LENGTH = 13
+)
+
+var (
+	rkeyPattern = regexp.MustCompile(`^[A-Za-z0-9.\-_:~]{1,512}$`)
+	tidPattern  = regexp.MustCompile(`^[234567abcdefghij][234567abcdefghijklmnopqrstuvwxyz]{12}$`)
 )
 
 type RKey interface {
@@ -54,6 +72,26 @@ type RKey interface {
 	Type() RKeyType
 }
 
+// ParseRKey validates the rkey value against the Lexicon record-key
+// type spec (`tid`, `nsid`, `any` or `literal:<value>`)
+// and returns the RKey implementation for the spec.
+func ParseRKey(spec string, value string) (RKey, error) {
+	switch spec {
+	case "tid":
+		return ParseTID(value)
+	case "nsid":
+		return NewNSID(value)
+	case "any":
+		return NewAny(value)
+	}
+
+	if literal, ok := strings.CutPrefix(spec, "literal:"); ok {
+		return NewLiteral(literal, value)
+	}
+
+	return nil, fmt.Errorf("invalid rkey spec: %s; unknown type", spec)
+}
+
 func s32encode(n uint64) string {
 	var s string
 	for n > 0 {
@@ -73,8 +111,7 @@ func s32decode(s string) uint64 {
 }
 
 func validateRKey(rkey string) bool {
-	r := regexp.MustCompile(`^[A-Za-z0-9.\-_~]{1,512}$`)
-	if ok := r.MatchString(rkey); !ok {
+	if ok := rkeyPattern.MatchString(rkey); !ok {
 		return false
 	}
 
@@ -91,33 +128,58 @@ type TID struct {
 	clockID   uint16
 }
 
-// NewTIDFromRKey returns a new generated TID.
+// NewTID returns a new generated TID.
+// TIDs generated by NewTID are strictly increasing within the process.
 func NewTID() *TID {
-	return &TID{
-		timestamp: time.Now(),
-		clockID:   CLOCK_ID,
+	return defaultClock.Next()
+}
+
+// ParseTID parses the string representation of TID.
+// The string must be 13 characters of base32-sortable,
+// and the high bit (the first bit of the 64-bit integer) must be zero.
+func ParseTID(s string) (*TID, error) {
+	if len(s) != TID_LENGTH {
+		return nil, fmt.Errorf("invalid TID: %s; length must be %d", s, TID_LENGTH)
+	}
+	if !tidPattern.MatchString(s) {
+		return nil, fmt.Errorf("invalid TID: %s; wrong pattern", s)
+	}
+
+	n := s32decode(s)
+	if n>>63 != 0 {
+		return nil, fmt.Errorf("invalid TID: %s; high bit must be zero", s)
 	}
+
+	return &TID{
+		timestamp: time.UnixMicro(int64(n >> 10)),
+		clockID:   uint16(n & 0x3ff),
+	}, nil
+}
+
+// Timestamp returns the timestamp of the TID in microsecond precision
+func (tid *TID) Timestamp() time.Time {
+	return tid.timestamp
+}
+
+// ClockID returns the 10-bit clock ID of the TID
+func (tid *TID) ClockID() uint16 {
+	return tid.clockID
 }
 
 // String returns the string representation of the TID
 // this is the same as calling TID.Value()
 func (tid *TID) String() string {
-	now := s32encode(
-		uint64(time.Now().UnixMicro()),
-	)
-
-	cid := s32encode(
-		uint64(tid.clockID),
-	)
+	n := uint64(tid.timestamp.UnixMicro())<<10 | uint64(tid.clockID&MAX_CLOCK_ID)
 
-	// pad with "2" while the clockid7s length is less than 2.
+	// pad with "2" while the length is less than TID_LENGTH.
 	// this is based on implementation by the reference implementation.
 	// https://github.com/bluesky-social/atproto/blob/main/packages/common-web/src/tid.ts
-	for len(cid) < 2 {
-		cid = "2" + cid
+	s := s32encode(n)
+	for len(s) < TID_LENGTH {
+		s = "2" + s
 	}
 
-	return now + cid
+	return s
 }
 
 // Value returns the string representation of the TID
@@ -136,11 +198,15 @@ type Literal struct {
 	value string
 }
 
-// NewLiteralFromRKey returns a new Literal from a string
-// if the string is not a valid rkey, it will return nil and error
-func NewLiteral(value string) (*Literal, error) {
-	if !validateRKey(value) {
-		return nil, fmt.Errorf("invalid rkey: %s", value)
+// NewLiteral returns a new Literal from a string
+// if the literal is not a valid rkey or the value does not match the literal,
+// it will return nil and error
+func NewLiteral(literal string, value string) (*Literal, error) {
+	if !validateRKey(literal) {
+		return nil, fmt.Errorf("invalid rkey literal: %s", literal)
+	}
+	if value != literal {
+		return nil, fmt.Errorf("invalid rkey: %s; must be %s", value, literal)
 	}
 
 	return &Literal{
@@ -198,3 +264,56 @@ func (any *Any) Value() string {
 func (any *Any) Type() RKeyType {
 	return TYPE_ANY
 }
+
+type NSID struct {
+	value string
+	nsid  *nsid.NSID
+}
+
+// NewNSID returns a new NSID rkey from a string
+// if the string is not a valid rkey or NSID, it will return nil and error
+// NSIDs with glob or fragment are not allowed as rkey.
+func NewNSID(value string) (*NSID, error) {
+	if !validateRKey(value) {
+		return nil, fmt.Errorf("invalid rkey: %s", value)
+	}
+
+	n, err := nsid.NewNSID(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rkey: %s; %w", value, err)
+	}
+	if n.Glob() {
+		return nil, fmt.Errorf("invalid rkey: %s; NSID must not have glob", value)
+	}
+	if n.Fragment() != "" {
+		return nil, fmt.Errorf("invalid rkey: %s; NSID must not have fragment", value)
+	}
+
+	return &NSID{
+		value: value,
+		nsid:  n,
+	}, nil
+}
+
+// NSID returns the parsed NSID of the rkey
+func (n *NSID) NSID() *nsid.NSID {
+	return n.nsid
+}
+
+// String returns the string representation of the NSID
+// this is the same as calling NSID.Value()
+func (n *NSID) String() string {
+	return n.value
+}
+
+// Value returns the string representation of the NSID
+// this is the same as calling NSID.String()
+func (n *NSID) Value() string {
+	return n.String()
+}
+
+// Type returns the type of the rkey
+// this is always TYPE_NSID for NSID
+func (n *NSID) Type() RKeyType {
+	return TYPE_NSID
+}
@@ -0,0 +1,332 @@
+package rkey
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTID(t *testing.T) {
+	type args struct {
+		s string
+	}
+
+	tests := []struct {
+		name          string
+		args          args
+		wantTimestamp time.Time
+		wantClockID   uint16
+		wantErr       bool
+	}{
+		{
+			name: "successfull case - normal 1",
+			args: args{
+				s: "3jzfcijpj2z2a",
+			},
+			wantTimestamp: time.UnixMicro(1688137381887007),
+			wantClockID:   6,
+			wantErr:       false,
+		},
+		{
+			name: "successfull case - normal 2",
+			args: args{
+				s: "3kao2cl6bpr2a",
+			},
+			wantTimestamp: time.UnixMicro(1696134411198135),
+			wantClockID:   6,
+			wantErr:       false,
+		},
+		{
+			name: "successfull case - zero",
+			args: args{
+				s: "2222222222222",
+			},
+			wantTimestamp: time.UnixMicro(0),
+			wantClockID:   0,
+			wantErr:       false,
+		},
+		{
+			name: "failure case - empty string",
+			args: args{
+				s: "",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failure case - too short",
+			args: args{
+				s: "3jzfcijpj2z2",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failure case - too long",
+			args: args{
+				s: "3jzfcijpj2z2aa",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failure case - upper case",
+			args: args{
+				s: "3JZFCIJPJ2Z2A",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failure case - invalid character",
+			args: args{
+				s: "3jzfcijpj2z21",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failure case - invalid first character",
+			args: args{
+				s: "zjzfcijpj2z2a",
+			},
+			wantErr: true,
+		},
+		{
+			name: "failure case - high bit is set",
+			args: args{
+				s: "jzzzzzzzzzzzz",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTID(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Timestamp().Equal(tt.wantTimestamp) {
+				t.Errorf("ParseTID().Timestamp() = %v, want %v", got.Timestamp(), tt.wantTimestamp)
+			}
+			if got.ClockID() != tt.wantClockID {
+				t.Errorf("ParseTID().ClockID() = %v, want %v", got.ClockID(), tt.wantClockID)
+			}
+		})
+	}
+}
+
+func TestTID_String(t *testing.T) {
+	tests := []string{
+		"3jzfcijpj2z2a",
+		"3kao2cl6bpr2a",
+		"2222222222222",
+		"bzzzzzzzzzzzz",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			tid, err := ParseTID(tt)
+			if err != nil {
+				t.Fatalf("ParseTID() error = %v", err)
+			}
+			if got := tid.String(); got != tt {
+				t.Errorf("String() = %v, want %v", got, tt)
+			}
+			if got := tid.String(); got != tt {
+				t.Errorf("String() is not stable; got %v, want %v", got, tt)
+			}
+		})
+	}
+}
+
+func TestNewClock(t *testing.T) {
+	if _, err := NewClock(MAX_CLOCK_ID, nil); err != nil {
+		t.Errorf("NewClock() error = %v, wantErr false", err)
+	}
+	if _, err := NewClock(MAX_CLOCK_ID+1, nil); err == nil {
+		t.Errorf("NewClock() error = nil, wantErr true")
+	}
+}
+
+func TestClock_Next(t *testing.T) {
+	base := time.UnixMicro(1688137381887007)
+	times := []time.Time{
+		base,
+		base,                        // same microsecond
+		base.Add(-time.Second),      // clock skew
+		base.Add(time.Microsecond),  // caught up by the skew correction
+		base.Add(time.Millisecond),  // ahead
+		base.Add(time.Nanosecond),   // sub-microsecond difference
+		base.Add(-time.Millisecond), // clock skew again
+	}
+
+	i := 0
+	clock, err := NewClock(42, func() time.Time {
+		now := times[i]
+		i++
+		return now
+	})
+	if err != nil {
+		t.Fatalf("NewClock() error = %v", err)
+	}
+
+	var prev string
+	for range times {
+		tid := clock.Next()
+		if tid.ClockID() != 42 {
+			t.Errorf("ClockID() = %v, want %v", tid.ClockID(), 42)
+		}
+		if s := tid.String(); s <= prev {
+			t.Errorf("Next() = %v, want greater than %v", s, prev)
+		}
+		prev = tid.String()
+	}
+}
+
+func TestClock_Next_Concurrent(t *testing.T) {
+	clock, err := NewClock(0, func() time.Time {
+		return time.UnixMicro(1688137381887007)
+	})
+	if err != nil {
+		t.Fatalf("NewClock() error = %v", err)
+	}
+
+	const workers, perWorker = 8, 1000
+
+	results := make(chan string, workers*perWorker)
+	done := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := 0; i < perWorker; i++ {
+				results <- clock.Next().String()
+			}
+			done <- struct{}{}
+		}()
+	}
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+	close(results)
+
+	seen := make(map[string]bool)
+	for s := range results {
+		if seen[s] {
+			t.Fatalf("Next() generated duplicated TID: %v", s)
+		}
+		seen[s] = true
+	}
+}
+
+func TestParseRKey(t *testing.T) {
+	type args struct {
+		spec  string
+		value string
+	}
+
+	tests := []struct {
+		name     string
+		args     args
+		wantType RKeyType
+		wantErr  bool
+	}{
+		{
+			name:     "successfull case - tid",
+			args:     args{spec: "tid", value: "3jzfcijpj2z2a"},
+			wantType: TYPE_TID,
+		},
+		{
+			name:     "successfull case - nsid",
+			args:     args{spec: "nsid", value: "app.bsky.feed.post"},
+			wantType: TYPE_NSID,
+		},
+		{
+			name:     "successfull case - any",
+			args:     args{spec: "any", value: "self"},
+			wantType: TYPE_ANY,
+		},
+		{
+			name:     "successfull case - any with allowed symbols",
+			args:     args{spec: "any", value: "a.b-c_d~e:f"},
+			wantType: TYPE_ANY,
+		},
+		{
+			name:     "successfull case - any with colon",
+			args:     args{spec: "any", value: "pre:fix"},
+			wantType: TYPE_ANY,
+		},
+		{
+			name:     "successfull case - literal",
+			args:     args{spec: "literal:self", value: "self"},
+			wantType: TYPE_LITERAL,
+		},
+		{
+			name:     "successfull case - literal with colon",
+			args:     args{spec: "literal:pre:fix", value: "pre:fix"},
+			wantType: TYPE_LITERAL,
+		},
+		{
+			name:    "failure case - unknown spec",
+			args:    args{spec: "record", value: "self"},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - tid with invalid value",
+			args:    args{spec: "tid", value: "self"},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - nsid with invalid value",
+			args:    args{spec: "nsid", value: "self"},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - nsid with glob",
+			args:    args{spec: "nsid", value: "app.bsky.*"},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - any with dot",
+			args:    args{spec: "any", value: "."},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - any with dot dot",
+			args:    args{spec: "any", value: ".."},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - any with slash",
+			args:    args{spec: "any", value: "a/b"},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - literal mismatch",
+			args:    args{spec: "literal:self", value: "other"},
+			wantErr: true,
+		},
+		{
+			name:    "failure case - literal with invalid literal",
+			args:    args{spec: "literal:a/b", value: "a/b"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRKey(tt.args.spec, tt.args.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Type() != tt.wantType {
+				t.Errorf("ParseRKey().Type() = %v, want %v", got.Type(), tt.wantType)
+			}
+			if got.Value() != tt.args.value {
+				t.Errorf("ParseRKey().Value() = %v, want %v", got.Value(), tt.args.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package xrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon/lexutil"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const (
+	CREATE_SESSION  = "com.atproto.server.createSession"
+	REFRESH_SESSION = "com.atproto.server.refreshSession"
+)
+
+// Session is the authenticated session of an account
+type Session struct {
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	Handle     string `json:"handle"`
+	DID        string `json:"did"`
+}
+
+// Client calls XRPC methods of a service
+// Client implements lexutil.Client for the generated code. Client is safe for concurrent use.
+type Client struct {
+	Host      string       // base URL of the service, e.g. "https://bsky.social"
+	Client    *http.Client // nil for http.DefaultClient
+	UserAgent string
+	Headers   http.Header // additional headers of every request, e.g. "atproto-proxy"
+
+	// OnSessionRefresh is called with the new session after the session is refreshed
+	OnSessionRefresh func(*Session)
+
+	mu        sync.Mutex
+	session   *Session
+	rateLimit *RateLimit
+
+	refreshMu sync.Mutex // held while refreshing the session, as a refresh token may be used only once
+}
+
+var _ lexutil.Client = (*Client)(nil)
+
+// NewClient returns a new Client of the service
+func NewClient(host string) *Client {
+	return &Client{
+		Host:   strings.TrimSuffix(host, "/"),
+		Client: http.DefaultClient,
+	}
+}
+
+// Session returns the current session, or nil if the client is not authenticated
+func (c *Client) Session() *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.session
+}
+
+// SetSession sets the session to authenticate requests; nil to clear
+func (c *Client) SetSession(s *Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.session = s
+}
+
+// RateLimit returns the rate-limit state of the last response, or nil if unknown
+func (c *Client) RateLimit() *RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rateLimit
+}
+
+// Query calls the query (HTTP GET) method
+// The output is nil to discard the body, an io.Writer to copy the raw body,
+// or a pointer to decode the JSON body into.
+func (c *Client) Query(ctx context.Context, method *nsid.NSID, params url.Values, output interface{}) error {
+	return c.call(ctx, http.MethodGet, method, params, "", nil, output)
+}
+
+// Procedure calls the procedure (HTTP POST) method
+// The input is nil for no body, an io.Reader or []byte of the raw body in the encoding,
+// or a value to encode in JSON. The output is the same as Query.
+func (c *Client) Procedure(ctx context.Context, method *nsid.NSID, params url.Values, encoding string, input interface{}, output interface{}) error {
+	return c.call(ctx, http.MethodPost, method, params, encoding, input, output)
+}
+
+// Do calls the method by the kind; implements lexutil.Client
+func (c *Client) Do(ctx context.Context, kind lexutil.RequestKind, encoding string, method string, params url.Values, input interface{}, output interface{}) error {
+	id, err := nsid.NewNSID(method)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case lexutil.QUERY:
+		return c.Query(ctx, id, params, output)
+	case lexutil.PROCEDURE:
+		return c.Procedure(ctx, id, params, encoding, input, output)
+	}
+	return fmt.Errorf("unknown request kind: %d", kind)
+}
+
+// CreateSession authenticates the account with the password and sets the session
+func (c *Client) CreateSession(ctx context.Context, identifier string, password string) (*Session, error) {
+	input := map[string]string{"identifier": identifier, "password": password}
+
+	var s Session
+	if err := c.call(ctx, http.MethodPost, nsidOf(CREATE_SESSION), nil, ENCODING_JSON, input, &s); err != nil {
+		return nil, err
+	}
+
+	c.SetSession(&s)
+	return &s, nil
+}
+
+// RefreshSession refreshes the session with the refresh token and sets the new session
+func (c *Client) RefreshSession(ctx context.Context) (*Session, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	return c.refreshSession(ctx)
+}
+
+// refreshExpired refreshes the session whose access token is expired
+// If the session has been refreshed or replaced since, e.g. by a concurrent call, the current session is returned.
+func (c *Client) refreshExpired(ctx context.Context, expired *Session) (*Session, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	current := c.Session()
+	if current == expired {
+		return c.refreshSession(ctx)
+	}
+	if current == nil || current.AccessJwt == "" {
+		return nil, fmt.Errorf("failed to refresh session; session is cleared")
+	}
+	return current, nil
+}
+
+// refreshSession refreshes the session; c.refreshMu must be held
+func (c *Client) refreshSession(ctx context.Context) (*Session, error) {
+	current := c.Session()
+	if current == nil || current.RefreshJwt == "" {
+		return nil, fmt.Errorf("failed to refresh session; no refresh token")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, nsidOf(REFRESH_SESSION), nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+current.RefreshJwt)
+
+	var s Session
+	if err := c.send(req, &s); err != nil {
+		return nil, fmt.Errorf("failed to refresh session; %w", err)
+	}
+	if s.DID == "" {
+		s.DID = current.DID
+	}
+	if s.Handle == "" {
+		s.Handle = current.Handle
+	}
+
+	c.SetSession(&s)
+	if c.OnSessionRefresh != nil {
+		c.OnSessionRefresh(&s)
+	}
+	return &s, nil
+}
+
+func nsidOf(s string) *nsid.NSID {
+	id, err := nsid.NewNSID(s)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// call sends the request with the access token,
+// and retries once with the refreshed session if the token is expired
+func (c *Client) call(ctx context.Context, httpMethod string, method *nsid.NSID, params url.Values, encoding string, input interface{}, output interface{}) error {
+	body, contentType, err := encodeInput(encoding, input)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, httpMethod, method, params, contentType, body)
+	if err != nil {
+		return err
+	}
+	session := c.Session()
+	if session != nil && session.AccessJwt != "" {
+		req.Header.Set("Authorization", "Bearer "+session.AccessJwt)
+	}
+
+	err = c.send(req, output)
+	if !errors.Is(err, ErrExpiredToken) || session == nil || session.RefreshJwt == "" {
+		return err
+	}
+
+	// the body must be sent again
+	if body != nil && req.GetBody == nil {
+		seeker, ok := body.(io.Seeker)
+		if !ok {
+			return err
+		}
+		if _, serr := seeker.Seek(0, io.SeekStart); serr != nil {
+			return err
+		}
+	}
+
+	refreshed, rerr := c.refreshExpired(ctx, session)
+	if rerr != nil {
+		return err
+	}
+
+	if req.GetBody != nil {
+		if body, rerr = req.GetBody(); rerr != nil {
+			return err
+		}
+	}
+	retry, rerr := c.newRequest(ctx, httpMethod, method, params, contentType, body)
+	if rerr != nil {
+		return rerr
+	}
+	retry.Header.Set("Authorization", "Bearer "+refreshed.AccessJwt)
+	return c.send(retry, output)
+}
+
+// encodeInput returns the request body and its content type
+func encodeInput(encoding string, input interface{}) (io.Reader, string, error) {
+	raw := func(r io.Reader) (io.Reader, string, error) {
+		if encoding == "" || encoding == ENCODING_ANY || strings.Contains(encoding, "*") {
+			encoding = ENCODING_OCTET_STREAM
+		}
+		return r, encoding, nil
+	}
+
+	switch v := input.(type) {
+	case nil:
+		return nil, "", nil
+	case io.Reader:
+		return raw(v)
+	case []byte:
+		return raw(bytes.NewReader(v))
+	}
+
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode input; %w", err)
+	}
+	return bytes.NewReader(b), ENCODING_JSON, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, httpMethod string, method *nsid.NSID, params url.Values, contentType string, body io.Reader) (*http.Request, error) {
+	u := c.Host + PATH_PREFIX + method.String()
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, httpMethod, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range c.Headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return req, nil
+}
+
+// send sends the request and decodes the response into the output
+func (c *Client) send(req *http.Request, output interface{}) error {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s; %w", req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	rateLimit := ParseRateLimit(resp.Header)
+	if rateLimit != nil {
+		c.mu.Lock()
+		c.rateLimit = rateLimit
+		c.mu.Unlock()
+	}
+
+	if resp.StatusCode >= 400 {
+		return decodeError(resp, rateLimit)
+	}
+
+	switch out := output.(type) {
+	case nil:
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	case io.Writer:
+		if _, err := io.Copy(out, resp.Body); err != nil {
+			return fmt.Errorf("failed to read output; %w", err)
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != ENCODING_JSON {
+		return fmt.Errorf("failed to decode output; unexpected content type: %s", mediaType)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return fmt.Errorf("failed to decode output; %w", err)
+	}
+	return nil
+}
+
+// decodeError decodes the XRPC error envelope of the response
+func decodeError(resp *http.Response, rateLimit *RateLimit) error {
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MAX_ERROR_BODY))
+	if err != nil {
+		return fmt.Errorf("failed to read error; %w", err)
+	}
+
+	var envelope struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	message := ""
+	if err := json.Unmarshal(b, &envelope); err == nil {
+		message = envelope.Message
+	} else {
+		message = strings.TrimSpace(string(b))
+	}
+
+	e := NewError(resp.StatusCode, envelope.Error, message)
+	e.RateLimit = rateLimit
+	return e
+}
@@ -0,0 +1,302 @@
+package xrpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.yumnet.cloud/orangesea/repo/lexicon/lexutil"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+	"go.yumnet.cloud/orangesea/repo/xrpc"
+)
+
+func mustNSID(t *testing.T, s string) *nsid.NSID {
+	t.Helper()
+
+	id, err := nsid.NewNSID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestClient_Query(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/xrpc/com.example.feed.getTimeline" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.URL.Query()["tag"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+			t.Errorf("tag = %v", got)
+		}
+		w.Header().Set("RateLimit-Limit", "100")
+		w.Header().Set("RateLimit-Remaining", "99")
+		w.Header().Set("RateLimit-Reset", "1700000000")
+		w.Header().Set("RateLimit-Policy", "100;w=300")
+		writeJSON(w, http.StatusOK, map[string]string{"cursor": "next"})
+	}))
+	defer srv.Close()
+
+	c := xrpc.NewClient(srv.URL)
+	var out struct {
+		Cursor string `json:"cursor"`
+	}
+	params := url.Values{"tag": []string{"a", "b"}}
+	if err := c.Query(context.Background(), mustNSID(t, "com.example.feed.getTimeline"), params, &out); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if out.Cursor != "next" {
+		t.Errorf("Query() cursor = %q, want next", out.Cursor)
+	}
+
+	rl := c.RateLimit()
+	if rl == nil || rl.Limit != 100 || rl.Remaining != 99 || rl.Policy != "100;w=300" || !rl.Reset.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("RateLimit() = %+v", rl)
+	}
+}
+
+func TestClient_Procedure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/xrpc/com.example.repo.createRecord":
+			if r.Header.Get("Content-Type") != xrpc.ENCODING_JSON {
+				t.Errorf("Content-Type = %s", r.Header.Get("Content-Type"))
+			}
+			var in map[string]string
+			if err := json.Unmarshal(b, &in); err != nil || in["repo"] != "did:plc:example" {
+				t.Errorf("input = %s", b)
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"uri": "at://did:plc:example/com.example.feed.post/1"})
+		case "/xrpc/com.example.repo.uploadBlob":
+			if r.Header.Get("Content-Type") != "image/png" || string(b) != "\x89PNG" {
+				t.Errorf("blob = %s %q", r.Header.Get("Content-Type"), b)
+			}
+			writeJSON(w, http.StatusOK, map[string]string{})
+		case "/xrpc/com.example.repo.importRepo":
+			if r.Header.Get("Content-Type") != xrpc.ENCODING_CAR {
+				t.Errorf("Content-Type = %s", r.Header.Get("Content-Type"))
+			}
+			w.Header().Set("Content-Type", xrpc.ENCODING_CAR)
+			w.Write(b)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	c := xrpc.NewClient(srv.URL)
+	ctx := context.Background()
+
+	var out struct {
+		URI string `json:"uri"`
+	}
+	in := map[string]string{"repo": "did:plc:example"}
+	if err := c.Procedure(ctx, mustNSID(t, "com.example.repo.createRecord"), nil, xrpc.ENCODING_JSON, in, &out); err != nil {
+		t.Fatalf("Procedure() error = %v", err)
+	}
+	if out.URI == "" {
+		t.Errorf("Procedure() uri is empty")
+	}
+
+	if err := c.Procedure(ctx, mustNSID(t, "com.example.repo.uploadBlob"), nil, "image/png", strings.NewReader("\x89PNG"), nil); err != nil {
+		t.Fatalf("Procedure() error = %v", err)
+	}
+
+	car := new(bytes.Buffer)
+	if err := c.Procedure(ctx, mustNSID(t, "com.example.repo.importRepo"), nil, xrpc.ENCODING_CAR, []byte("car data"), car); err != nil {
+		t.Fatalf("Procedure() error = %v", err)
+	}
+	if car.String() != "car data" {
+		t.Errorf("Procedure() output = %q, want car data", car.String())
+	}
+
+	// lexutil.Client for the generated code
+	var lc lexutil.Client = c
+	if err := lc.Do(ctx, lexutil.PROCEDURE, xrpc.ENCODING_JSON, "com.example.repo.createRecord", nil, in, &out); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if err := lc.Do(ctx, lexutil.QUERY, "", "not an nsid", nil, nil, nil); err == nil {
+		t.Errorf("Do() error = nil, want invalid nsid")
+	}
+}
+
+func TestClient_Error(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    *xrpc.Error
+		message string
+	}{
+		{"failure case; envelope", http.StatusBadRequest, `{"error": "InvalidRequest", "message": "bad cursor"}`, xrpc.ErrInvalidRequest, "bad cursor"},
+		{"failure case; custom name", http.StatusBadRequest, `{"error": "RecordNotFound", "message": "not found"}`, &xrpc.Error{Name: "RecordNotFound"}, "not found"},
+		{"failure case; no name", http.StatusUnauthorized, `{}`, xrpc.ErrAuthRequired, ""},
+		{"failure case; not json", http.StatusBadGateway, "upstream is down\n", xrpc.ErrUpstreamFailure, "upstream is down"},
+		{"failure case; rate limited", http.StatusTooManyRequests, `{"error": "RateLimitExceeded"}`, xrpc.ErrRateLimitExceeded, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("RateLimit-Limit", "10")
+				w.Header().Set("RateLimit-Remaining", "0")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			err := xrpc.NewClient(srv.URL).Query(context.Background(), mustNSID(t, "com.example.feed.getPost"), nil, nil)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Query() error = %v, want %v", err, tt.want)
+			}
+
+			var xerr *xrpc.Error
+			if !errors.As(err, &xerr) {
+				t.Fatalf("Query() error = %T, want *xrpc.Error", err)
+			}
+			if xerr.StatusCode != tt.status || xerr.Message != tt.message {
+				t.Errorf("Query() error = %+v", xerr)
+			}
+			if xerr.RateLimit == nil || xerr.RateLimit.Limit != 10 || xerr.RateLimit.Remaining != 0 {
+				t.Errorf("Query() error rate limit = %+v", xerr.RateLimit)
+			}
+		})
+	}
+}
+
+func TestClient_RefreshSession(t *testing.T) {
+	refreshed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/xrpc/" + xrpc.CREATE_SESSION:
+			writeJSON(w, http.StatusOK, xrpc.Session{AccessJwt: "access-1", RefreshJwt: "refresh-1", Handle: "alice.test", DID: "did:plc:alice"})
+		case "/xrpc/" + xrpc.REFRESH_SESSION:
+			if auth != "Bearer refresh-1" {
+				writeJSON(w, http.StatusBadRequest, xrpc.NewError(http.StatusBadRequest, "InvalidToken", ""))
+				return
+			}
+			refreshed++
+			writeJSON(w, http.StatusOK, xrpc.Session{AccessJwt: "access-2", RefreshJwt: "refresh-2"})
+		case "/xrpc/com.example.repo.createRecord":
+			if auth != "Bearer access-2" {
+				writeJSON(w, http.StatusBadRequest, xrpc.NewError(http.StatusBadRequest, "ExpiredToken", "token has expired"))
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			if string(b) != `{"text":"hello"}` {
+				t.Errorf("retried input = %s", b)
+			}
+			writeJSON(w, http.StatusOK, map[string]string{})
+		}
+	}))
+	defer srv.Close()
+
+	c := xrpc.NewClient(srv.URL)
+	ctx := context.Background()
+
+	var notified *xrpc.Session
+	c.OnSessionRefresh = func(s *xrpc.Session) { notified = s }
+
+	if _, err := c.CreateSession(ctx, "alice.test", "password"); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	in := map[string]string{"text": "hello"}
+	if err := c.Procedure(ctx, mustNSID(t, "com.example.repo.createRecord"), nil, xrpc.ENCODING_JSON, in, nil); err != nil {
+		t.Fatalf("Procedure() error = %v", err)
+	}
+	if refreshed != 1 {
+		t.Errorf("refreshed = %d, want 1", refreshed)
+	}
+
+	s := c.Session()
+	if s.AccessJwt != "access-2" || s.RefreshJwt != "refresh-2" || s.DID != "did:plc:alice" || s.Handle != "alice.test" {
+		t.Errorf("Session() = %+v", s)
+	}
+	if notified != s {
+		t.Errorf("OnSessionRefresh() is not called with the new session")
+	}
+
+	// the expired token error is returned if the refresh fails
+	c.SetSession(&xrpc.Session{AccessJwt: "access-1", RefreshJwt: "refresh-x"})
+	err := c.Procedure(ctx, mustNSID(t, "com.example.repo.createRecord"), nil, xrpc.ENCODING_JSON, in, nil)
+	if !errors.Is(err, xrpc.ErrExpiredToken) {
+		t.Errorf("Procedure() error = %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestClient_RefreshSession_Concurrent(t *testing.T) {
+	const n = 10
+	var expired sync.WaitGroup
+	expired.Add(n)
+
+	var mu sync.Mutex
+	refreshed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/xrpc/" + xrpc.REFRESH_SESSION:
+			// the refresh token is rotated, and cannot be used again
+			mu.Lock()
+			defer mu.Unlock()
+			if auth != "Bearer refresh-1" || refreshed > 0 {
+				writeJSON(w, http.StatusBadRequest, xrpc.NewError(http.StatusBadRequest, "InvalidToken", ""))
+				return
+			}
+			refreshed++
+			writeJSON(w, http.StatusOK, xrpc.Session{AccessJwt: "access-2", RefreshJwt: "refresh-2"})
+		case "/xrpc/com.example.feed.getTimeline":
+			if auth != "Bearer access-2" {
+				// respond after all the calls are sent with the expired token
+				expired.Done()
+				expired.Wait()
+				writeJSON(w, http.StatusBadRequest, xrpc.NewError(http.StatusBadRequest, "ExpiredToken", "token has expired"))
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{})
+		}
+	}))
+	defer srv.Close()
+
+	c := xrpc.NewClient(srv.URL)
+	c.SetSession(&xrpc.Session{AccessJwt: "access-1", RefreshJwt: "refresh-1"})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Query(context.Background(), mustNSID(t, "com.example.feed.getTimeline"), nil, nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Query() error = %v", err)
+		}
+	}
+	if refreshed != 1 {
+		t.Errorf("refreshed = %d, want 1", refreshed)
+	}
+	if s := c.Session(); s.AccessJwt != "access-2" {
+		t.Errorf("Session() = %+v", s)
+	}
+}
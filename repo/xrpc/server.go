@@ -0,0 +1,421 @@
+package xrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"go.yumnet.cloud/orangesea/repo/data"
+	"go.yumnet.cloud/orangesea/repo/firehose"
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+	"go.yumnet.cloud/orangesea/repo/nsid"
+)
+
+const (
+	DEFAULT_MAX_INPUT_SIZE = 5 << 20
+)
+
+// Request is the request to an XRPC method
+type Request struct {
+	HTTP     *http.Request
+	Method   *nsid.NSID
+	Params   url.Values
+	Encoding string    // media type of the input; empty if there is no input
+	Input    io.Reader // nil if there is no input
+}
+
+// DecodeInput decodes the JSON input into v
+func (r *Request) DecodeInput(v interface{}) error {
+	if r.Input == nil || r.Encoding != ENCODING_JSON {
+		return NewError(http.StatusBadRequest, "", "expected JSON input")
+	}
+	if err := json.NewDecoder(r.Input).Decode(v); err != nil {
+		return NewError(http.StatusBadRequest, "", fmt.Sprintf("invalid JSON input; %v", err))
+	}
+	return nil
+}
+
+// Output is the raw output of a method in the encoding, e.g. a CAR file or a blob
+type Output struct {
+	Encoding string
+	Body     io.Reader
+}
+
+// Handler handles a query or a procedure
+// The output is nil for no body, *Output for the raw body, or a value to encode in JSON.
+// If the error is an *Error, it is sent as is; otherwise, InternalServerError is sent.
+type Handler func(ctx context.Context, r *Request) (output interface{}, err error)
+
+// SubscriptionHandler handles a subscription; it sends messages to the stream until it returns
+// The context is canceled when the connection is closed.
+// If the error is not nil, it is sent in an error frame before the connection is closed.
+type SubscriptionHandler func(ctx context.Context, r *Request, s *Stream) error
+
+type route struct {
+	kind         string // lexicon.TYPE_QUERY, lexicon.TYPE_PROCEDURE or lexicon.TYPE_SUBSCRIPTION
+	handler      Handler
+	subscription SubscriptionHandler
+}
+
+// Server routes `/xrpc/<nsid>` to the handlers of the methods
+// If Validator is set, the parameters and the input of the methods in the catalog are validated.
+type Server struct {
+	Validator *lexicon.Validator
+
+	// ValidateOutput enables the validation of the JSON output; requires Validator
+	ValidateOutput bool
+
+	// MaxInputSize is the maximum size of the input; DEFAULT_MAX_INPUT_SIZE if zero
+	MaxInputSize int64
+
+	Upgrader *websocket.Upgrader
+
+	// OnError is called with the errors which are not *Error, e.g. to log them.
+	OnError func(r *http.Request, err error)
+
+	mu     sync.RWMutex
+	routes map[string]*route
+}
+
+// NewServer returns a new Server without validation
+func NewServer() *Server {
+	return &Server{
+		MaxInputSize: DEFAULT_MAX_INPUT_SIZE,
+		Upgrader:     &websocket.Upgrader{},
+		routes:       make(map[string]*route),
+	}
+}
+
+// HandleQuery registers the handler of the query (HTTP GET) method
+func (s *Server) HandleQuery(method *nsid.NSID, h Handler) error {
+	return s.handle(method, &route{kind: lexicon.TYPE_QUERY, handler: h})
+}
+
+// HandleProcedure registers the handler of the procedure (HTTP POST) method
+func (s *Server) HandleProcedure(method *nsid.NSID, h Handler) error {
+	return s.handle(method, &route{kind: lexicon.TYPE_PROCEDURE, handler: h})
+}
+
+// HandleSubscription registers the handler of the subscription (WebSocket) method
+func (s *Server) HandleSubscription(method *nsid.NSID, h SubscriptionHandler) error {
+	return s.handle(method, &route{kind: lexicon.TYPE_SUBSCRIPTION, subscription: h})
+}
+
+func (s *Server) handle(method *nsid.NSID, r *route) error {
+	if method.Glob() || method.Fragment() != "" {
+		return fmt.Errorf("invalid method: %s; must not have glob or fragment", method)
+	}
+	if s.Validator != nil {
+		if def, err := s.Validator.Catalog.Def(method); err == nil && def.Type() != r.kind {
+			return fmt.Errorf("invalid method: %s; defined as %s, not %s", method, def.Type(), r.kind)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.routes == nil {
+		s.routes = make(map[string]*route)
+	}
+	key := method.String()
+	if _, ok := s.routes[key]; ok {
+		return fmt.Errorf("method already registered: %s", key)
+	}
+	s.routes[key] = r
+	return nil
+}
+
+// validates returns true if the method is in the catalog of the validator
+func (s *Server) validates(method *nsid.NSID) bool {
+	if s.Validator == nil {
+		return false
+	}
+	_, err := s.Validator.Catalog.Def(method)
+	return err == nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutPrefix(r.URL.Path, PATH_PREFIX)
+	if !ok {
+		s.writeError(w, r, NewError(http.StatusNotFound, "", "not an XRPC path"))
+		return
+	}
+	method, err := nsid.NewNSID(name)
+	if err != nil || method.Glob() || method.Fragment() != "" {
+		s.writeError(w, r, NewError(http.StatusBadRequest, "", fmt.Sprintf("invalid method: %s", name)))
+		return
+	}
+
+	s.mu.RLock()
+	rt, ok := s.routes[method.String()]
+	s.mu.RUnlock()
+	if !ok {
+		s.writeError(w, r, NewError(http.StatusNotImplemented, "", fmt.Sprintf("method not implemented: %s", method)))
+		return
+	}
+
+	httpMethod := http.MethodGet
+	if rt.kind == lexicon.TYPE_PROCEDURE {
+		httpMethod = http.MethodPost
+	}
+	if r.Method != httpMethod && !(r.Method == http.MethodHead && rt.kind == lexicon.TYPE_QUERY) {
+		w.Header().Set("Allow", httpMethod)
+		s.writeError(w, r, NewError(http.StatusMethodNotAllowed, "InvalidRequest", fmt.Sprintf("%s requires %s", rt.kind, httpMethod)))
+		return
+	}
+
+	req := &Request{HTTP: r, Method: method, Params: r.URL.Query()}
+	validates := s.validates(method)
+	if validates {
+		if err := s.Validator.ValidateParams(method, req.Params); err != nil {
+			s.writeError(w, r, NewError(http.StatusBadRequest, "", err.Error()))
+			return
+		}
+	}
+
+	if rt.kind == lexicon.TYPE_SUBSCRIPTION {
+		s.serveSubscription(w, req, rt.subscription)
+		return
+	}
+
+	if rt.kind == lexicon.TYPE_PROCEDURE {
+		if err := s.readInput(w, req, validates); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+	}
+
+	output, err := rt.handler(r.Context(), req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.writeOutput(w, req, output, validates && s.ValidateOutput)
+}
+
+// readInput reads the input of the procedure, and validates it if required
+func (s *Server) readInput(w http.ResponseWriter, req *Request, validates bool) error {
+	r := req.HTTP
+	hasBody := r.ContentLength > 0 || (r.ContentLength < 0 && r.Header.Get("Content-Type") != "")
+	if !hasBody {
+		if validates {
+			if err := s.Validator.ValidateInput(req.Method, "", nil); err != nil {
+				return NewError(http.StatusBadRequest, "", err.Error())
+			}
+		}
+		return nil
+	}
+
+	encoding, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return NewError(http.StatusBadRequest, "", "invalid content type")
+	}
+
+	maxSize := s.MaxInputSize
+	if maxSize == 0 {
+		maxSize = DEFAULT_MAX_INPUT_SIZE
+	}
+	if r.ContentLength > maxSize {
+		return NewError(http.StatusRequestEntityTooLarge, "", fmt.Sprintf("input must be at most %d bytes", maxSize))
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return NewError(http.StatusRequestEntityTooLarge, "", fmt.Sprintf("input must be at most %d bytes", maxSize))
+		}
+		return NewError(http.StatusBadRequest, "", "failed to read input")
+	}
+
+	if validates {
+		var value datamodel.Node
+		if encoding == ENCODING_JSON {
+			if value, err = data.DecodeJSON(b); err != nil {
+				return NewError(http.StatusBadRequest, "", err.Error())
+			}
+		}
+		if err := s.Validator.ValidateInput(req.Method, encoding, value); err != nil {
+			return NewError(http.StatusBadRequest, "", err.Error())
+		}
+	}
+
+	req.Encoding = encoding
+	req.Input = bytes.NewReader(b)
+	return nil
+}
+
+// writeOutput writes the output of the handler, and validates it if required
+func (s *Server) writeOutput(w http.ResponseWriter, req *Request, output interface{}, validate bool) {
+	var encoding string
+	var body io.Reader
+	switch v := output.(type) {
+	case nil:
+	case *Output:
+		if c, ok := v.Body.(io.Closer); ok {
+			defer c.Close()
+		}
+		encoding, body = v.Encoding, v.Body
+		if encoding == "" {
+			encoding = ENCODING_OCTET_STREAM
+		}
+	default:
+		b, err := json.Marshal(output)
+		if err != nil {
+			s.writeError(w, req.HTTP, fmt.Errorf("failed to encode output; %w", err))
+			return
+		}
+		if validate {
+			value, err := data.DecodeJSON(b)
+			if err == nil {
+				err = s.Validator.ValidateOutput(req.Method, ENCODING_JSON, value)
+			}
+			if err != nil {
+				s.writeError(w, req.HTTP, fmt.Errorf("invalid output of %s; %w", req.Method, err))
+				return
+			}
+		}
+		encoding, body = ENCODING_JSON, bytes.NewReader(b)
+	}
+
+	if validate && encoding != ENCODING_JSON {
+		if err := s.Validator.ValidateOutput(req.Method, encoding, nil); err != nil {
+			s.writeError(w, req.HTTP, fmt.Errorf("invalid output of %s; %w", req.Method, err))
+			return
+		}
+	}
+
+	if body == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", encoding)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil && s.OnError != nil {
+		s.OnError(req.HTTP, fmt.Errorf("failed to write output; %w", err))
+	}
+}
+
+// writeError writes the error, and reports it if it is not an *Error or cannot be written
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var xerr *Error
+	if !errors.As(err, &xerr) && s.OnError != nil {
+		s.OnError(r, err)
+	}
+	if err := WriteError(w, err); err != nil && s.OnError != nil {
+		s.OnError(r, err)
+	}
+}
+
+// WriteError writes the error in the XRPC error envelope, and returns the error on writing
+// If the error is not an *Error, InternalServerError is written without the message.
+func WriteError(w http.ResponseWriter, err error) error {
+	var xerr *Error
+	if !errors.As(err, &xerr) {
+		xerr = NewError(http.StatusInternalServerError, "", "")
+	}
+
+	statusCode := xerr.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+	if xerr.RateLimit != nil {
+		xerr.RateLimit.Header(w.Header())
+	}
+	w.Header().Set("Content-Type", ENCODING_JSON)
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(xerr); err != nil {
+		return fmt.Errorf("failed to write error; %w", err)
+	}
+	return nil
+}
+
+// serveSubscription upgrades the connection and runs the handler of the subscription
+func (s *Server) serveSubscription(w http.ResponseWriter, req *Request, h SubscriptionHandler) {
+	upgrader := s.Upgrader
+	if upgrader == nil {
+		upgrader = &websocket.Upgrader{}
+	}
+	conn, err := upgrader.Upgrade(w, req.HTTP, nil)
+	if err != nil {
+		// the upgrader has written the error response
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(req.HTTP.Context())
+	defer cancel()
+
+	// the client sends no messages; reading detects the closed connection
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	stream := &Stream{conn: conn}
+	if err := h(ctx, req, stream); err != nil && ctx.Err() == nil {
+		var xerr *Error
+		if !errors.As(err, &xerr) {
+			if s.OnError != nil {
+				s.OnError(req.HTTP, err)
+			}
+			xerr = NewError(http.StatusInternalServerError, "", "")
+		}
+		if err := stream.sendError(xerr); err != nil && s.OnError != nil {
+			s.OnError(req.HTTP, err)
+		}
+	}
+	stream.close()
+}
+
+// Stream is the stream of a subscription
+// Each message is a frame of the header and the body in DAG-CBOR.
+type Stream struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// Send encodes the event by firehose.EncodeFrame, and sends it
+func (s *Stream) Send(e *firehose.Event) error {
+	frame, err := firehose.EncodeFrame(e)
+	if err != nil {
+		return err
+	}
+	return s.SendFrame(frame)
+}
+
+// SendFrame sends the encoded frame, e.g. by firehose.EncodeFrame
+func (s *Stream) SendFrame(frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+func (s *Stream) sendError(e *Error) error {
+	frame := &firehose.ErrorFrame{Error: e.Name}
+	if e.Message != "" {
+		frame.Message = &e.Message
+	}
+	return s.Send(&firehose.Event{Error: frame})
+}
+
+func (s *Stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
@@ -0,0 +1,293 @@
+package xrpc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"go.yumnet.cloud/orangesea/repo/firehose"
+	"go.yumnet.cloud/orangesea/repo/lexicon"
+	"go.yumnet.cloud/orangesea/repo/xrpc"
+)
+
+var testLexicons = []string{`{
+	"lexicon": 1,
+	"id": "com.example.getItem",
+	"defs": {
+		"main": {
+			"type": "query",
+			"parameters": {"type": "params", "required": ["id"], "properties": {"id": {"type": "integer", "minimum": 1}}},
+			"output": {
+				"encoding": "application/json",
+				"schema": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string"}}}
+			}
+		}
+	}
+}`, `{
+	"lexicon": 1,
+	"id": "com.example.createItem",
+	"defs": {
+		"main": {
+			"type": "procedure",
+			"input": {
+				"encoding": "application/json",
+				"schema": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string", "maxLength": 10}}}
+			}
+		}
+	}
+}`}
+
+func testServer(t *testing.T) (*xrpc.Server, *xrpc.Client) {
+	t.Helper()
+
+	catalog := lexicon.NewCatalog()
+	for _, doc := range testLexicons {
+		if _, err := catalog.AddJSON([]byte(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := xrpc.NewServer()
+	s.Validator = lexicon.NewValidator(catalog)
+	s.ValidateOutput = true
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, xrpc.NewClient(srv.URL)
+}
+
+func TestServer_Query(t *testing.T) {
+	s, c := testServer(t)
+	ctx := context.Background()
+
+	err := s.HandleQuery(mustNSID(t, "com.example.getItem"), func(ctx context.Context, r *xrpc.Request) (interface{}, error) {
+		switch r.Params.Get("id") {
+		case "1":
+			return map[string]string{"text": "hello"}, nil
+		case "2":
+			return map[string]int{"text": 2}, nil
+		case "3":
+			return nil, errors.New("database is down")
+		}
+		return nil, xrpc.NewError(http.StatusBadRequest, "ItemNotFound", "no such item")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported error
+	s.OnError = func(r *http.Request, err error) { reported = err }
+
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := c.Query(ctx, mustNSID(t, "com.example.getItem"), map[string][]string{"id": {"1"}}, &out); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if out.Text != "hello" {
+		t.Errorf("Query() text = %q, want hello", out.Text)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		want   *xrpc.Error
+	}{
+		{"failure case; invalid params", "com.example.getItem", "0", xrpc.ErrInvalidRequest},
+		{"failure case; handler error", "com.example.getItem", "4", &xrpc.Error{Name: "ItemNotFound"}},
+		{"failure case; invalid output", "com.example.getItem", "2", xrpc.ErrInternalServerError},
+		{"failure case; internal error", "com.example.getItem", "3", xrpc.ErrInternalServerError},
+		{"failure case; not implemented", "com.example.unknown", "1", xrpc.ErrMethodNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Query(ctx, mustNSID(t, tt.method), map[string][]string{"id": {tt.id}}, nil)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Query() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if reported == nil || !strings.Contains(reported.Error(), "database is down") {
+		t.Errorf("OnError() is called with %v", reported)
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestServer_Procedure(t *testing.T) {
+	s, c := testServer(t)
+	ctx := context.Background()
+
+	var created string
+	err := s.HandleProcedure(mustNSID(t, "com.example.createItem"), func(ctx context.Context, r *xrpc.Request) (interface{}, error) {
+		var in struct {
+			Text string `json:"text"`
+		}
+		if err := r.DecodeInput(&in); err != nil {
+			return nil, err
+		}
+		created = in.Text
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &closeRecorder{Reader: strings.NewReader("car data")}
+	err = s.HandleProcedure(mustNSID(t, "com.example.getRepo"), func(ctx context.Context, r *xrpc.Request) (interface{}, error) {
+		return &xrpc.Output{Encoding: xrpc.ENCODING_CAR, Body: body}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Procedure(ctx, mustNSID(t, "com.example.createItem"), nil, xrpc.ENCODING_JSON, map[string]string{"text": "hello"}, nil); err != nil {
+		t.Fatalf("Procedure() error = %v", err)
+	}
+	if created != "hello" {
+		t.Errorf("created = %q, want hello", created)
+	}
+
+	err = c.Procedure(ctx, mustNSID(t, "com.example.createItem"), nil, xrpc.ENCODING_JSON, map[string]string{"text": "too long text"}, nil)
+	if !errors.Is(err, xrpc.ErrInvalidRequest) {
+		t.Errorf("Procedure() error = %v, want ErrInvalidRequest", err)
+	}
+	err = c.Procedure(ctx, mustNSID(t, "com.example.createItem"), nil, "text/plain", []byte("hello"), nil)
+	if !errors.Is(err, xrpc.ErrInvalidRequest) {
+		t.Errorf("Procedure() error = %v, want ErrInvalidRequest", err)
+	}
+
+	car := new(bytes.Buffer)
+	if err := c.Procedure(ctx, mustNSID(t, "com.example.getRepo"), nil, "", nil, car); err != nil {
+		t.Fatalf("Procedure() error = %v", err)
+	}
+	if car.String() != "car data" {
+		t.Errorf("Procedure() output = %q, want car data", car.String())
+	}
+	if !body.closed {
+		t.Errorf("Procedure() did not close the output body")
+	}
+
+	// the procedure must be called with POST
+	err = c.Query(ctx, mustNSID(t, "com.example.createItem"), nil, nil)
+	var xerr *xrpc.Error
+	if !errors.As(err, &xerr) || xerr.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Query() error = %v, want method not allowed", err)
+	}
+}
+
+func TestServer_Handle(t *testing.T) {
+	s, _ := testServer(t)
+	h := func(ctx context.Context, r *xrpc.Request) (interface{}, error) { return nil, nil }
+
+	if err := s.HandleQuery(mustNSID(t, "com.example.createItem"), h); err == nil {
+		t.Errorf("HandleQuery() error = nil, want kind mismatch")
+	}
+	if err := s.HandleQuery(mustNSID(t, "com.example.getItem#other"), h); err == nil {
+		t.Errorf("HandleQuery() error = nil, want invalid method")
+	}
+	if err := s.HandleQuery(mustNSID(t, "com.example.getItem"), h); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.HandleQuery(mustNSID(t, "com.example.getItem"), h); err == nil {
+		t.Errorf("HandleQuery() error = nil, want already registered")
+	}
+}
+
+func TestServer_InvalidPath(t *testing.T) {
+	s := xrpc.NewServer()
+
+	tests := []struct {
+		path       string
+		statusCode int
+		name       string
+	}{
+		{"/xrpc/not-an-nsid", http.StatusBadRequest, "InvalidRequest"},
+		{"/xrpc/com.example.*", http.StatusBadRequest, "InvalidRequest"},
+		{"/other", http.StatusNotFound, "XRPCNotSupported"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.statusCode || !strings.Contains(rec.Body.String(), `"error":"`+tt.name+`"`) {
+			t.Errorf("ServeHTTP(%s) = %d %s", tt.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestServer_Subscription(t *testing.T) {
+	s := xrpc.NewServer()
+	err := s.HandleSubscription(mustNSID(t, "com.example.subscribe"), func(ctx context.Context, r *xrpc.Request, st *xrpc.Stream) error {
+		greeting := r.Params.Get("greeting")
+		if err := st.Send(&firehose.Event{Type: firehose.TYPE_INFO, Info: &firehose.InfoEvent{Name: "Hello", Message: &greeting}}); err != nil {
+			return err
+		}
+		return xrpc.NewError(http.StatusBadRequest, "FutureCursor", "cursor in the future")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/xrpc/com.example.subscribe?greeting=hi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	read := func() *firehose.Event {
+		typ, b, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != websocket.BinaryMessage {
+			t.Fatalf("message type = %d, want binary", typ)
+		}
+		e, err := firehose.DecodeFrame(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	e := read()
+	if e.Info == nil || e.Info.Name != "Hello" || e.Info.Message == nil || *e.Info.Message != "hi" {
+		t.Errorf("message = %+v", e)
+	}
+	e = read()
+	if e.Error == nil || e.Error.Error != "FutureCursor" {
+		t.Errorf("error frame = %+v", e)
+	}
+
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("ReadMessage() error = %v, want normal closure", err)
+	}
+
+	// a plain GET is not upgraded
+	resp, err := http.Get(srv.URL + "/xrpc/com.example.subscribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status code = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,126 @@
+// the package xrpc implements the XRPC HTTP API of atproto
+// https://atproto.com/specs/xrpc
+
+package xrpc
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	PATH_PREFIX = "/xrpc/"
+
+	ENCODING_JSON         = "application/json"
+	ENCODING_CAR          = "application/vnd.ipld.car"
+	ENCODING_OCTET_STREAM = "application/octet-stream"
+	ENCODING_ANY          = "*/*"
+
+	MAX_ERROR_BODY = 1 << 20 // maximum size of the error body to read
+)
+
+// Error is the XRPC error of `{"error": ..., "message": ...}`
+// The error matches the sentinel errors of the same name with errors.Is.
+type Error struct {
+	StatusCode int        `json:"-"`
+	Name       string     `json:"error"`
+	Message    string     `json:"message,omitempty"`
+	RateLimit  *RateLimit `json:"-"` // nil if the response has no rate-limit headers
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("xrpc error: %s (%d)", e.Name, e.StatusCode)
+	}
+	return fmt.Sprintf("xrpc error: %s (%d); %s", e.Name, e.StatusCode, e.Message)
+}
+
+// Is returns true if the target is an *Error of the same name
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Name == e.Name
+}
+
+// standard errors
+var (
+	ErrInvalidRequest       = &Error{StatusCode: http.StatusBadRequest, Name: "InvalidRequest"}
+	ErrExpiredToken         = &Error{StatusCode: http.StatusBadRequest, Name: "ExpiredToken"}
+	ErrInvalidToken         = &Error{StatusCode: http.StatusBadRequest, Name: "InvalidToken"}
+	ErrAuthRequired         = &Error{StatusCode: http.StatusUnauthorized, Name: "AuthenticationRequired"}
+	ErrForbidden            = &Error{StatusCode: http.StatusForbidden, Name: "Forbidden"}
+	ErrMethodNotSupported   = &Error{StatusCode: http.StatusNotFound, Name: "XRPCNotSupported"}
+	ErrPayloadTooLarge      = &Error{StatusCode: http.StatusRequestEntityTooLarge, Name: "PayloadTooLarge"}
+	ErrRateLimitExceeded    = &Error{StatusCode: http.StatusTooManyRequests, Name: "RateLimitExceeded"}
+	ErrInternalServerError  = &Error{StatusCode: http.StatusInternalServerError, Name: "InternalServerError"}
+	ErrMethodNotImplemented = &Error{StatusCode: http.StatusNotImplemented, Name: "MethodNotImplemented"}
+	ErrUpstreamFailure      = &Error{StatusCode: http.StatusBadGateway, Name: "UpstreamFailure"}
+	ErrNotEnoughResources   = &Error{StatusCode: http.StatusServiceUnavailable, Name: "NotEnoughResources"}
+	ErrUpstreamTimeout      = &Error{StatusCode: http.StatusGatewayTimeout, Name: "UpstreamTimeout"}
+)
+
+// statusErrors is the errors of the status codes, used if the error body has no name
+var statusErrors = map[int]*Error{
+	http.StatusBadRequest:            ErrInvalidRequest,
+	http.StatusUnauthorized:          ErrAuthRequired,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrMethodNotSupported,
+	http.StatusRequestEntityTooLarge: ErrPayloadTooLarge,
+	http.StatusTooManyRequests:       ErrRateLimitExceeded,
+	http.StatusInternalServerError:   ErrInternalServerError,
+	http.StatusNotImplemented:        ErrMethodNotImplemented,
+	http.StatusBadGateway:            ErrUpstreamFailure,
+	http.StatusServiceUnavailable:    ErrNotEnoughResources,
+	http.StatusGatewayTimeout:        ErrUpstreamTimeout,
+}
+
+// NewError returns the error of the status code with the name and the message
+// If the name is empty, the standard name of the status code is used.
+func NewError(statusCode int, name string, message string) *Error {
+	if name == "" {
+		name = "Error"
+		if e, ok := statusErrors[statusCode]; ok {
+			name = e.Name
+		}
+	}
+	return &Error{StatusCode: statusCode, Name: name, Message: message}
+}
+
+// RateLimit is the rate-limit state of the `RateLimit-*` headers
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time // when the limit resets
+	Policy    string    // e.g. "3000;w=300"
+}
+
+// ParseRateLimit parses the `RateLimit-*` headers
+// It returns nil if the headers have no RateLimit-Limit.
+func ParseRateLimit(h http.Header) *RateLimit {
+	limit, err := strconv.Atoi(h.Get("RateLimit-Limit"))
+	if err != nil {
+		return nil
+	}
+
+	rl := &RateLimit{Limit: limit, Policy: h.Get("RateLimit-Policy")}
+	if remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil {
+		rl.Remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(h.Get("RateLimit-Reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(reset, 0)
+	}
+	return rl
+}
+
+// Header sets the `RateLimit-*` headers
+func (rl *RateLimit) Header(h http.Header) {
+	h.Set("RateLimit-Limit", strconv.Itoa(rl.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(rl.Remaining))
+	if !rl.Reset.IsZero() {
+		h.Set("RateLimit-Reset", strconv.FormatInt(rl.Reset.Unix(), 10))
+	}
+	if rl.Policy != "" {
+		h.Set("RateLimit-Policy", rl.Policy)
+	}
+}